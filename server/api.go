@@ -2,7 +2,6 @@ package main
 
 import (
   "fmt"
-  "errors"
 
   // For reading file from disk
   "io/ioutil"
@@ -16,8 +15,36 @@ type Summary struct {
 }
 
 
+// Compile a string of lovelace source with a fresh compiler, so that gate and wire ids start from 1.
 func RunString(input string, verbose bool) (*Summary, error) {
-  result, err := Tokenizer(input)
+  compiler := NewCompiler()
+  compiler.Verbose = verbose
+  return compiler.RunString(input)
+}
+
+// Compile a file of lovelace source with a fresh compiler, so that gate and wire ids start from 1.
+func RunFile(path string, verbose bool) (*Summary, error) {
+  compiler := NewCompiler()
+  compiler.Verbose = verbose
+  return compiler.RunFile(path)
+}
+
+func (c *Compiler) RunString(input string) (*Summary, error) {
+  return c.run(input, "")
+}
+
+// Compile lovelace source that was read from `path`. If the source didn't come from a file, `path`
+// is empty.
+func (c *Compiler) run(input string, path string) (*Summary, error) {
+  verbose := c.Verbose
+  c.Warnings = nil
+  c.unrolledIterations = 0
+
+  // Even if the compile fails, the files that were read are known, so that they can be watched for
+  // changes (ie, by `lovel run`).
+  resolver := NewModuleResolver()
+  defer func() { c.Files = resolver.Files() }()
+  result, err := resolver.Tokenize(input, path)
   if err != nil {
     return nil, err
   }
@@ -46,7 +73,7 @@ func RunString(input string, verbose bool) (*Summary, error) {
 
   for len(resultValues) > 0 {
     if verbose { fmt.Println("==========>", resultValues) }
-    gates, wires, contexts, outputs, err := Parse(&resultValues, stack)
+    gates, wires, contexts, outputs, err := c.Parse(&resultValues, stack)
 
     allGates = append(allGates, gates...)
     allWires = append(allWires, wires...)
@@ -76,6 +103,7 @@ func RunString(input string, verbose bool) (*Summary, error) {
 
         fmt.Printf(` frame=%d`, gate.CallingContext)
         fmt.Printf(` label="%s"`, gate.Label)
+        fmt.Printf(` at %s`, formatSpan(gate.Source))
         fmt.Printf("\n")
       }
       fmt.Println("===")
@@ -118,16 +146,33 @@ func RunString(input string, verbose bool) (*Summary, error) {
     Contexts: allContexts,
     Outputs: finalOutputs,
   }
+  if c.MergeGates {
+    mergeGateChains(&summary)
+  }
+  if c.Optimize {
+    c.Optimizations = optimizeSummary(&summary)
+
+    // Optimizing can leave chains of gates that can be merged again.
+    if c.MergeGates {
+      mergeGateChains(&summary)
+      c.Optimizations.GatesAfter, c.Optimizations.WiresAfter = len(summary.Gates), len(summary.Wires)
+    }
+  }
+  attachSourceMap(&summary, resolver)
 
   return &summary, nil
 }
 
-func RunFile(path string, verbose bool) (*Summary, error) {
+func (c *Compiler) RunFile(path string) (*Summary, error) {
   // Read source code from disk
   source, err := ioutil.ReadFile(path)
   if err != nil {
-    return nil, errors.New(fmt.Sprintf("Error reading file %s: %s. Stop.\n", path, err));
+    return nil, &CompileError{
+      Code: FILE_ERROR,
+      Message: fmt.Sprintf("Error reading file %s: %s. Stop.\n", path, err),
+      File: path,
+    }
   }
 
-  return RunString(string(source), verbose)
+  return c.run(string(source), path)
 }
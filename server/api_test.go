@@ -4,13 +4,10 @@ import (
   "testing"
   "fmt"
   "reflect"
+  "strings"
 )
 
 func TestRunString(t *testing.T) {
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-
   summary, err := RunString("led(toggle())", false)
   // Verify error
   if err != nil {
@@ -52,10 +49,6 @@ func TestRunString(t *testing.T) {
 }
 
 func TestRunStringError(t *testing.T) {
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-
   _, err := RunString("syntax error 5", false)
 
   // Verify error was returned
@@ -64,3 +57,72 @@ func TestRunStringError(t *testing.T) {
     return
   }
 }
+
+func TestRunStringConcurrently(t *testing.T) {
+  source := `
+    block foo(a b) {
+      return (a and (not b))
+    }
+    led(foo(toggle() momentary()))
+  `
+
+  // Compile the same source in many goroutines at once. Each compile should be independent, so
+  // every summary should come back with the same ids.
+  results := make(chan *Summary)
+  for i := 0; i < 10; i++ {
+    go func() {
+      summary, err := RunString(source, false)
+      if err != nil {
+        t.Errorf(fmt.Sprintf("Error returned! %s", err))
+      }
+      results <- summary
+    }()
+  }
+
+  var first *Summary
+  for i := 0; i < 10; i++ {
+    summary := <-results
+    if summary == nil {
+      continue
+    }
+    if first == nil {
+      first = summary
+      continue
+    }
+
+    if !reflect.DeepEqual(first.Gates, summary.Gates) {
+      t.Error("Gates of two concurrent compiles don't match!")
+    }
+    if !reflect.DeepEqual(first.Contexts, summary.Contexts) {
+      t.Error("Contexts of two concurrent compiles don't match!")
+    }
+  }
+}
+
+func TestRunStringWaveWithInvalidDuty(t *testing.T) {
+  _, err := RunString("led(wave(1 4 4))", false)
+  if err == nil {
+    t.Errorf("No Error returned!")
+    return
+  }
+  if !strings.Contains(err.Error(), "must be on for between 1 and 3 ticks of its period, got 4") {
+    t.Errorf("Wrong error returned: %s", err)
+  }
+}
+
+func TestGatesKnowTheirSource(t *testing.T) {
+  summary, err := RunString("led(1)\nled(not 0)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  for _, gate := range summary.Gates {
+    if gate.Type == NOT && !reflect.DeepEqual(gate.Source, SourceSpan{
+      Line: 2, Col: 5, Offset: 11,
+      EndLine: 2, EndCol: 10, EndOffset: 16,
+    }) {
+      t.Errorf("Not gate has the wrong source: %+v", gate.Source)
+    }
+  }
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "strings"
+)
+
+// Arguments are usually bound to the parameters of a block by position, but they can also be
+// passed by name, after any positional arguments:
+//
+//   counter8(clock: clk, reset: 0)
+//
+// Parameters can also have a default value, which is used when an invocation doesn't pass them:
+//
+//   block counter8(clock reset = 0) { ... }
+
+// The name of each input to each builtin that accepts inputs, so that they can be passed by name.
+var BUILTIN_FUNCTION_PARAMETER_NAMES map[string][]string = map[string][]string{
+  "led": []string{"input"},
+  "wave": []string{"enable", "period", "duty"},
+  "tflipflop": []string{"clock", "toggle", "set", "reset"},
+}
+
+// Matches a parameter with a default value, like `reset = 0` or `a[4] = 4'd3`.
+var MATCH_PARAM_DEFAULT *regexp.Regexp = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)(\[[^\]\s]+])?\s*=\s*([0-9][0-9A-Za-z_']*)`)
+
+// Remove the default values from the parameters of a block. Returns the parameters without their
+// defaults, and the state of each wire of each default, by the name of its parameter. A default is
+// either `0`, `1`, or a literal like `4'd3`.
+func splitParamDefaults(params string) (string, map[string][]bool, error) {
+  defaults := map[string][]bool{}
+  for _, match := range MATCH_PARAM_DEFAULT.FindAllStringSubmatch(params, -1) {
+    var bits []bool
+    if match[3] == "0" || match[3] == "1" {
+      bits = []bool{match[3] == "1"}
+    } else if literal := MATCH_LITERAL.FindStringSubmatch(match[3]); literal != nil && literal[0] == match[3] {
+      var err error
+      bits, err = parseLiteral(literal[0], literal[1], literal[2], literal[3])
+      if err != nil {
+        return "", nil, err
+      }
+    } else {
+      return "", nil, errors.New(fmt.Sprintf(
+        "The default value %s of parameter %s isn't 0, 1, or a literal like 4'd0",
+        match[3],
+        match[1],
+      ))
+    }
+    defaults[match[1]] = bits
+  }
+
+  withoutDefaults := MATCH_PARAM_DEFAULT.ReplaceAllString(params, "$1$2")
+  return strings.Join(strings.Fields(withoutDefaults), " "), defaults, nil
+}
+
+// An argument that was passed by name, like `reset: 0`.
+type namedArgument struct {
+  Name string
+  Value Node
+}
+
+// Split the arguments to an invocation into those passed by position, which must come first, and
+// those passed by name.
+func splitNamedArguments(invocation Node, arguments []Node) ([]Node, []namedArgument, error) {
+  var positional []Node
+  var named []namedArgument
+  for index := 0; index < len(arguments); index++ {
+    argument := arguments[index]
+
+    if argument.Token != "ARGUMENT_NAME" {
+      if len(named) > 0 {
+        return nil, nil, NewNodeError(VALIDATION_ERROR, argument, fmt.Sprintf(
+          "The argument at %s is passed by position after an argument that was passed by name, in the invocation at %s. Stop.",
+          formatPosition(argument.File, argument.Line, argument.Col),
+          formatPosition(invocation.File, invocation.Line, invocation.Col),
+        ))
+      }
+      positional = append(positional, argument)
+      continue
+    }
+
+    name := argument.Data.(*ArgumentName).Name
+    // Integers are also values, since they can be passed to builtins like `wave`.
+    if index + 1 >= len(arguments) || !(TokenNameIsExtendedExpression(arguments[index + 1].Token) || arguments[index + 1].Token == "INTEGER") {
+      return nil, nil, NewNodeError(VALIDATION_ERROR, argument, fmt.Sprintf(
+        "The argument %s at %s isn't followed by a value. Stop.",
+        name,
+        formatPosition(argument.File, argument.Line, argument.Col),
+      ))
+    }
+    for _, previous := range named {
+      if previous.Name == name {
+        return nil, nil, NewNodeError(INVALID_ARGUMENT, argument, fmt.Sprintf(
+          "The argument %s at %s is passed more than once. Stop.",
+          name,
+          formatPosition(argument.File, argument.Line, argument.Col),
+        ))
+      }
+    }
+
+    named = append(named, namedArgument{Name: name, Value: arguments[index + 1]})
+    index += 1
+  }
+  return positional, named, nil
+}
+
+// The error for an argument passed by name to a parameter that doesn't exist.
+func unknownArgumentError(blockName string, argument namedArgument) error {
+  return NewNodeError(INVALID_ARGUMENT, argument.Value, fmt.Sprintf(
+    "%s doesn't have a parameter named %s, which is passed at %s. Stop.",
+    blockName,
+    argument.Name,
+    formatPosition(argument.Value.File, argument.Value.Line, argument.Value.Col),
+  ))
+}
+
+// Put the arguments to a builtin in the order of its inputs. Inputs that come before an input that
+// was passed by name, but which weren't passed themselves, are connected to 0.
+func orderBuiltinArguments(name string, invocation Node, arguments []Node) ([]Node, error) {
+  positional, named, err := splitNamedArguments(invocation, arguments)
+  if err != nil || len(named) == 0 {
+    return positional, err
+  }
+
+  ordered := positional
+  for _, argument := range named {
+    index := -1
+    for parameterIndex, parameterName := range BUILTIN_FUNCTION_PARAMETER_NAMES[name] {
+      if parameterName == argument.Name {
+        index = parameterIndex
+      }
+    }
+    if index == -1 {
+      return nil, unknownArgumentError(name, argument)
+    }
+    if index < len(positional) {
+      return nil, NewNodeError(INVALID_ARGUMENT, argument.Value, fmt.Sprintf(
+        "The argument %s at %s was already passed by position. Stop.",
+        argument.Name,
+        formatPosition(argument.Value.File, argument.Value.Line, argument.Value.Col),
+      ))
+    }
+
+    for len(ordered) <= index {
+      off := invocation
+      off.Token = "BOOL"
+      off.Data = &Bool{Value: false}
+      off.Children = nil
+      ordered = append(ordered, off)
+    }
+    ordered[index] = argument.Value
+  }
+  return ordered, nil
+}
+
+// An argument to a block, and the parameter of the block that it's passed to.
+type boundArgument struct {
+  Parameter blockParameter
+  Value Node
+}
+
+// Find the parameter of `block` that each argument passed by name is passed to, and add the default
+// value of each parameter that wasn't passed. `positionalWires` is the number of wires that were
+// passed by position, which are bound to the first parameters of the block.
+func bindNamedArguments(block *Block, invocation Node, named []namedArgument, positionalWires int) ([]boundArgument, error) {
+  parameters := blockParameters(block)
+  passed := map[string]bool{}
+
+  var bound []boundArgument
+  for _, argument := range named {
+    var parameter *blockParameter
+    for index := range parameters {
+      if parameters[index].Name == argument.Name {
+        parameter = &parameters[index]
+      }
+    }
+    if parameter == nil {
+      return nil, unknownArgumentError(block.Name, argument)
+    }
+    if parameter.Start < positionalWires {
+      return nil, NewNodeError(INVALID_ARGUMENT, argument.Value, fmt.Sprintf(
+        "The argument %s at %s was already passed by position. Stop.",
+        argument.Name,
+        formatPosition(argument.Value.File, argument.Value.Line, argument.Value.Col),
+      ))
+    }
+
+    passed[parameter.Name] = true
+    bound = append(bound, boundArgument{Parameter: *parameter, Value: argument.Value})
+  }
+
+  defaults := block.Declaration().Defaults
+  for _, parameter := range parameters {
+    if parameter.Start < positionalWires || passed[parameter.Name] {
+      continue
+    }
+
+    bits, ok := defaults[parameter.Name]
+    if !ok {
+      // Blocks that are only passed arguments by position can still be passed too few of them.
+      if len(named) == 0 {
+        continue
+      }
+      return nil, NewNodeError(ARITY_ERROR, invocation, fmt.Sprintf(
+        "The invocation at %s (trying to invoke %s) doesn't pass parameter %s, which doesn't have a default value. Stop.",
+        formatPosition(invocation.File, invocation.Line, invocation.Col),
+        block.Name,
+        parameter.Name,
+      ))
+    }
+
+    // A default of `0` or `1` is used for every wire of a bus.
+    if len(bits) == 1 && parameter.Width > 1 {
+      for len(bits) < parameter.Width {
+        bits = append(bits, bits[0])
+      }
+    }
+
+    value := invocation
+    value.Token = "LITERAL"
+    value.Data = &Literal{Width: len(bits), Bits: bits}
+    value.Children = nil
+    bound = append(bound, boundArgument{Parameter: parameter, Value: value})
+  }
+  return bound, nil
+}
+
+// Parse an argument to an invocation of `block`, and connect each wire that it outputs to the
+// parameters of the block from `start` onwards, through `BLOCK_INPUT` gates. `ct` is the index of
+// the argument. Returns the variables that the parameters are bound to within the invocation.
+func (c *Compiler) bindArgument(
+  block *Block,
+  invocation Node,
+  argument Node,
+  ct int,
+  start int,
+  stack []*StackFrame,
+) ([]*Gate, []*Wire, []*CallingContext, []*Variable, error) {
+  // Execute each parameter passed into the invocation to get an output wire to its result.
+  gates, wires, contexts, outputs, err := c.Parse(&[]Node{argument}, stack)
+
+  // Bubble errors up from the invocation
+  if err != nil {
+    return nil, nil, nil, nil, err
+  }
+
+  // But add each output from invoking into the variables slice to use to perform the actual
+  // invocation, joining through a special type of gate called "BLOCK_INPUT" to denote that
+  // we're entering a block.
+  params := strings.Fields(block.Declaration().Params)
+  var vars []*Variable
+  for _, output := range outputs {
+    index := start + len(vars)
+    if index >= len(params) {
+      return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, invocation, fmt.Sprintf(
+        "The invocation at %s (trying to invoke %s) is invoking the block with too many parameters (expected %d, received %d). Stop.\n",
+        formatPosition(invocation.File, invocation.Line, invocation.Col),
+        block.Name,
+        block.Declaration().InputQuantity,
+        len(*invocation.Children),
+      ))
+    }
+
+    // Create a wire to join between the block input node and the bound variable
+    c.wireId += 1
+    wire := &Wire{ Id: c.wireId }
+    wires = append(wires, wire)
+
+    // Create a new block input gate to express that we're entering a block.
+    c.gateId += 1
+    gates = append(gates, &Gate{
+      Id: c.gateId,
+      Type: BLOCK_INPUT,
+      Label: fmt.Sprintf("Input %d into block %s invocation %d", ct, block.Name, block.InvocationCount),
+      Inputs: []*Wire{output}, /* parameter => BLOCK_INPUT */
+      Outputs: []*Wire{wire}, /* BLOCK_INPUT => variable bound in local scope */
+
+      // The id of the new stack frame that is about to be created.
+      CallingContext: c.stackFrameId + 1,
+      Source: invocation.Span(),
+    })
+
+    vars = append(vars, &Variable{
+      Name: params[index],
+      Value: wire,
+    })
+  }
+  return gates, wires, contexts, vars, nil
+}
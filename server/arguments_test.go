@@ -0,0 +1,145 @@
+package main
+
+import (
+  "testing"
+  "reflect"
+  "strings"
+)
+
+func TestSplitParamDefaults(t *testing.T) {
+  params, defaults, err := splitParamDefaults("clock reset = 0 a[4]=4'd3 b")
+  if err != nil {
+    t.Errorf("Error returned! %s", err)
+    return
+  }
+  if params != "clock reset a[4] b" {
+    t.Errorf("Wrong params: %q", params)
+  }
+  if !reflect.DeepEqual(defaults, map[string][]bool{
+    "reset": []bool{false},
+    "a": []bool{true, true, false, false},
+  }) {
+    t.Errorf("Wrong defaults: %+v", defaults)
+  }
+
+  if _, _, err := splitParamDefaults("reset = 2"); err == nil || err.Error() != "The default value 2 of parameter reset isn't 0, 1, or a literal like 4'd0" {
+    t.Errorf("Wrong error: %v", err)
+  }
+}
+
+func TestNamedArguments(t *testing.T) {
+  states := ledStates(t, `
+    block mask(a b) {
+      return a and (not b)
+    }
+    led(mask(b: 0, a: 1))
+    led(mask(b: 1, a: 1))
+    led(mask(1, b: 0))
+  `)
+  if strings.Join(states, " ") != "on off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestDefaultArguments(t *testing.T) {
+  states := ledStates(t, `
+    block both(a b = 1) {
+      return a and b
+    }
+    block all(a[3] = 1) {
+      return a[0] and a[1] and a[2]
+    }
+    block low(a[2] = 2'b01) {
+      return a[0] and (not a[1])
+    }
+    led(both(1))
+    led(both(1 0))
+    led(both(b: 0, a: 1))
+    led(all())
+    led(low())
+  `)
+  if strings.Join(states, " ") != "on off off on on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestNamedBuiltinArguments(t *testing.T) {
+  // Inputs that aren't passed, like `set`, are connected to 0.
+  summary, err := RunString("let q = tflipflop(clock: 1, toggle: 1, reset: 0)\nled(input: q)", false)
+  if err != nil {
+    t.Errorf("Error returned! %s", err)
+    return
+  }
+  for _, gate := range summary.Gates {
+    if gate.Label == "tflipflop" && len(gate.Inputs) != 4 {
+      t.Errorf("Expected the tflipflop to have 4 inputs, found %d", len(gate.Inputs))
+    }
+  }
+}
+
+func TestArgumentErrors(t *testing.T) {
+  block := "block mask(a b) {\n  return a and (not b)\n}\n"
+  for _, test := range []struct{
+    Source string
+    Code ErrorCode
+    Error string
+  }{
+    {
+      block + "led(mask(a: 1, c: 0))",
+      INVALID_ARGUMENT,
+      "mask doesn't have a parameter named c, which is passed at 4:19. Stop.",
+    },
+    {
+      block + "led(mask(a: 1, a: 0))",
+      INVALID_ARGUMENT,
+      "The argument a at 4:16 is passed more than once. Stop.",
+    },
+    {
+      block + "led(mask(a: 1, 0))",
+      VALIDATION_ERROR,
+      "The argument at 4:16 is passed by position after an argument that was passed by name, in the invocation at 4:5. Stop.",
+    },
+    {
+      block + "led(mask(1, a: 0))",
+      INVALID_ARGUMENT,
+      "The argument a at 4:16 was already passed by position. Stop.",
+    },
+    {
+      block + "led(mask(b: 0))",
+      ARITY_ERROR,
+      "The invocation at 4:5 (trying to invoke mask) doesn't pass parameter a, which doesn't have a default value. Stop.",
+    },
+    {
+      block + "let bus[2] = 1 1\nled(mask(a: bus, b: 0))",
+      ARITY_ERROR,
+      "The argument passed to parameter a of block mask at 5:13 is 2 wires wide, but the parameter is 1 wires wide. Stop.",
+    },
+    {
+      block + "led(mask(a:))",
+      VALIDATION_ERROR,
+      "The argument a at 4:10 isn't followed by a value. Stop.",
+    },
+    {
+      "led(wave(enable: 1, speed: 2))",
+      INVALID_ARGUMENT,
+      "wave doesn't have a parameter named speed, which is passed at 1:28. Stop.",
+    },
+    {
+      "a: 1",
+      VALIDATION_ERROR,
+      "The argument a at 1:1 isn't within an invocation. Stop.",
+    },
+  } {
+    _, err := RunString(test.Source, false)
+    if err == nil {
+      t.Errorf("Compiling %q didn't return an error", test.Source)
+      continue
+    }
+    if err.Error() != test.Error {
+      t.Errorf("Compiling %q returned the wrong error: %q", test.Source, err.Error())
+    }
+    if compileErr, ok := err.(*CompileError); !ok || compileErr.Code != test.Code {
+      t.Errorf("Compiling %q returned the wrong code: %+v", test.Source, err)
+    }
+  }
+}
@@ -0,0 +1,204 @@
+package main
+
+// The data that the tokenizer attaches to each node, which depends on the node's token. Tokens that
+// only mark structure, like `GROUP`, `BLOCK_END`, `BLOCK_RETURN`, and `GENERATE_ELSE`, have no data.
+//
+// Data is always stored as a pointer, so copies of a node share its data (the tokenizer relies on
+// this to fill in the operands of operators and the outputs of blocks after the node was created).
+// Use `copyData` when a node's data needs to be changed without changing the original.
+type NodeData interface {
+  copyData() NodeData
+}
+
+// A `MULTI_COMMENT` or `SINGLE_COMMENT`.
+type Comment struct {
+  Message string
+}
+
+// An operator with two operands, like `a and b`. Operands that haven't been tokenized yet are nil.
+type BinaryExpr struct {
+  LeftHandSide *Node
+  RightHandSide *Node
+}
+
+// An operator with a single operand, like `not a`. The operand is nil until it's tokenized.
+type UnaryExpr struct {
+  RightHandSide *Node
+}
+
+// A `for i in 0..N {` generate construct. The start and end are expressions that can refer to the
+// constants of a block, so they're evaluated when the block is invoked.
+type ForLoop struct {
+  Variable string
+  Start string
+  End string
+}
+
+// An `if N == 0 {` generate construct.
+type IfBranch struct {
+  Condition string
+}
+
+// An invocation of a block or builtin, like `adder<8>(a b)`. The arguments are the children of the
+// node.
+type Invocation struct {
+  Name string
+  // The constants passed to the block, space seperated.
+  Constants string `json:",omitempty"`
+}
+
+// The declaration of a block, like `block adder<N>(a[N] b[N] carry = 0) {`.
+type BlockDecl struct {
+  Name string
+  // The names of the block's constants, space seperated.
+  Constants string `json:",omitempty"`
+  // The name of each wire that's passed into the block, space seperated. Each bus parameter is
+  // expanded into a parameter for each of its wires (ie, `b[2]` becomes `b0 b1`). Blocks with
+  // constants keep their parameters as written until they're invoked. See `instantiateBlock`.
+  Params string
+  // The width of each parameter that was expanded from a bus.
+  Buses map[string]int
+  // The value of each parameter that has a default, by the name of the parameter.
+  Defaults map[string][]bool `json:",omitempty"`
+  InputQuantity int
+  OutputQuantity int
+}
+
+// An `import` that hasn't been resolved yet.
+type Import struct {
+  Path string
+}
+
+// The blocks imported with a namespace, like `import adder as arith`. See `newModule`.
+type ModuleDecl struct {
+  Name string
+}
+
+// The start of an assignment, like `let a b[4] = `.
+type Assignment struct {
+  // The names that are assigned to, space seperated. Each name can declare a bus, like `b[4]`.
+  Names string
+}
+
+// The name of the parameter that the next argument is passed to, like `reset:`.
+type ArgumentName struct {
+  Name string
+}
+
+// A wire within a bus, like `a[2]`, or a slice of a bus, like `a[0:4]`. The end is exclusive. An
+// index that refers to the constants of a block, like `a[N-1]`, is kept as an expression until the
+// block is invoked. Once an index is known, its expression is empty.
+type BusIndex struct {
+  Name string
+  Start int
+  End int
+  StartExpression string `json:",omitempty"`
+  EndExpression string `json:",omitempty"`
+}
+
+// Are both ends of the index known?
+func (b BusIndex) IsResolved() bool {
+  return len(b.StartExpression) == 0 && len(b.EndExpression) == 0
+}
+
+type Identifier struct {
+  Value string
+}
+
+type Integer struct {
+  Value int
+}
+
+type Bool struct {
+  Value bool
+}
+
+// A group of constant wires, like `4'd3`. The bits are stored least significant bit first.
+type Literal struct {
+  Width int
+  Bits []bool
+}
+
+// A test of a block, like `test "halfadder truth table" halfadder { 0 1 -> 1 0 }`. See
+// `vectors.go`.
+type TestDecl struct {
+  Name string
+  // The name of the block that is tested, which can include its constants, like `adder<4>`.
+  Block string
+  Vectors []Vector
+}
+
+// A block that is defined by its truth table, like `table majority(a b c) -> (out) { 011 -> 1 }`,
+// or by a csv file, like `table majority(a b c) -> (out) from "majority.csv"`. Tables are replaced
+// with a block when they're tokenized. See `table.go`.
+type TableDecl struct {
+  Name string
+  Inputs []string
+  Outputs []string
+  Vectors []Vector `json:",omitempty"`
+  Path string `json:",omitempty"`
+}
+
+func (d *Comment) copyData() NodeData { copied := *d; return &copied }
+func (d *BinaryExpr) copyData() NodeData { copied := *d; return &copied }
+func (d *UnaryExpr) copyData() NodeData { copied := *d; return &copied }
+func (d *ForLoop) copyData() NodeData { copied := *d; return &copied }
+func (d *IfBranch) copyData() NodeData { copied := *d; return &copied }
+func (d *Invocation) copyData() NodeData { copied := *d; return &copied }
+func (d *BlockDecl) copyData() NodeData { copied := *d; return &copied }
+func (d *Import) copyData() NodeData { copied := *d; return &copied }
+func (d *ModuleDecl) copyData() NodeData { copied := *d; return &copied }
+func (d *Assignment) copyData() NodeData { copied := *d; return &copied }
+func (d *ArgumentName) copyData() NodeData { copied := *d; return &copied }
+func (d *BusIndex) copyData() NodeData { copied := *d; return &copied }
+func (d *Identifier) copyData() NodeData { copied := *d; return &copied }
+func (d *Integer) copyData() NodeData { copied := *d; return &copied }
+func (d *Bool) copyData() NodeData { copied := *d; return &copied }
+func (d *Literal) copyData() NodeData { copied := *d; return &copied }
+func (d *TestDecl) copyData() NodeData { copied := *d; return &copied }
+func (d *TableDecl) copyData() NodeData { copied := *d; return &copied }
+
+// The left and right hand side of an operator. Either is nil if the node isn't an operator, or if
+// the operand is missing.
+func (n Node) Operands() (*Node, *Node) {
+  switch data := n.Data.(type) {
+  case *BinaryExpr:
+    return data.LeftHandSide, data.RightHandSide
+  case *UnaryExpr:
+    return nil, data.RightHandSide
+  }
+  return nil, nil
+}
+
+// Set the right hand side of an operator.
+func (n Node) setRightHandSide(operand *Node) {
+  switch data := n.Data.(type) {
+  case *BinaryExpr:
+    data.RightHandSide = operand
+  case *UnaryExpr:
+    data.RightHandSide = operand
+  }
+}
+
+// Evaluate each end of the index that is still an expression. Ends that can't be evaluated are
+// left as expressions, and the first error is returned.
+func (b *BusIndex) resolve(constants map[string]int) error {
+  var firstErr error
+  for _, end := range []struct{ value *int; expression *string }{
+    {&b.Start, &b.StartExpression},
+    {&b.End, &b.EndExpression},
+  } {
+    if len(*end.expression) == 0 {
+      continue
+    }
+    value, err := evaluateConstant(*end.expression, constants)
+    if err != nil {
+      if firstErr == nil {
+        firstErr = err
+      }
+      continue
+    }
+    *end.value, *end.expression = value, ""
+  }
+  return firstErr
+}
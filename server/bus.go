@@ -0,0 +1,224 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "math/big"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// A bus is a group of wires that share a name. Each wire in a bus is stored as its own variable,
+// named after the bus and the index of the wire, so the wires in `let a[4] = ...` are the variables
+// `a0`, `a1`, `a2`, and `a3`. The bus itself records how wide it is, so that `a` can refer to all of
+// its wires at once, and so that indexes can be checked.
+type Bus struct {
+  Name string
+  Width int
+}
+
+// The widest that a bus can be. Every wire in a bus is its own variable, so a much wider bus (ie,
+// from a typo like `a[80000000]`) would take the compiler forever to declare.
+const MAX_BUS_WIDTH = 4096
+
+// Matches a name that declares a bus, like `a[4]`.
+var MATCH_BUS_DECLARATION *regexp.Regexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\[(\d+)\]$`)
+
+// Split a name that declares a bus, like `a[4]`, into the name and width of the bus. Returns false
+// if the name doesn't declare a bus.
+func parseBusDeclaration(name string) (string, int, bool) {
+  match := MATCH_BUS_DECLARATION.FindStringSubmatch(name)
+  if match == nil {
+    return "", 0, false
+  }
+
+  width, err := strconv.Atoi(match[2])
+  if err != nil {
+    return "", 0, false
+  }
+  return match[1], width, true
+}
+
+// Ensure that a bus isn't wider than `MAX_BUS_WIDTH`.
+func checkBusWidth(name string, width int) error {
+  if width > MAX_BUS_WIDTH {
+    return errors.New(fmt.Sprintf("Bus %s is %d wires wide, but buses can be at most %d wires wide", name, width, MAX_BUS_WIDTH))
+  }
+  return nil
+}
+
+// The name of the variable that holds the wire at `index` within a bus.
+func busWireName(bus string, index int) string {
+  return fmt.Sprintf("%s%d", bus, index)
+}
+
+// Expand each bus declared in `names` into the names of the variables that hold its wires. For
+// example, `a b[2] c` becomes `a b0 b1 c`, and declares the bus `b`.
+func expandBusDeclarations(names []string) ([]string, []*Bus, error) {
+  var expanded []string
+  var buses []*Bus
+  for _, name := range names {
+    name, err := substituteBusWidths(name, nil)
+    if err != nil {
+      return nil, nil, err
+    }
+
+    if busName, width, ok := parseBusDeclaration(name); ok {
+      if err := checkBusWidth(busName, width); err != nil {
+        return nil, nil, err
+      }
+      for index := 0; index < width; index++ {
+        expanded = append(expanded, busWireName(busName, index))
+      }
+      buses = append(buses, &Bus{Name: busName, Width: width})
+    } else {
+      expanded = append(expanded, name)
+    }
+  }
+  return expanded, buses, nil
+}
+
+// Matches a literal, like `4'b0011`.
+var MATCH_LITERAL *regexp.Regexp = regexp.MustCompile(`^([0-9]+)'([bdhBDH])([0-9A-Fa-f_]+)`)
+
+// The bases that a literal can be written in.
+var LITERAL_BASES map[string]int = map[string]int{"b": 2, "d": 10, "h": 16}
+
+// Convert a literal like `4'b0011` into the state of each of its wires. Like the rest of the
+// standard library, the least significant bit comes first, so `4'b0011` is `1 1 0 0`.
+func parseLiteral(literal string, width string, base string, digits string) ([]bool, error) {
+  bitCount, err := strconv.Atoi(width)
+  if err != nil || bitCount < 1 {
+    return nil, errors.New(fmt.Sprintf("Literal %s must be at least one bit wide", literal))
+  }
+  if bitCount > MAX_BUS_WIDTH {
+    return nil, errors.New(fmt.Sprintf("Literal %s is wider than %d bits", literal, MAX_BUS_WIDTH))
+  }
+
+  value, ok := new(big.Int).SetString(strings.Replace(digits, "_", "", -1), LITERAL_BASES[strings.ToLower(base)])
+  if !ok {
+    return nil, errors.New(fmt.Sprintf("Literal %s contains digits that aren't valid in its base", literal))
+  }
+  if value.BitLen() > bitCount {
+    return nil, errors.New(fmt.Sprintf("Literal %s doesn't fit in %d bits", literal, bitCount))
+  }
+
+  bits := make([]bool, bitCount)
+  for index := range bits {
+    bits[index] = value.Bit(index) == 1
+  }
+  return bits, nil
+}
+
+// Find the bus that a name refers to, looking through the stack from top to bottom. A variable with
+// the same name in a higher stack frame hides the bus.
+func findBus(stack []*StackFrame, name string) *Bus {
+  for i := len(stack) - 1; i >= 0; i-- {
+    for _, variable := range stack[i].Variables {
+      if variable.Name == name {
+        return nil
+      }
+    }
+
+    // Later declarations of a bus replace earlier ones.
+    for j := len(stack[i].Buses) - 1; j >= 0; j-- {
+      if stack[i].Buses[j].Name == name {
+        return stack[i].Buses[j]
+      }
+    }
+  }
+  return nil
+}
+
+// The width of the bus that a node refers to, or false if the node doesn't refer to a bus. A single
+// wire within a bus (ie, `a[2]`) is not a bus.
+func nodeBusWidth(node Node, stack []*StackFrame) (int, bool) {
+  switch data := node.Data.(type) {
+  case *Identifier:
+    if bus := findBus(stack, data.Value); bus != nil {
+      return bus.Width, true
+    }
+  case *BusIndex:
+    if width := data.End - data.Start; width > 1 {
+      return width, true
+    }
+  case *Literal:
+    if width := data.Width; width > 1 {
+      return width, true
+    }
+  }
+  return 0, false
+}
+
+// A parameter of a block, and the index of its first wire within all of the block's parameters.
+type blockParameter struct {
+  Name string
+  Start int
+  Width int
+  IsBus bool
+}
+
+// Group the parameters of a block back into the buses that they were declared as.
+func blockParameters(block *Block) []blockParameter {
+  buses := block.Declaration().Buses
+
+  var parameters []blockParameter
+  params := strings.Fields(block.Declaration().Params)
+  for index := 0; index < len(params); {
+    parameter := blockParameter{Name: params[index], Start: index, Width: 1}
+
+    // A bus parameter is a run of parameters named after the bus, starting from 0.
+    for name, width := range buses {
+      if params[index] == busWireName(name, 0) && index + width <= len(params) && params[index + width - 1] == busWireName(name, width - 1) {
+        parameter = blockParameter{Name: name, Start: index, Width: width, IsBus: true}
+        break
+      }
+    }
+
+    parameters = append(parameters, parameter)
+    index += parameter.Width
+  }
+  return parameters
+}
+
+// The buses that a block's parameters declare, which are in scope within the block.
+func blockBuses(block *Block) []*Bus {
+  var buses []*Bus
+  for _, parameter := range blockParameters(block) {
+    if parameter.IsBus {
+      buses = append(buses, &Bus{Name: parameter.Name, Width: parameter.Width})
+    }
+  }
+  return buses
+}
+
+// Ensure that a bus passed as an argument to a block lines up with a bus parameter of the same
+// width. `start` is the index of the first wire of the argument within all of the block's
+// parameters.
+func checkBusArgument(block *Block, argument Node, start int, width int) error {
+  for _, parameter := range blockParameters(block) {
+    if parameter.Start != start {
+      continue
+    }
+
+    if !parameter.IsBus || parameter.Width != width {
+      return NewNodeError(ARITY_ERROR, argument, fmt.Sprintf(
+        "The %d bit bus passed to block %s at %s doesn't match the width of parameter %s (%d bits). Stop.",
+        width,
+        block.Name,
+        formatPosition(argument.File, argument.Line, argument.Col),
+        parameter.Name,
+        parameter.Width,
+      ))
+    }
+    return nil
+  }
+
+  return NewNodeError(ARITY_ERROR, argument, fmt.Sprintf(
+    "The %d bit bus passed to block %s at %s doesn't line up with the start of a parameter. Stop.",
+    width,
+    block.Name,
+    formatPosition(argument.File, argument.Line, argument.Col),
+  ))
+}
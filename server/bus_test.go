@@ -0,0 +1,157 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "strings"
+)
+
+// Compile and run a program, and return the state of each led in order.
+func ledStates(t *testing.T, source string) []string {
+  summary, err := RunString(source, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return nil
+  }
+
+  gates, _ := Execute(summary.Gates, summary.Wires)
+  var states []string
+  for _, gate := range gates {
+    if gate.Label == "led" {
+      states = append(states, gate.State)
+    }
+  }
+  return states
+}
+
+func TestBusIndex(t *testing.T) {
+  states := ledStates(t, "let bus[4] = 1 0 0 1\nled(bus[0])\nled(bus[1])\nled(bus[3])")
+  if strings.Join(states, " ") != "on off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestBusSlice(t *testing.T) {
+  // A slice includes its start, but not its end.
+  states := ledStates(t, `
+    block first(a[2]) {
+      return a[0]
+    }
+    block second(a[2]) {
+      return a[1]
+    }
+    let bus[4] = 1 0 0 1
+    led(first(bus[2:4]))
+    led(second(bus[2:4]))
+  `)
+  if strings.Join(states, " ") != "off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestBusConcatenation(t *testing.T) {
+  states := ledStates(t, "let lo[2] = 1 0\nlet hi[2] = 0 1\nlet bus[4] = lo hi\nled(bus[0])\nled(bus[2])\nled(bus[3])")
+  if strings.Join(states, " ") != "on off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestBusPassedToAndReturnedFromBlock(t *testing.T) {
+  states := ledStates(t, `
+    block invert(a[2]) {
+      let out[2] = (not a[0]) (not a[1])
+      return out
+    }
+    let bus[2] = 1 0
+    let inverted[2] = invert(bus)
+    led(inverted[0])
+    led(inverted[1])
+  `)
+  if strings.Join(states, " ") != "off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestBusParametersCanStillBeWrittenBitByBit(t *testing.T) {
+  states := ledStates(t, `
+    block both(a[2]) {
+      return a0 and a[1]
+    }
+    led(both(1 1))
+  `)
+  if strings.Join(states, " ") != "on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestBusErrors(t *testing.T) {
+  for _, test := range []struct{
+    Source string
+    Error string
+  }{
+    {
+      "let bus[2] = 1 0\nled(bus[2])",
+      "The index at 2:5 is past the end of bus bus, which is 2 bits wide. Stop.",
+    },
+    {
+      "let a[3] = 1 0 1\nlet bus[2] = a",
+      "Assignment at 2:1 assigns 3 wires to 2 wires on the left hand side. Stop.",
+    },
+    {
+      "block a(x[2] y) {\n  return y\n}\nlet bus[4] = 1 0 1 0\nled(a(bus))",
+      "The 4 bit bus passed to block a at 5:7 doesn't match the width of parameter x (2 bits). Stop.",
+    },
+    {
+      "block a(x y[2]) {\n  return x\n}\nlet bus[2] = 1 0\nled(a(bus 1))",
+      "The 2 bit bus passed to block a at 5:7 doesn't match the width of parameter x (1 bits). Stop.",
+    },
+    {
+      "block a(x[2]) {\n  return x\n}\nled(a(1))",
+      "The invocation at 4:5 (trying to invoke a) is invoking the block with too few parameters (expected 2, received 1). Stop.\n",
+    },
+  } {
+    _, err := RunString(test.Source, false)
+    if err == nil {
+      t.Errorf("Compiling %q didn't return an error", test.Source)
+      continue
+    }
+    if err.Error() != test.Error {
+      t.Errorf("Compiling %q returned the wrong error: %q", test.Source, err.Error())
+    }
+    if compileErr, ok := err.(*CompileError); !ok || compileErr.Code != ARITY_ERROR {
+      t.Errorf("Compiling %q didn't return an arity error: %+v", test.Source, err)
+    }
+  }
+}
+
+func TestLiteral(t *testing.T) {
+  states := ledStates(t, "let bus[4] = 4'b0110\nled(bus[0])\nled(bus[1])\nled(bus[2])\nled(bus[3])")
+  if strings.Join(states, " ") != "off on on off" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestLiteralPassedToBusParameter(t *testing.T) {
+  states := ledStates(t, `
+    block equal(a[4] b[4]) {
+      return (a[0] xnor b[0]) and (a[1] xnor b[1]) and (a[2] xnor b[2]) and (a[3] xnor b[3])
+    }
+    led(equal(1 1 0 0 4'd3))
+    led(equal(1 1 0 0 4'hC))
+  `)
+  if strings.Join(states, " ") != "on off" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+
+  _, err := RunString("block first(a[4]) {\n  return a[0]\n}\nled(first(8'd3))", false)
+  if err == nil || err.Error() != "The 8 bit bus passed to block first at 4:11 doesn't match the width of parameter a (4 bits). Stop." {
+    t.Errorf("Wrong error: %v", err)
+  }
+}
+
+func TestBusWidthLimit(t *testing.T) {
+  _, err := RunString("let w[100000000] = 0", false)
+  if err == nil || err.Error() != "Error: Bus w is 100000000 wires wide, but buses can be at most 4096 wires wide, in the assignment at 1:1. Stop." {
+    t.Errorf("Wrong error: %v", err)
+  }
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+  "fmt"
+  "flag"
+  "os"
+  "strings"
+)
+
+func Equiv() {
+  equivFlags := flag.NewFlagSet("equiv", flag.ExitOnError)
+  equivVerbose := equivFlags.Bool("verbose", false, "Print debug information")
+  equivMaxCallDepth := equivFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+  equivFlags.Usage = func() { help("equiv") }
+  equivFlags.Parse(os.Args[2:])
+
+  if equivFlags.NArg() != 2 {
+    fmt.Println("Two blocks must be passed to equiv, like a.bit:halfadder b.bit:halfadder2. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  harnesses := []*BlockHarness{}
+  for _, argument := range equivFlags.Args() {
+    // The block is after the last colon, since block names can't contain one.
+    separator := strings.LastIndex(argument, ":")
+    if separator == -1 {
+      fmt.Printf("%s isn't a file and a block, like a.bit:halfadder. Stop.\n", argument)
+      os.Exit(2)
+      return
+    }
+
+    compiler := NewCompiler()
+    compiler.Verbose = *equivVerbose
+
+    // Set max call depth if a value was specified.
+    if *equivMaxCallDepth != -1 {
+      compiler.MaxRecursionDepth = *equivMaxCallDepth
+    }
+
+    harness, err := compiler.HarnessFile(argument[:separator], argument[separator+1:])
+    if err != nil {
+      fmt.Println(err);
+      os.Exit(2)
+      return
+    }
+    compiler.PrintWarnings()
+    harnesses = append(harnesses, harness)
+  }
+  left, right := harnesses[0], harnesses[1]
+
+  result, err := CheckEquivalence(left, right)
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+
+  if result.Equivalent {
+    fmt.Printf("%s and %s are equivalent.\n", equivFlags.Arg(0), equivFlags.Arg(1))
+    return
+  }
+
+  fmt.Printf("%s and %s are not equivalent. They differ when:\n", equivFlags.Arg(0), equivFlags.Arg(1))
+  for index, name := range result.Inputs {
+    fmt.Printf("  %s = %s\n", name, formatStates([]bool{result.Counterexample[index]}))
+  }
+  fmt.Println()
+  fmt.Printf("%s -> %s (%s)\n", formatStates(result.Counterexample), formatStates(result.LeftOutputs), left.Name)
+  fmt.Printf("%s -> %s (%s)\n", formatStates(result.Counterexample), formatStates(result.RightOutputs), right.Name)
+  os.Exit(1)
+}
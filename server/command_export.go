@@ -0,0 +1,71 @@
+package main
+
+import (
+  "fmt"
+  "flag"
+  "os"
+  "strings"
+  "path/filepath"
+)
+
+func Export() {
+  exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+  exportVerbose := exportFlags.Bool("verbose", false, "Print debug information")
+  exportMaxCallDepth := exportFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+  exportOptimize := exportFlags.Bool("optimize", false, "Optimize the compiled gates")
+  exportMerge := exportFlags.Bool("merge", false, "Merge chains of gates into gates with many inputs")
+  exportFormat := exportFlags.String("format", "verilog", "The format to export to")
+  exportModule := exportFlags.String("module", "", "The name of the top level module")
+  exportHierarchical := exportFlags.Bool("hierarchical", false, "Export each block invocation as a submodule")
+  exportFlags.Usage = func() { help("export") }
+  exportFlags.Parse(os.Args[2:])
+
+  // Flags can also come after the file, like `lovel export foo.bit --hierarchical`.
+  if exportFlags.NArg() < 1 {
+    fmt.Println("No file path was passed to export. Stop.")
+    os.Exit(2)
+    return
+  }
+  filePath := exportFlags.Arg(0)
+  exportFlags.Parse(exportFlags.Args()[1:])
+  if exportFlags.NArg() > 0 {
+    fmt.Println("Only one file can be passed to export. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  compiler := NewCompiler()
+  compiler.Verbose = *exportVerbose
+  compiler.Optimize = *exportOptimize
+  compiler.MergeGates = *exportMerge
+
+  // Set max call depth if a value was specified.
+  if *exportMaxCallDepth != -1 {
+    compiler.MaxRecursionDepth = *exportMaxCallDepth
+  }
+
+  summary, err := compiler.RunFile(filePath)
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+  compiler.PrintWarnings()
+  compiler.PrintOptimizations()
+
+  switch *exportFormat {
+  case "verilog":
+    // By default, name the module after the file that is being exported.
+    moduleName := *exportModule
+    if len(moduleName) == 0 {
+      moduleName = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+    }
+
+    fmt.Print(ExportVerilog(summary, moduleName, *exportHierarchical))
+
+  default:
+    fmt.Printf("Error: no such export format %s found. Stop.\n", *exportFormat)
+    os.Exit(2)
+    return
+  }
+}
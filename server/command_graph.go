@@ -0,0 +1,52 @@
+package main
+
+import (
+  "fmt"
+  "flag"
+  "os"
+)
+
+func Graph() {
+  graphFlags := flag.NewFlagSet("graph", flag.ExitOnError)
+  graphVerbose := graphFlags.Bool("verbose", false, "Print debug information")
+  graphMaxCallDepth := graphFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+  graphOptimize := graphFlags.Bool("optimize", false, "Optimize the compiled gates")
+  graphMerge := graphFlags.Bool("merge", false, "Merge chains of gates into gates with many inputs")
+  graphFlags.Usage = func() { help("graph") }
+  graphFlags.Parse(os.Args[2:])
+
+  // Flags can also come after the file, like `lovel graph foo.bit --optimize`.
+  if graphFlags.NArg() < 1 {
+    fmt.Println("No file path was passed to graph. Stop.")
+    os.Exit(2)
+    return
+  }
+  filePath := graphFlags.Arg(0)
+  graphFlags.Parse(graphFlags.Args()[1:])
+  if graphFlags.NArg() > 0 {
+    fmt.Println("Only one file can be passed to graph. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  compiler := NewCompiler()
+  compiler.Verbose = *graphVerbose
+  compiler.Optimize = *graphOptimize
+  compiler.MergeGates = *graphMerge
+
+  // Set max call depth if a value was specified.
+  if *graphMaxCallDepth != -1 {
+    compiler.MaxRecursionDepth = *graphMaxCallDepth
+  }
+
+  summary, err := compiler.RunFile(filePath)
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+  compiler.PrintWarnings()
+  compiler.PrintOptimizations()
+
+  fmt.Print(ExportGraphviz(summary))
+}
@@ -6,6 +6,7 @@ import (
   "os"
   "encoding/json"
   "time"
+  "sync"
 
   // Required to run the server
   "net/http"
@@ -42,6 +43,7 @@ func Run() {
   runVerbose := runFlags.Bool("verbose", false, "Print debug information")
   runMaxCallDepth := runFlags.Int("max-call-depth", -1, "Set the maximum call depth")
   runPort := runFlags.Int("port", 8080, "")
+  runTickInterval := runFlags.Duration("tick-interval", 500 * time.Millisecond, "How often to advance clock sources")
 
   runFlags.Usage = func() { help("run") }
   runFlags.Parse(os.Args[2:])
@@ -56,9 +58,16 @@ func Run() {
 
   filePath := runFlags.Args()[0]
 
-  // Set max call depth if a value was specified.
-  if *runMaxCallDepth != -1 {
-    INVOCATION_MAX_RECURSION_DEPTH = *runMaxCallDepth
+  // Every compile of the file uses a new compiler so that ids start from 1 each time.
+  newCompiler := func() *Compiler {
+    compiler := NewCompiler()
+    compiler.Verbose = *runVerbose
+
+    // Set max call depth if a value was specified.
+    if *runMaxCallDepth != -1 {
+      compiler.MaxRecursionDepth = *runMaxCallDepth
+    }
+    return compiler
   }
 
   fmt.Println("Starting lovelace server...")
@@ -73,23 +82,85 @@ func Run() {
   }
   var lastPayload []byte = nil
 
-  summary, err := RunFile(runFlags.Args()[0], *runVerbose)
-  if err != nil {
-    lastPayload, err = json.Marshal(map[string]string{"Error": err.Error()})
-    if err != nil {
-      fmt.Println("Error serializing error payload: %s. Stop.", err);
-      os.Exit(2)
-      return
+  // The program is simulated on the server, so that clients can send input events over the
+  // websocket and receive only the gates and wires that changed in response.
+  session := NewSession()
+
+  // Guards `connections`, `lastPayload`, and `session`, which are used by every websocket client
+  // and the file watcher.
+  var mutex sync.Mutex
+
+  // Send a payload to every websocket client. Must be called while holding `mutex`.
+  broadcast := func(payload []byte) {
+    var openConnections []*websocket.Conn
+    for index, conn := range connections {
+      err := conn.WriteMessage(websocket.TextMessage, payload)
+      if err != nil {
+        fmt.Printf("Error sending payload to websocket client %d: %s.\n", index, err)
+
+        // Close the connection. The client is smart enough to reconnect when this happens.
+        conn.Close()
+        continue
+      }
+      openConnections = append(openConnections, conn)
+    }
+    connections = openConnections
+  }
+
+  // Watches the file and every file that it imports, so that the file is recompiled when any of them
+  // change. What the file imports can change with each compile, so imports are watched as they're
+  // found.
+  fileWatcher := watcher.New()
+  fileWatcher.SetMaxEvents(1)
+  watched := map[string]bool{}
+
+  // Compile the file, and load it into the session. Returns the payload to send to clients, and any
+  // error that occured while compiling. Must be called while holding `mutex`.
+  compile := func() ([]byte, error) {
+    compiler := newCompiler()
+    summary, compileErr := compiler.RunFile(filePath)
+
+    for _, file := range compiler.Files {
+      if watched[file] {
+        continue
+      }
+      if err := fileWatcher.Add(file); err != nil {
+        fmt.Printf("Error watching imported file %s: %s.\n", file, err)
+        continue
+      }
+      watched[file] = true
+    }
+
+    var payload []byte
+    var err error
+    if compileErr == nil {
+      // The ast was compiled successfully.
+      session.Load(summary)
+      compiler.PrintWarnings()
+
+      // Point out any wires that nothing drives, since they are usually a mistake.
+      for _, wire := range UndrivenWires(summary) {
+        fmt.Printf(
+          "Warning: wire %d (%s) declared at %s is never driven, so it's always off.\n",
+          wire.Id,
+          wire.Expression,
+          formatSpan(wire.Source),
+        )
+      }
+      payload, err = json.Marshal(summary)
+    } else {
+      // An error occured.
+      payload, err = json.Marshal(ErrorPayload(compileErr))
     }
-  } else {
-    lastPayload, err = json.Marshal(summary)
     if err != nil {
-      fmt.Println("Error serializing result: %s. Stop.", err);
-      os.Exit(2)
-      return
+      fmt.Printf("Error serializing payload: %s.\n", err)
     }
+
+    return payload, compileErr
   }
 
+  lastPayload, _ = compile()
+
   fmt.Println("Initial compile was successful. Watching...")
 
   // On the first thread, accept websocket requests and http requests to run the ast that was sent
@@ -101,6 +172,7 @@ func Run() {
       return
     }
 
+    mutex.Lock()
     if lastPayload != nil {
       err = conn.WriteMessage(websocket.TextMessage, lastPayload)
       if err != nil {
@@ -110,8 +182,55 @@ func Run() {
 
     // Add the connection to the group of collections.
     connections = append(connections, conn)
+    mutex.Unlock()
 
     fmt.Println("Client subscribed")
+
+    // Read input events from the client until it disconnects. Each event is applied to the session,
+    // and whatever changed is sent to every client as a `{"Diff": ...}` payload.
+    for {
+      _, message, err := conn.ReadMessage()
+      if err != nil {
+        break
+      }
+
+      // Every write to a connection happens while holding `mutex`, since `broadcast` writes to this
+      // connection from other goroutines, and a websocket can't be written to concurrently.
+      mutex.Lock()
+      var event SessionEvent
+      if err := json.Unmarshal(message, &event); err != nil {
+        conn.WriteJSON(map[string]string{"EventError": fmt.Sprintf("Error parsing event: %s", err)})
+        mutex.Unlock()
+        continue
+      }
+
+      diff, err := session.Apply(event)
+      if err != nil {
+        conn.WriteJSON(map[string]string{"EventError": err.Error()})
+      }
+      if diff != nil && (len(diff.Gates) > 0 || len(diff.Wires) > 0) {
+        payload, err := json.Marshal(map[string]interface{}{"Diff": diff})
+        if err != nil {
+          fmt.Printf("Error serializing diff: %s.\n", err)
+        } else {
+          broadcast(payload)
+        }
+      }
+      mutex.Unlock()
+    }
+
+    // Stop sending payloads to the client as soon as it disconnects.
+    mutex.Lock()
+    for index, open := range connections {
+      if open == conn {
+        connections = append(connections[:index], connections[index+1:]...)
+        break
+      }
+    }
+    mutex.Unlock()
+    conn.Close()
+
+    fmt.Println("Client unsubscribed")
   })
 
   http.HandleFunc("/v1/run", func(w http.ResponseWriter, r *http.Request) {
@@ -124,21 +243,31 @@ func Run() {
     var body struct {
       Gates []*Gate
       Wires []*Wire
+
+      // The number of ticks to advance clock sources (ie, `wave`) by once the circuit is stable.
+      Ticks int
     }
     decoder.Decode(&body)
 
-    gates, wires := Execute(body.Gates, body.Wires)
+    // Ticking is done while the request waits, so a single request can't tick forever.
+    if body.Ticks < 0 || body.Ticks > MAX_SESSION_TICKS {
+      http.Error(w, fmt.Sprintf("Ticks must be between 0 and %d", MAX_SESSION_TICKS), http.StatusBadRequest)
+      return
+    }
 
-    json.NewEncoder(w).Encode(map[string]interface{}{"Gates": gates, "Wires": wires})
+    simulation := NewSimulation(body.Gates, body.Wires)
+    simulation.Settle()
+    for i := 0; i < body.Ticks; i++ {
+      simulation.Tick()
+    }
+
+    json.NewEncoder(w).Encode(map[string]interface{}{"Gates": body.Gates, "Wires": body.Wires})
   })
 
   // In a second thread, watch for file changes. If a file changes, rebuild it.
   go func() {
-    watcher := watcher.New()
-    watcher.SetMaxEvents(1)
-
     fmt.Printf("Watching %s\n", filePath)
-    if err := watcher.Add(filePath); err != nil {
+    if err := fileWatcher.Add(filePath); err != nil {
       fmt.Printf("Error watching source file %s: %s. Stop.\n", filePath, err)
       os.Exit(2)
       return
@@ -147,14 +276,15 @@ func Run() {
     go func() {
       for {
         select {
-        case event := <-watcher.Event:
+        case event := <-fileWatcher.Event:
           if *runVerbose {
             fmt.Printf("Event: %s\n", event)
           }
 
           // Compile the source
           fmt.Printf("Compiling %s ... ", filePath)
-          summary, err := RunFile(filePath, *runVerbose)
+          mutex.Lock()
+          payload, err := compile()
 
           // Print any errors received in the compilation process
           if err != nil {
@@ -163,54 +293,55 @@ func Run() {
             fmt.Printf("OK\n")
           }
 
-          var payload []byte
-          if err == nil {
-            // The ast was compiled successfully.
-            payload, err = json.Marshal(summary)
-            if err != nil {
-              fmt.Printf("Error serializing ast: %s.\n", err)
-            }
-          } else {
-            // An error occured.
-            payload, err = json.Marshal(map[string]string{ "Error": err.Error() })
-            if err != nil {
-              fmt.Printf("Error serializing error: %s.\n", err)
-            }
-          }
-
           // Then, send the ast over the websocket.
-          for index, conn := range connections {
-            err = conn.WriteMessage(websocket.TextMessage, payload)
-            if err != nil {
-              fmt.Printf("Error sending payload to websocket client %d: %s.\n", index, err)
-
-              // Close the connection. The client is smart enough to reconnect when this happens.
-              conn.Close()
-              connections = append(connections[:index], connections[index+1:]...)
-            }
-          }
+          broadcast(payload)
 
           // Save the last push. Any new clients will receive this push in order for it to get up
           // to speed.
           lastPayload = payload
+          mutex.Unlock()
 
-        case err := <-watcher.Error:
+        case err := <-fileWatcher.Error:
           fmt.Println("error:", err)
-        case <-watcher.Closed:
+        case <-fileWatcher.Closed:
           return
         }
       }
     }()
 
-    if err := watcher.Start(time.Millisecond * 100); err != nil {
+    if err := fileWatcher.Start(time.Millisecond * 100); err != nil {
       fmt.Printf("Error in filesystem watcher: %s. Stop.\n", err)
     }
   }()
 
+  // Advance clock sources (ie, `wave`) on a timer, so that clocked circuits (like a counter) run
+  // without a client having to send tick events.
+  if *runTickInterval > 0 {
+    go func() {
+      for range time.Tick(*runTickInterval) {
+        mutex.Lock()
+        // Until a program compiles, there is nothing to tick, and no diff is returned.
+        diff, err := session.Apply(SessionEvent{Type: "tick"})
+        if err != nil && diff != nil {
+          fmt.Printf("Error ticking: %s.\n", err)
+        }
+        if diff != nil && (len(diff.Gates) > 0 || len(diff.Wires) > 0) {
+          payload, err := json.Marshal(map[string]interface{}{"Diff": diff})
+          if err != nil {
+            fmt.Printf("Error serializing diff: %s.\n", err)
+          } else {
+            broadcast(payload)
+          }
+        }
+        mutex.Unlock()
+      }
+    }()
+  }
+
   fmt.Println("Opening browser...");
   openBrowser(fmt.Sprintf("http://lovelace-preview.surge.sh/?preview=true&server=http://localhost:%d", *runPort))
 
   fmt.Printf("Started server on %d\n", *runPort)
-  err = http.ListenAndServe(fmt.Sprintf(":%d", *runPort), nil)
+  err := http.ListenAndServe(fmt.Sprintf(":%d", *runPort), nil)
   panic(err)
 }
@@ -7,6 +7,7 @@ import (
 
   "net/http"
   "bytes"
+  "strings"
   "encoding/json"
 )
 
@@ -35,12 +36,26 @@ func Serve() {
     buf.ReadFrom(r.Body)
     source := buf.String() // Does a complete copy of the bytes in the buffer.
 
-    wireId = 0
-    gateId = 0
-    stackFrameId = 0
-    summary, err := RunString(source, *serverVerbose)
+    // Each request gets its own compiler so that concurrent compiles don't share ids.
+    compiler := NewCompiler()
+    compiler.Verbose = *serverVerbose
+    compiler.Optimize = r.URL.Query().Get("optimize") == "true"
+    compiler.MergeGates = r.URL.Query().Get("merge") == "true"
+    summary, err := compiler.RunString(source)
+
+    // Clients can request a graphviz graph of the compiled source instead of json.
+    if strings.Contains(r.Header.Get("Accept"), GRAPHVIZ_MIME_TYPE) {
+      if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+      }
+      w.Header().Set("Content-Type", GRAPHVIZ_MIME_TYPE)
+      w.Write([]byte(ExportGraphviz(summary)))
+      return
+    }
+
     if err != nil {
-      json.NewEncoder(w).Encode(map[string]string{"Error": err.Error()})
+      json.NewEncoder(w).Encode(ErrorPayload(err))
     } else {
       json.NewEncoder(w).Encode(summary)
     }
@@ -56,12 +71,64 @@ func Serve() {
     var body struct {
       Gates []*Gate
       Wires []*Wire
+
+      // The number of ticks to advance clock sources (ie, `wave`) by once the circuit is stable.
+      Ticks int
     }
     decoder.Decode(&body)
 
-    gates, wires := Execute(body.Gates, body.Wires)
+    // Ticking is done while the request waits, so a single request can't tick forever.
+    if body.Ticks < 0 || body.Ticks > MAX_SESSION_TICKS {
+      http.Error(w, fmt.Sprintf("Ticks must be between 0 and %d", MAX_SESSION_TICKS), http.StatusBadRequest)
+      return
+    }
+
+    simulation := NewSimulation(body.Gates, body.Wires)
+    simulation.Settle()
+    for i := 0; i < body.Ticks; i++ {
+      simulation.Tick()
+    }
+
+    json.NewEncoder(w).Encode(map[string]interface{}{"Gates": body.Gates, "Wires": body.Wires})
+  })
+
+  http.HandleFunc("/v1/truthtable", func(w http.ResponseWriter, r *http.Request) {
+    // Allow Cross Origin Resource Sharing
+    w.Header().Set("Access-Control-Allow-Origin", "*")
+    w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+    buf := new(bytes.Buffer)
+    buf.ReadFrom(r.Body)
+    source := buf.String()
+
+    compiler := NewCompiler()
+    compiler.Verbose = *serverVerbose
+    harness, err := compiler.HarnessString(source, r.URL.Query().Get("block"))
+
+    var table *TruthTable
+    if err == nil {
+      table, err = harness.TruthTable()
+    }
+
+    // Clients can request the table as markdown or csv instead of json.
+    if format := r.URL.Query().Get("format"); len(format) > 0 {
+      var formatted string
+      if err == nil {
+        formatted, err = table.Format(format)
+      }
+      if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+      }
+      w.Write([]byte(formatted))
+      return
+    }
 
-    json.NewEncoder(w).Encode(map[string]interface{}{"Gates": gates, "Wires": wires})
+    if err != nil {
+      json.NewEncoder(w).Encode(ErrorPayload(err))
+    } else {
+      json.NewEncoder(w).Encode(table)
+    }
   })
 
   fmt.Printf("Started server on %d\n", *serverPort)
@@ -0,0 +1,94 @@
+package main
+
+import (
+  "fmt"
+  "flag"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+func Test() {
+  testFlags := flag.NewFlagSet("test", flag.ExitOnError)
+  testVerbose := testFlags.Bool("verbose", false, "Print debug information")
+  testMaxCallDepth := testFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+  testFlags.Usage = func() { help("test") }
+  testFlags.Parse(os.Args[2:])
+
+  // Without any paths, every test file within the working directory is run.
+  paths := testFlags.Args()
+  if len(paths) == 0 {
+    paths = []string{"."}
+  }
+
+  var files []string
+  for _, path := range paths {
+    info, err := os.Stat(path)
+    if err != nil {
+      fmt.Printf("Error reading %s: %s. Stop.\n", path, err)
+      os.Exit(2)
+      return
+    }
+    if !info.IsDir() {
+      files = append(files, path)
+      continue
+    }
+
+    filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+      if err == nil && !info.IsDir() && strings.HasSuffix(file, ".test.bit") {
+        files = append(files, file)
+      }
+      return nil
+    })
+  }
+
+  if len(files) == 0 {
+    fmt.Println("No test files were found. Test files end in .test.bit. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  passed, failed, broken := 0, 0, 0
+  for _, file := range files {
+    compiler := NewCompiler()
+    compiler.Verbose = *testVerbose
+
+    // Set max call depth if a value was specified.
+    if *testMaxCallDepth != -1 {
+      compiler.MaxRecursionDepth = *testMaxCallDepth
+    }
+
+    results, err := compiler.RunTestFile(file)
+    if err != nil {
+      fmt.Printf("ERROR %s\n", file)
+      fmt.Printf("  %s\n", strings.TrimSpace(err.Error()))
+      broken += 1
+      continue
+    }
+
+    for _, result := range results {
+      if result.Passed() {
+        fmt.Printf("PASS  %s (%s, %d rows)\n", result.Name, formatPosition(result.File, result.Line, result.Col), result.Vectors)
+        passed += 1
+        continue
+      }
+
+      fmt.Printf("FAIL  %s (%s)\n", result.Name, formatPosition(result.File, result.Line, result.Col))
+      for _, failure := range result.Failures {
+        fmt.Printf("  %s\n", strings.TrimSpace(failure))
+      }
+      failed += 1
+    }
+  }
+
+  fmt.Println()
+  fmt.Printf("%d passed, %d failed", passed, failed)
+  if broken > 0 {
+    fmt.Printf(", errors in %d file(s)", broken)
+  }
+  fmt.Println()
+
+  if failed > 0 || broken > 0 {
+    os.Exit(1)
+  }
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+  "fmt"
+  "flag"
+  "os"
+)
+
+func PrintTruthTable() {
+  truthTableFlags := flag.NewFlagSet("truthtable", flag.ExitOnError)
+  truthTableVerbose := truthTableFlags.Bool("verbose", false, "Print debug information")
+  truthTableMaxCallDepth := truthTableFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+  truthTableBlock := truthTableFlags.String("block", "", "The block to print the truth table of")
+  truthTableFormat := truthTableFlags.String("format", "markdown", "The format to print the truth table in")
+  truthTableFlags.Usage = func() { help("truthtable") }
+  truthTableFlags.Parse(os.Args[2:])
+
+  // Flags can also come after the file, like `lovel truthtable foo.bit --block halfadder`.
+  if truthTableFlags.NArg() < 1 {
+    fmt.Println("No file path was passed to truthtable. Stop.")
+    os.Exit(2)
+    return
+  }
+  filePath := truthTableFlags.Arg(0)
+  truthTableFlags.Parse(truthTableFlags.Args()[1:])
+  if truthTableFlags.NArg() > 0 {
+    fmt.Println("Only one file can be passed to truthtable. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  if len(*truthTableBlock) == 0 {
+    fmt.Println("No block was passed to truthtable. Pass one with --block, like --block halfadder. Stop.")
+    os.Exit(2)
+    return
+  }
+
+  compiler := NewCompiler()
+  compiler.Verbose = *truthTableVerbose
+
+  // Set max call depth if a value was specified.
+  if *truthTableMaxCallDepth != -1 {
+    compiler.MaxRecursionDepth = *truthTableMaxCallDepth
+  }
+
+  harness, err := compiler.HarnessFile(filePath, *truthTableBlock)
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+  compiler.PrintWarnings()
+
+  table, err := harness.TruthTable()
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+
+  formatted, err := table.Format(*truthTableFormat)
+  if err != nil {
+    fmt.Println(err);
+    os.Exit(2)
+    return
+  }
+  fmt.Print(formatted)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+  "fmt"
+  "os"
+)
+
+// The default maximum depth that blocks can be invoked within each other before compilation is
+// halted. This stops infinitely recursive blocks from hanging the compiler.
+const DEFAULT_MAX_RECURSION_DEPTH = 100
+
+// The default maximum number of times that `for` loops can repeat their content in a single compile.
+// This stops a loop like `for i in 0..100000000` from hanging the compiler.
+const DEFAULT_MAX_UNROLLED_ITERATIONS = 100000
+
+// A Compiler holds all of the state used while turning lovelace source into gates and wires. Every
+// compiler hands out its own wire, gate, and stack frame ids, so many compilers can be run at once
+// (for example, one per request in `lovel serve`) without clobbering each other's ids.
+type Compiler struct {
+  // The maximum depth that blocks can be invoked within each other. Setting to 0 disables the limit.
+  MaxRecursionDepth int
+
+  // The maximum number of times that `for` loops can repeat their content, counting every loop and
+  // every invocation of the block that a loop is within. Setting to 0 disables the limit.
+  MaxUnrolledIterations int
+
+  // Print debugging information while compiling.
+  Verbose bool
+
+  // Merge chains of two input `AND` and `OR` gates into a single gate with many inputs. This changes
+  // the ids and number of gates that are compiled, so it's off by default. See `mergeGateChains`.
+  MergeGates bool
+
+  // Shrink the compiled gates and wires without changing what they do, and report by how much in
+  // `Optimizations`. See `optimizeSummary`.
+  Optimize bool
+  Optimizations *OptimizationReport
+
+  // Problems found while compiling that don't stop compilation, like a block that hides another
+  // block with the same name.
+  Warnings []string
+
+  // Every local file that the last compile read, including the files that it imported. See
+  // `ModuleResolver.Files`.
+  Files []string
+
+  // The last id that was handed out for each kind of thing that the parser creates.
+  wireId int
+  gateId int
+  stackFrameId int
+
+  // The number of times that `for` loops have repeated their content so far.
+  unrolledIterations int
+}
+
+func NewCompiler() *Compiler {
+  return &Compiler{
+    MaxRecursionDepth: DEFAULT_MAX_RECURSION_DEPTH,
+    MaxUnrolledIterations: DEFAULT_MAX_UNROLLED_ITERATIONS,
+  }
+}
+
+// Print each warning from the last compile. Warnings go to stderr, so that they don't end up within
+// output that is piped somewhere else (like `lovel export`).
+func (c *Compiler) PrintWarnings() {
+  for _, warning := range c.Warnings {
+    fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+  }
+}
+
+// Print how much the last compile was optimized, if it was. Like warnings, this goes to stderr.
+func (c *Compiler) PrintOptimizations() {
+  if c.Optimizations != nil {
+    fmt.Fprintf(os.Stderr, "%s\n", c.Optimizations)
+  }
+}
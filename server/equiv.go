@@ -0,0 +1,414 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+)
+
+// The most nodes that the decision diagrams of two blocks can have before they're too big to be
+// compared. Some circuits (ie, multipliers) have diagrams that grow exponentially with their inputs.
+const MAX_BDD_NODES = 1 << 22
+
+// The result of comparing two blocks. When the blocks aren't equivalent, `Counterexample` holds
+// inputs that make them disagree, and the outputs of each block for those inputs.
+type EquivalenceResult struct {
+  Equivalent bool
+  Inputs []string
+  Outputs []string
+
+  Counterexample []bool `json:",omitempty"`
+  LeftOutputs []bool `json:",omitempty"`
+  RightOutputs []bool `json:",omitempty"`
+}
+
+// Prove that two blocks compute the same outputs for every combination of their inputs. Inputs and
+// outputs are matched by position, so the blocks can name them differently. Each output of both
+// blocks is built into a reduced ordered binary decision diagram over the gates that drive it. Two
+// functions are equal only if their diagrams are the same node, so no input has to be simulated
+// unless the blocks differ. Only combinational blocks can be compared; a block with a flip flop,
+// wave or loop is an error.
+func CheckEquivalence(left *BlockHarness, right *BlockHarness) (*EquivalenceResult, error) {
+  if len(left.Inputs) != len(right.Inputs) || len(left.Outputs) != len(right.Outputs) {
+    return nil, errors.New(fmt.Sprintf(
+      "%s has %d inputs and %d outputs, but %s has %d inputs and %d outputs, so they can't be compared. Stop.",
+      left.Name,
+      len(left.Inputs),
+      len(left.Outputs),
+      right.Name,
+      len(right.Inputs),
+      len(right.Outputs),
+    ))
+  }
+
+  diagram := newBdd(len(left.Inputs))
+  leftBdd, rightBdd := newHarnessBdd(diagram, left), newHarnessBdd(diagram, right)
+
+  // The size of a diagram depends on the order of its variables. Inputs like `a[N] b[N]` are in the
+  // worst order for an adder, so inputs are ordered by when they're first reached from the outputs
+  // instead, which keeps inputs that are used together next to each other.
+  levels := make([]int, len(left.Inputs))
+  for level, input := range leftBdd.order() {
+    levels[input] = level
+  }
+  leftBdd.levels, rightBdd.levels = levels, levels
+
+  leftOutputs, err := leftBdd.outputs()
+  if err != nil {
+    return nil, err
+  }
+  rightOutputs, err := rightBdd.outputs()
+  if err != nil {
+    return nil, err
+  }
+
+  result := &EquivalenceResult{Equivalent: true, Inputs: left.Inputs, Outputs: left.Outputs}
+  for index := range leftOutputs {
+    if leftOutputs[index] == rightOutputs[index] {
+      continue
+    }
+
+    // The outputs differ for every input that satisfies their xor.
+    difference, err := diagram.xor(leftOutputs[index], rightOutputs[index])
+    if err != nil {
+      return nil, err
+    }
+    result.Equivalent = false
+    assignment := diagram.satisfy(difference)
+    result.Counterexample = make([]bool, len(levels))
+    for input, level := range levels {
+      result.Counterexample[input] = assignment[level]
+    }
+    break
+  }
+
+  if result.Equivalent {
+    return result, nil
+  }
+
+  // Simulate the counterexample, so that every output of both blocks can be printed.
+  result.LeftOutputs, err = left.Evaluate(result.Counterexample)
+  if err != nil {
+    return nil, errors.New(fmt.Sprintf("%s. Stop.", err))
+  }
+  result.RightOutputs, err = right.Evaluate(result.Counterexample)
+  if err != nil {
+    return nil, errors.New(fmt.Sprintf("%s. Stop.", err))
+  }
+  return result, nil
+}
+
+// A reduced ordered binary decision diagram. Node 0 is false and node 1 is true, and every other
+// node tests a variable, which are ordered by their index. Nodes are never duplicated, so two
+// functions are equal only if they're the same node.
+type bdd struct {
+  nodes []bddNode
+  unique map[bddNode]int
+  cache map[[3]int]int
+}
+
+type bddNode struct {
+  Variable int
+  Low int
+  High int
+}
+
+const (
+  BDD_FALSE = 0
+  BDD_TRUE = 1
+)
+
+func newBdd(variables int) *bdd {
+  // Terminals test a variable after every real variable, so that they're always at the bottom.
+  terminal := bddNode{Variable: variables, Low: -1, High: -1}
+  return &bdd{
+    nodes: []bddNode{terminal, terminal},
+    unique: map[bddNode]int{},
+    cache: map[[3]int]int{},
+  }
+}
+
+// The node that is true when the given variable is.
+func (b *bdd) variable(index int) (int, error) {
+  return b.node(index, BDD_FALSE, BDD_TRUE)
+}
+
+func (b *bdd) node(variable int, low int, high int) (int, error) {
+  if low == high {
+    return low, nil
+  }
+
+  key := bddNode{Variable: variable, Low: low, High: high}
+  if index, ok := b.unique[key]; ok {
+    return index, nil
+  }
+  if len(b.nodes) >= MAX_BDD_NODES {
+    return 0, errors.New(fmt.Sprintf("The blocks are too complex to compare (their decision diagrams have more than %d nodes). Stop.", MAX_BDD_NODES))
+  }
+  b.nodes = append(b.nodes, key)
+  b.unique[key] = len(b.nodes) - 1
+  return len(b.nodes) - 1, nil
+}
+
+// The cofactors of a node with respect to a variable, ie, the node when the variable is false and
+// when it's true.
+func (b *bdd) cofactors(node int, variable int) (int, int) {
+  if b.nodes[node].Variable != variable {
+    return node, node
+  }
+  return b.nodes[node].Low, b.nodes[node].High
+}
+
+// If f then g else h. Every other operation is built from this.
+func (b *bdd) ite(f int, g int, h int) (int, error) {
+  switch {
+  case f == BDD_TRUE:
+    return g, nil
+  case f == BDD_FALSE:
+    return h, nil
+  case g == h:
+    return g, nil
+  case g == BDD_TRUE && h == BDD_FALSE:
+    return f, nil
+  }
+
+  key := [3]int{f, g, h}
+  if result, ok := b.cache[key]; ok {
+    return result, nil
+  }
+
+  // Split on the first variable that any of the operands test.
+  variable := b.nodes[f].Variable
+  if b.nodes[g].Variable < variable {
+    variable = b.nodes[g].Variable
+  }
+  if b.nodes[h].Variable < variable {
+    variable = b.nodes[h].Variable
+  }
+
+  f0, f1 := b.cofactors(f, variable)
+  g0, g1 := b.cofactors(g, variable)
+  h0, h1 := b.cofactors(h, variable)
+  low, err := b.ite(f0, g0, h0)
+  if err != nil {
+    return 0, err
+  }
+  high, err := b.ite(f1, g1, h1)
+  if err != nil {
+    return 0, err
+  }
+
+  result, err := b.node(variable, low, high)
+  if err != nil {
+    return 0, err
+  }
+  b.cache[key] = result
+  return result, nil
+}
+
+func (b *bdd) not(f int) (int, error) {
+  return b.ite(f, BDD_FALSE, BDD_TRUE)
+}
+
+func (b *bdd) and(f int, g int) (int, error) {
+  return b.ite(f, g, BDD_FALSE)
+}
+
+func (b *bdd) or(f int, g int) (int, error) {
+  return b.ite(f, BDD_TRUE, g)
+}
+
+func (b *bdd) xor(f int, g int) (int, error) {
+  notG, err := b.not(g)
+  if err != nil {
+    return 0, err
+  }
+  return b.ite(f, notG, g)
+}
+
+// Inputs that make a node true, which must not be false. Variables that the node doesn't depend on
+// are false.
+func (b *bdd) satisfy(node int) []bool {
+  inputs := make([]bool, b.nodes[BDD_FALSE].Variable)
+  for node != BDD_TRUE {
+    // Every node other than false leads to true, so only a low branch to false has to be avoided.
+    if b.nodes[node].Low != BDD_FALSE {
+      node = b.nodes[node].Low
+    } else {
+      inputs[b.nodes[node].Variable] = true
+      node = b.nodes[node].High
+    }
+  }
+  return inputs
+}
+
+// Builds the decision diagram of each wire within a harness, starting at its outputs.
+type harnessBdd struct {
+  diagram *bdd
+  harness *BlockHarness
+
+  // The gate that drives each wire, the input that each switch wire is, and the variable of each
+  // input.
+  drivers map[int]*Gate
+  inputs map[int]int
+  levels []int
+
+  // The diagram of each wire that has been built, and the wires that are being built, which are
+  // used to find loops.
+  wires map[int]int
+  building map[int]bool
+}
+
+func newHarnessBdd(diagram *bdd, harness *BlockHarness) *harnessBdd {
+  h := &harnessBdd{
+    diagram: diagram,
+    harness: harness,
+    drivers: map[int]*Gate{},
+    inputs: map[int]int{},
+    wires: map[int]int{},
+    building: map[int]bool{},
+  }
+  for _, gate := range harness.Summary.Gates {
+    for _, output := range gate.Outputs {
+      if _, ok := h.drivers[output.Id]; !ok {
+        h.drivers[output.Id] = gate
+      }
+    }
+  }
+  for index, gateIndex := range harness.switches {
+    h.inputs[harness.Summary.Gates[gateIndex].Outputs[0].Id] = index
+    h.levels = append(h.levels, index)
+  }
+  return h
+}
+
+// Every input, in the order that they're first reached by walking back from each output in turn.
+// Inputs that no output depends on are last.
+func (h *harnessBdd) order() []int {
+  order := []int{}
+  reached := map[int]bool{}
+  visited := map[int]bool{}
+
+  // Walk with a stack rather than recursively, since this runs before loops have been found.
+  stack := []int{}
+  for index := len(h.harness.outputs) - 1; index >= 0; index-- {
+    stack = append(stack, h.harness.outputs[index].Id)
+  }
+  for len(stack) > 0 {
+    id := stack[len(stack)-1]
+    stack = stack[:len(stack)-1]
+    if visited[id] {
+      continue
+    }
+    visited[id] = true
+
+    if input, ok := h.inputs[id]; ok {
+      order = append(order, input)
+      reached[input] = true
+      continue
+    }
+    if gate, ok := h.drivers[id]; ok {
+      for index := len(gate.Inputs) - 1; index >= 0; index-- {
+        stack = append(stack, gate.Inputs[index].Id)
+      }
+    }
+  }
+
+  for input := range h.harness.Inputs {
+    if !reached[input] {
+      order = append(order, input)
+    }
+  }
+  return order
+}
+
+func (h *harnessBdd) outputs() ([]int, error) {
+  nodes := []int{}
+  for _, output := range h.harness.outputs {
+    node, err := h.wire(output.Id)
+    if err != nil {
+      return nil, err
+    }
+    nodes = append(nodes, node)
+  }
+  return nodes, nil
+}
+
+func (h *harnessBdd) wire(id int) (int, error) {
+  if node, ok := h.wires[id]; ok {
+    return node, nil
+  }
+  if index, ok := h.inputs[id]; ok {
+    return h.diagram.variable(h.levels[index])
+  }
+
+  // Like in a simulation, a wire that nothing drives is never powered.
+  gate, ok := h.drivers[id]
+  if !ok {
+    return BDD_FALSE, nil
+  }
+
+  if h.building[id] {
+    return 0, errors.New(fmt.Sprintf("%s has a loop (through gate %d), so it isn't combinational and can't be compared. Stop.", h.harness.Name, gate.Id))
+  }
+  h.building[id] = true
+  node, err := h.gate(gate)
+  delete(h.building, id)
+  if err != nil {
+    return 0, err
+  }
+
+  h.wires[id] = node
+  return node, nil
+}
+
+func (h *harnessBdd) gate(gate *Gate) (int, error) {
+  inputs := []int{}
+  for _, input := range gate.Inputs {
+    node, err := h.wire(input.Id)
+    if err != nil {
+      return 0, err
+    }
+    inputs = append(inputs, node)
+  }
+
+  switch gate.Type {
+  case AND:
+    return h.fold(inputs, BDD_TRUE, h.diagram.and, false)
+  case NAND:
+    return h.fold(inputs, BDD_TRUE, h.diagram.and, true)
+  case OR:
+    return h.fold(inputs, BDD_FALSE, h.diagram.or, false)
+  case NOR:
+    return h.fold(inputs, BDD_FALSE, h.diagram.or, true)
+  case XOR:
+    return h.fold(inputs, BDD_FALSE, h.diagram.xor, false)
+  case XNOR:
+    return h.fold(inputs, BDD_FALSE, h.diagram.xor, true)
+  case NOT:
+    return h.diagram.not(inputs[0])
+  case BLOCK_INPUT, BLOCK_OUTPUT:
+    return inputs[0], nil
+  case SOURCE:
+    return BDD_TRUE, nil
+  case GROUND:
+    return BDD_FALSE, nil
+  }
+
+  return 0, errors.New(fmt.Sprintf("%s uses %s (gate %d), so it isn't combinational and can't be compared. Stop.", h.harness.Name, gate.Label, gate.Id))
+}
+
+// Combine the inputs of a gate that accepts any number of inputs, like the simulation does.
+func (h *harnessBdd) fold(inputs []int, initial int, operation func(int, int) (int, error), invert bool) (int, error) {
+  result := initial
+  for _, input := range inputs {
+    var err error
+    result, err = operation(result, input)
+    if err != nil {
+      return 0, err
+    }
+  }
+  if invert {
+    return h.diagram.not(result)
+  }
+  return result, nil
+}
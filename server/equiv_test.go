@@ -0,0 +1,124 @@
+package main
+
+import (
+  "testing"
+  "reflect"
+  "strings"
+)
+
+func mustHarness(t *testing.T, source string, name string) *BlockHarness {
+  harness, err := NewCompiler().HarnessString(source, name)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return harness
+}
+
+func TestEquivalentBlocks(t *testing.T) {
+  left := mustHarness(t, "import adder", "halfadder")
+  right := mustHarness(t, `
+    block halfadder2(x y) {
+      let sum = x xor y
+      let carry = not (x nand y)
+      return sum carry
+    }
+  `, "halfadder2")
+
+  result, err := CheckEquivalence(left, right)
+  if err != nil {
+    t.Fatal("Error: "+err.Error())
+  }
+  if !result.Equivalent || result.Counterexample != nil {
+    t.Errorf("Blocks should be equivalent: %+v", result)
+  }
+}
+
+func TestEquivalentBusBlocks(t *testing.T) {
+  left := mustHarness(t, "import adder", "adder4")
+  right := mustHarness(t, `
+    import adder
+    block adder4(a[4] b[4]) {
+      let s0 c0 = halfadder(a[0] b[0])
+      let s1 c1 = adder(a[1] b[1] c0)
+      let s2 c2 = adder(a[2] b[2] c1)
+      let s3 c3 = adder(a[3] b[3] c2)
+      return s0 s1 s2 s3 c3
+    }
+  `, "adder4")
+
+  result, err := CheckEquivalence(left, right)
+  if err != nil {
+    t.Fatal("Error: "+err.Error())
+  }
+  if !result.Equivalent {
+    t.Errorf("Blocks should be equivalent: %+v", result)
+  }
+}
+
+func TestInequivalentBlocks(t *testing.T) {
+  left := mustHarness(t, "import adder", "halfadder")
+  right := mustHarness(t, `
+    block broken(a b) {
+      let sum = a or b
+      let carry = a and b
+      return sum carry
+    }
+  `, "broken")
+
+  result, err := CheckEquivalence(left, right)
+  if err != nil {
+    t.Fatal("Error: "+err.Error())
+  }
+  // The blocks only differ when both inputs are on.
+  if result.Equivalent ||
+    !reflect.DeepEqual(result.Counterexample, []bool{true, true}) ||
+    !reflect.DeepEqual(result.LeftOutputs, []bool{false, true}) ||
+    !reflect.DeepEqual(result.RightOutputs, []bool{true, true}) {
+    t.Errorf("Wrong counterexample: %+v", result)
+  }
+}
+
+func TestEquivalenceErrors(t *testing.T) {
+  halfadder := mustHarness(t, "import adder", "halfadder")
+  for source, message := range map[string]string{
+    "block b(a) {\n  return not a\n}": "halfadder has 2 inputs and 2 outputs, but b has 1 inputs and 1 outputs",
+    "block b(a c) {\n  let q notq = tflipflop(a c)\n  return q notq\n}": "b uses tflipflop",
+  } {
+    _, err := CheckEquivalence(halfadder, mustHarness(t, source, "b"))
+    if err == nil || !strings.Contains(err.Error(), message) {
+      t.Errorf("Expected an error containing %s, found %v", message, err)
+    }
+  }
+}
+
+// Adders with their inputs in the order `a[N] b[N]` are the worst case for a decision diagram, so
+// this only finishes quickly if the inputs are reordered.
+func TestEquivalenceOfWideAdders(t *testing.T) {
+  source := `
+    import adder
+    block ripple<N>(a[N] b[N] cin) {
+      if N == 1 {
+        return adder(a[0] b[0] cin)
+      } else {
+        let s c = adder(a[0] b[0] cin)
+        return s ripple<N-1>(a[1:N] b[1:N] c)
+      }
+    }
+    block spelled<N>(a[N] b[N] cin) {
+      let s = a[0] xor b[0] xor cin
+      let c = (a[0] and b[0]) or (cin and (a[0] xor b[0]))
+      if N == 1 {
+        return s c
+      } else {
+        return s spelled<N-1>(a[1:N] b[1:N] c)
+      }
+    }
+  `
+  result, err := CheckEquivalence(mustHarness(t, source, "ripple<32>"), mustHarness(t, source, "spelled<32>"))
+  if err != nil {
+    t.Fatal("Error: "+err.Error())
+  }
+  if !result.Equivalent {
+    t.Errorf("Adders should be equivalent: %+v", result)
+  }
+}
@@ -0,0 +1,102 @@
+package main
+
+// A code that identifies the kind of problem a `CompileError` describes, so that clients can react
+// to errors without having to parse the message.
+type ErrorCode string
+const (
+  // The source couldn't be tokenized, ie, an unknown token or an unclosed parenthesis.
+  SYNTAX_ERROR ErrorCode = "SYNTAX_ERROR"
+  // The source tokenized, but the tokens were used incorrectly, ie, an operator without a left hand
+  // side or a reserved word used as an identifier.
+  VALIDATION_ERROR = "VALIDATION_ERROR"
+  // An import couldn't be found, read, or would create a cycle.
+  IMPORT_ERROR = "IMPORT_ERROR"
+  // A file couldn't be read.
+  FILE_ERROR = "FILE_ERROR"
+  // An expression produced a different number of values than where it was used expects.
+  ARITY_ERROR = "ARITY_ERROR"
+  // An invocation referred to a block that isn't in scope.
+  UNDEFINED_BLOCK = "UNDEFINED_BLOCK"
+  // An invocation went deeper than the maximum call depth of the compiler.
+  MAX_CALL_DEPTH = "MAX_CALL_DEPTH"
+  // `for` loops repeated their content more times than the compiler allows.
+  MAX_UNROLLED_ITERATIONS = "MAX_UNROLLED_ITERATIONS"
+  // A builtin was passed an argument that it can't accept.
+  INVALID_ARGUMENT = "INVALID_ARGUMENT"
+  // The compiler got into a state that should be impossible.
+  INTERNAL_ERROR = "INTERNAL_ERROR"
+)
+
+// An error found while compiling a program, along with the span of source code that caused it.
+// Lines and columns start at 1, and the end of the span is exclusive. A line of 0 means that the
+// error couldn't be traced to a location in the source.
+type CompileError struct {
+  Code ErrorCode
+  Message string
+
+  // The file that contains the span, or an empty string if the source didn't come from a file.
+  File string
+  StartLine int
+  StartCol int
+  EndLine int
+  EndCol int
+}
+
+func (e *CompileError) Error() string {
+  return e.Message
+}
+
+// Create an error that isn't attached to a location in the source.
+func NewCompileError(code ErrorCode, message string) *CompileError {
+  return &CompileError{Code: code, Message: message}
+}
+
+// Create an error that spans the single character at `line` and `col` within `file`.
+func NewPositionError(code ErrorCode, file string, line int, col int, message string) *CompileError {
+  return &CompileError{
+    Code: code,
+    Message: message,
+    File: file,
+    StartLine: line,
+    StartCol: col,
+    EndLine: line,
+    EndCol: col + 1,
+  }
+}
+
+// Create an error that spans a node.
+func NewNodeError(code ErrorCode, node Node, message string) *CompileError {
+  err := NewPositionError(code, node.File, node.Line, node.Col, message)
+
+  // Nodes that weren't created by the tokenizer don't know where they end.
+  if node.EndLine > 0 {
+    err.EndLine = node.EndLine
+    err.EndCol = node.EndCol
+  }
+  return err
+}
+
+// Replace the message of an error, keeping its code and location if it's a `CompileError`. Errors
+// that aren't a `CompileError` are given the code `fallback`.
+func WrapCompileError(err error, fallback ErrorCode, message string) *CompileError {
+  if compileErr, ok := err.(*CompileError); ok {
+    wrapped := *compileErr
+    wrapped.Message = message
+    return &wrapped
+  }
+  return NewCompileError(fallback, message)
+}
+
+// The json payload that is sent to clients when a program fails to compile. `Error` contains just
+// the message, for clients that don't need to know where the error is.
+func ErrorPayload(err error) map[string]interface{} {
+  compileErr, ok := err.(*CompileError)
+  if !ok {
+    compileErr = NewCompileError(INTERNAL_ERROR, err.Error())
+  }
+
+  return map[string]interface{}{
+    "Error": compileErr.Message,
+    "CompileError": compileErr,
+  }
+}
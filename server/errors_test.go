@@ -0,0 +1,105 @@
+package main
+
+import (
+  "testing"
+  "errors"
+  "reflect"
+  "path/filepath"
+)
+
+func TestCompileErrorLocations(t *testing.T) {
+  for _, test := range []struct{
+    Source string
+    Code ErrorCode
+    Line int
+    Col int
+  }{
+    {"led(1)\nfoo()", UNDEFINED_BLOCK, 2, 1},
+    {"led(1)\n  led(1 $)", SYNTAX_ERROR, 2, 9},
+    {"led(1)\nlet block = 1", VALIDATION_ERROR, 2, 1},
+    {"led(\n(5))", INVALID_ARGUMENT, 2, 2},
+  } {
+    _, err := RunString(test.Source, false)
+    compileErr, ok := err.(*CompileError)
+    if !ok {
+      t.Errorf("Compiling %q didn't return a CompileError, returned %v", test.Source, err)
+      continue
+    }
+
+    if compileErr.Code != test.Code {
+      t.Errorf("Compiling %q returned code %s, expected %s", test.Source, compileErr.Code, test.Code)
+    }
+    if compileErr.StartLine != test.Line || compileErr.StartCol != test.Col {
+      t.Errorf(
+        "Compiling %q returned an error at %d:%d, expected %d:%d",
+        test.Source,
+        compileErr.StartLine,
+        compileErr.StartCol,
+        test.Line,
+        test.Col,
+      )
+    }
+  }
+}
+
+func TestCompileErrorInImportedFile(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": "import \"./broken.bit\"\nled(1)",
+    "broken.bit": "\n\nled(1) $",
+  })
+
+  _, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  compileErr, ok := err.(*CompileError)
+  if !ok {
+    t.Errorf("Didn't return a CompileError, returned %v", err)
+    return
+  }
+
+  // The error should point to the problem within the imported file, not the import.
+  if compileErr.File != filepath.Join(dir, "broken.bit") || compileErr.StartLine != 3 {
+    t.Errorf("Error is in the wrong place: %+v", compileErr)
+  }
+}
+
+func TestCompileErrorMissingImport(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": "led(1)\nimport \"./missing.bit\"",
+  })
+
+  _, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  compileErr, ok := err.(*CompileError)
+  if !ok {
+    t.Errorf("Didn't return a CompileError, returned %v", err)
+    return
+  }
+
+  if compileErr.Code != IMPORT_ERROR || compileErr.File != filepath.Join(dir, "main.bit") || compileErr.StartLine != 2 {
+    t.Errorf("Error is in the wrong place: %+v", compileErr)
+  }
+}
+
+func TestErrorPayload(t *testing.T) {
+  compileErr := NewPositionError(SYNTAX_ERROR, "a.bit", 2, 3, "Bad. Stop.")
+  if !reflect.DeepEqual(ErrorPayload(compileErr), map[string]interface{}{
+    "Error": "Bad. Stop.",
+    "CompileError": &CompileError{
+      Code: SYNTAX_ERROR,
+      Message: "Bad. Stop.",
+      File: "a.bit",
+      StartLine: 2,
+      StartCol: 3,
+      EndLine: 2,
+      EndCol: 4,
+    },
+  }) {
+    t.Errorf("Payload doesn't match! %+v", ErrorPayload(compileErr))
+  }
+
+  // Errors that aren't compile errors aren't tied to a location.
+  if !reflect.DeepEqual(ErrorPayload(errors.New("Oops")), map[string]interface{}{
+    "Error": "Oops",
+    "CompileError": &CompileError{Code: INTERNAL_ERROR, Message: "Oops"},
+  }) {
+    t.Errorf("Payload doesn't match! %+v", ErrorPayload(errors.New("Oops")))
+  }
+}
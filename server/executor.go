@@ -2,65 +2,122 @@ package main
 
 import (
   "fmt"
+  "container/heap"
 )
 
-func setWire(wires []*Wire, id int, powered bool) {
-  for _, wire := range wires {
-    if wire.Id == id {
-      // if wire.Powered != powered {
-      //   fmt.Println("SET WIRE", wire.Id, powered)
-      // }
-      wire.Powered = powered
-      break
-    }
-  }
+// A Simulation indexes a list of gates and wires so that they can be executed efficiently. Rather
+// than re-evaluating every gate until the circuit stops changing, only gates that have an input
+// that changed are evaluated again.
+type Simulation struct {
+  Gates []*Gate
+  Wires []*Wire
+
+  // Every wire, indexed by its id.
+  wiresById map[int]*Wire
+
+  // For each wire id, the index of every gate (in `Gates`) that uses the wire as an input.
+  fanOut map[int][]int
+
+  // Gates that must be evaluated in the round that is currently running.
+  current gateQueue
+  inCurrent []bool
+
+  // Gates that must be evaluated in the next round.
+  next []int
+  inNext []bool
+
+  // The index of the gate that is currently being evaluated.
+  position int
+
+  // Once `TrackChanges` is called, the state that each gate (by index) and wire (by id) had before
+  // it first changed. These are nil when changes aren't being tracked.
+  gatesBefore map[int]string
+  wiresBefore map[int]bool
+}
+
+// A max-heap of gate indexes. Gates are always evaluated from the highest index to the lowest (see
+// the comment in `Settle`).
+type gateQueue []int
+func (q gateQueue) Len() int { return len(q) }
+func (q gateQueue) Less(i, j int) bool { return q[i] > q[j] }
+func (q gateQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *gateQueue) Push(x interface{}) { *q = append(*q, x.(int)) }
+func (q *gateQueue) Pop() interface{} {
+  old := *q
+  last := old[len(old)-1]
+  *q = old[:len(old)-1]
+  return last
 }
 
-func getWire(wires []*Wire, id int) bool {
+func NewSimulation(gates []*Gate, wires []*Wire) *Simulation {
+  s := &Simulation{
+    Gates: gates,
+    Wires: wires,
+    wiresById: map[int]*Wire{},
+    fanOut: map[int][]int{},
+    inCurrent: make([]bool, len(gates)),
+    inNext: make([]bool, len(gates)),
+  }
+
+  // The same wire can be in the wires slice many times. Like before, the first wire with an id is
+  // the one that holds its state.
   for _, wire := range wires {
-    if wire.Id == id {
-      return wire.Powered
+    if _, ok := s.wiresById[wire.Id]; !ok {
+      s.wiresById[wire.Id] = wire
     }
   }
-  return false
-}
 
-func calculateWireHash(wires []*Wire) string {
-  hash := ""
+  for index, gate := range gates {
+    for _, input := range gate.Inputs {
+      s.fanOut[input.Id] = append(s.fanOut[input.Id], index)
+    }
+  }
 
-  // Calculate which gates in the slice are important, and add them to the hash
-  for _, wire := range wires {
-    // Add the wire's state to the hash ( id,state; )
-    hash += fmt.Sprintf("%d,%v;", wire.Id, wire.Powered)
+  // Nothing is known about the state of the circuit yet, so every gate must be evaluated once.
+  for index := range gates {
+    s.MarkDirty(index)
   }
-  return hash
+
+  return s
 }
 
-func Execute(gates []*Gate, wires []*Wire) ([]*Gate, []*Wire) {
-  var oldHash string = ""
-  var newHash string
+// Schedule the gate at the given index to be evaluated in the next round. This should be called
+// whenever something outside of the simulation (ie, a user toggling a switch) changes a gate.
+func (s *Simulation) MarkDirty(index int) {
+  if !s.inNext[index] {
+    s.inNext[index] = true
+    s.next = append(s.next, index)
+  }
+}
 
-  // Store a preview of the next wire state.
-  newWires := make([]*Wire, len(wires))
-  copy(newWires, wires)
+// Start recording which gates and wires change, forgetting about any earlier changes. This lets a
+// caller find what an event changed without comparing the state of the whole circuit.
+func (s *Simulation) TrackChanges() {
+  s.gatesBefore = map[int]string{}
+  s.wiresBefore = map[int]bool{}
+}
 
-  // Define a max iteration count. This provides a ceiling that can be used to halt infinite
+// Evaluate gates until the circuit reaches a stable state. Returns false if the circuit didn't
+// stabilize within a reasonable amount of rounds (ie, it oscillates).
+func (s *Simulation) Settle() bool {
+  // Define a max round count. This provides a ceiling that can be used to halt infinite
   // recursions.
-  reasonableMaxIterationCount := (len(wires) * 5) + (len(gates) * 5)
-
-  for iterationCount := 0; iterationCount < reasonableMaxIterationCount; iterationCount++ {
-    // Calculate a hash of the state of all the wires.
-    newHash = calculateWireHash(wires)
+  reasonableMaxRoundCount := (len(s.Wires) * 5) + (len(s.Gates) * 5)
 
-    // If the hash after the last calculation is the same as the hash before
-    // the last calculation, then break out of the loop. We're at a stable state.
-    if oldHash == newHash {
-      break
+  for roundCount := 0; roundCount < reasonableMaxRoundCount; roundCount++ {
+    // No gates changed in the last round, so we're at a stable state.
+    if len(s.next) == 0 {
+      return true
     }
 
-    // Another round of computation is required. The hash of the current state is the hash to
-    // compare against for the next check.
-    oldHash = newHash
+    // Every gate that was scheduled for the next round is now part of this round.
+    s.current = gateQueue(s.next)
+    heap.Init(&s.current)
+    for _, index := range s.next {
+      s.inNext[index] = false
+      s.inCurrent[index] = true
+    }
+    s.next = nil
 
     // Update the gates in reverse order.
     // This is to curcumvent a bug where if two flip flops are attached to each other (where the
@@ -69,106 +126,208 @@ func Execute(gates []*Gate, wires []*Wire) ([]*Gate, []*Wire) {
     // flip flops to toggle. This means that any contraption created with chained flip-flops won't
     // work properly. So if you want to change the loop order below, make sure that chained flip
     // flops aren't effected!
-    for i := len(gates)-1; i >= 0; i-- {
-      gate := gates[i]
-      // fmt.Println("GATE", gate.Id)
-
-      switch gate.Type {
-      case "AND":
-        setWire(newWires, gate.Outputs[0].Id, getWire(wires, gate.Inputs[0].Id) && getWire(wires, gate.Inputs[1].Id));
-      case "OR":
-        setWire(newWires, gate.Outputs[0].Id, getWire(wires, gate.Inputs[0].Id) || getWire(wires, gate.Inputs[1].Id));
-      case "NOT":
-        setWire(newWires, gate.Outputs[0].Id, !getWire(wires, gate.Inputs[0].Id));
-      case "BLOCK_INPUT": fallthrough
-      case "BLOCK_OUTPUT":
-        setWire(newWires, gate.Outputs[0].Id, getWire(wires, gate.Inputs[0].Id));
-      case "SOURCE":
-        setWire(newWires, gate.Outputs[0].Id, true);
-      case "GROUND":
-        setWire(newWires, gate.Outputs[0].Id, false);
-
-      case "BUILTIN_FUNCTION":
-        if (gate.Label == "momentary" || gate.Label == "toggle") {
-          for i := 0; i < len(gate.Outputs); i++ {
-            setWire(newWires, gate.Outputs[i].Id, gate.State == "on");
-          }
-        } else if (gate.Label == "led") {
-          if getWire(wires, gate.Inputs[0].Id) {
-            gate.State = "on"
-          } else {
-            gate.State = "off"
-          }
-        } else if (gate.Label == "tflipflop") {
-          // Ensure that the tflipflop has enough inputs. This is also enforced at compile-time.
-          if len(gate.Inputs) < 2 {
-            break
-          }
-
-          // Set a default state for the flipflop if it hasn't been set already.
-          if len(gate.State) == 0 {
-            gate.State = "10"
-          }
-
-          // Was set wire pulled high?
-          if len(gate.Inputs) > 2 && getWire(wires, gate.Inputs[2].Id) {
-            gate.State = fmt.Sprintf("%s1", string(gate.State[0]))
-            continue
-          }
-          // Was reset wire pulled high?
-          if len(gate.Inputs) > 3 && getWire(wires, gate.Inputs[3].Id) {
-            gate.State = fmt.Sprintf("%s0", string(gate.State[0]))
-            continue
-          }
-
-          // Neither was pulled high, so see if the main wire was and the flip flop should be
-          // flipped.
-          clock := getWire(wires, gate.Inputs[0].Id);
-          powered := getWire(wires, gate.Inputs[1].Id);
-
-          // Format for gate.State:
-          // bit at index 0: used for storing if in the last frame, the tflipflop was powered
-          // bit at index 1: used for storing the state of the flip flop
-          // (1 if the S side is active, 0 if the R side is active)
-
-          // Detect the rising edge of the clock
-          if clock && gate.State[0] == '0' {
-            newState := string(gate.State[1])
-
-            // If powered on the clock's rising edge, then flip the state
-            if powered && gate.State[1] == '1' {
-              newState = "0"
-            } else if powered {
-              newState = "1"
-            }
-
-            gate.State = fmt.Sprintf("1%s", newState)
-
-          // Detect the falling edge of the clock
-          } else if !clock && gate.State[0] == '1' {
-            gate.State = fmt.Sprintf("0%s", string(gate.State[1]))
-          }
-
-          if (gate.State[1] == '1') {
-            /* The S side of the latch is active */
-            setWire(newWires, gate.Outputs[0].Id, true);
-            if len(gate.Outputs) > 1 { /* set not q if passed */
-              setWire(newWires, gate.Outputs[1].Id, false);
-            }
-          } else {
-            /* The R side of the latch is active */
-            setWire(newWires, gate.Outputs[0].Id, false);
-            if len(gate.Outputs) > 1 { /* set not q if passed */
-              setWire(newWires, gate.Outputs[1].Id, true);
-            }
-          }
-        }
+    //
+    // Wires are updated as soon as a gate is evaluated, so a gate with a lower index than the one
+    // that changed a wire sees the change within the same round, and a gate with a higher index
+    // sees it in the next round (see `setWire`).
+    for s.current.Len() > 0 {
+      s.position = heap.Pop(&s.current).(int)
+      s.inCurrent[s.position] = false
+      s.evaluate(s.Gates[s.position])
+    }
+  }
+
+  return len(s.next) == 0
+}
+
+// Advance every clock source (ie, `wave`) in the circuit by one tick, and then settle the circuit.
+func (s *Simulation) Tick() bool {
+  for index, gate := range s.Gates {
+    if gate.Type != BUILTIN_FUNCTION || gate.Label != "wave" {
+      continue
+    }
+
+    // A disabled wave is held at the start of its period, so that it turns on as soon as it is
+    // enabled.
+    phase, period, duty := parseWaveState(gate.State)
+    if len(gate.Inputs) > 0 && s.getWire(gate.Inputs[0].Id) {
+      phase = (phase + 1) % period
+    } else {
+      phase = 0
+    }
+    s.setState(index, formatWaveState(phase, period, duty))
+
+    s.MarkDirty(index)
+  }
+
+  return s.Settle()
+}
+
+func (s *Simulation) getWire(id int) bool {
+  if wire, ok := s.wiresById[id]; ok {
+    return wire.Powered
+  }
+  return false
+}
+
+// Set the state of a wire. If the state changed, schedule every gate that reads from the wire.
+func (s *Simulation) setWire(id int, powered bool) {
+  wire, ok := s.wiresById[id]
+  if !ok || wire.Powered == powered {
+    return
+  }
+  if s.wiresBefore != nil {
+    if _, ok := s.wiresBefore[id]; !ok {
+      s.wiresBefore[id] = wire.Powered
+    }
+  }
+  wire.Powered = powered
+
+  for _, index := range s.fanOut[id] {
+    if index < s.position {
+      // The gate hasn't been reached yet in this round, so evaluate it in this round.
+      if !s.inCurrent[index] {
+        s.inCurrent[index] = true
+        heap.Push(&s.current, index)
       }
+    } else {
+      s.MarkDirty(index)
+    }
+  }
+}
+
+// Set the state of the gate at the given index (ie, whether an led is on).
+func (s *Simulation) setState(index int, state string) {
+  gate := s.Gates[index]
+  if s.gatesBefore != nil {
+    if _, ok := s.gatesBefore[index]; !ok {
+      s.gatesBefore[index] = gate.State
     }
+  }
+  gate.State = state
+}
+
+// The number of inputs to a gate that are powered.
+func (s *Simulation) poweredInputs(gate *Gate) int {
+  powered := 0
+  for _, input := range gate.Inputs {
+    if s.getWire(input.Id) {
+      powered += 1
+    }
+  }
+  return powered
+}
+
+func (s *Simulation) evaluate(gate *Gate) {
+  switch gate.Type {
+  // These gates accept any number of inputs.
+  case "AND":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) == len(gate.Inputs));
+  case "OR":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) > 0);
+  case "XOR":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) % 2 == 1);
+  case "NAND":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) != len(gate.Inputs));
+  case "NOR":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) == 0);
+  case "XNOR":
+    s.setWire(gate.Outputs[0].Id, s.poweredInputs(gate) % 2 == 0);
+  case "NOT":
+    s.setWire(gate.Outputs[0].Id, !s.getWire(gate.Inputs[0].Id));
+  case "BLOCK_INPUT": fallthrough
+  case "BLOCK_OUTPUT":
+    s.setWire(gate.Outputs[0].Id, s.getWire(gate.Inputs[0].Id));
+  case "SOURCE":
+    s.setWire(gate.Outputs[0].Id, true);
+  case "GROUND":
+    s.setWire(gate.Outputs[0].Id, false);
+
+  case "BUILTIN_FUNCTION":
+    if (gate.Label == "momentary" || gate.Label == "toggle") {
+      for i := 0; i < len(gate.Outputs); i++ {
+        s.setWire(gate.Outputs[i].Id, gate.State == "on");
+      }
+    } else if (gate.Label == "led") {
+      if s.getWire(gate.Inputs[0].Id) {
+        s.setState(s.position, "on")
+      } else {
+        s.setState(s.position, "off")
+      }
+    } else if (gate.Label == "wave") {
+      // A wave is on for the first `duty` ticks of every period, as long as it is enabled. It's
+      // advanced by `Tick`.
+      phase, _, duty := parseWaveState(gate.State)
+      s.setWire(gate.Outputs[0].Id, s.getWire(gate.Inputs[0].Id) && phase < duty);
+    } else if (gate.Label == "tflipflop") {
+      // Ensure that the tflipflop has enough inputs. This is also enforced at compile-time.
+      if len(gate.Inputs) < 2 {
+        return
+      }
+
+      // Set a default state for the flipflop if it hasn't been set already.
+      if len(gate.State) == 0 {
+        s.setState(s.position, "10")
+      }
+
+      // Was set wire pulled high?
+      if len(gate.Inputs) > 2 && s.getWire(gate.Inputs[2].Id) {
+        s.setState(s.position, fmt.Sprintf("%s1", string(gate.State[0])))
+        return
+      }
+      // Was reset wire pulled high?
+      if len(gate.Inputs) > 3 && s.getWire(gate.Inputs[3].Id) {
+        s.setState(s.position, fmt.Sprintf("%s0", string(gate.State[0])))
+        return
+      }
+
+      // Neither was pulled high, so see if the main wire was and the flip flop should be
+      // flipped.
+      clock := s.getWire(gate.Inputs[0].Id);
+      powered := s.getWire(gate.Inputs[1].Id);
+
+      // Format for gate.State:
+      // bit at index 0: used for storing if in the last frame, the tflipflop was powered
+      // bit at index 1: used for storing the state of the flip flop
+      // (1 if the S side is active, 0 if the R side is active)
+
+      // Detect the rising edge of the clock
+      if clock && gate.State[0] == '0' {
+        newState := string(gate.State[1])
+
+        // If powered on the clock's rising edge, then flip the state
+        if powered && gate.State[1] == '1' {
+          newState = "0"
+        } else if powered {
+          newState = "1"
+        }
+
+        s.setState(s.position, fmt.Sprintf("1%s", newState))
 
-    // Copy new wires into the normal wires array for the next go around
-    copy(wires, newWires)
+      // Detect the falling edge of the clock
+      } else if !clock && gate.State[0] == '1' {
+        s.setState(s.position, fmt.Sprintf("0%s", string(gate.State[1])))
+      }
+
+      if (gate.State[1] == '1') {
+        /* The S side of the latch is active */
+        s.setWire(gate.Outputs[0].Id, true);
+        if len(gate.Outputs) > 1 { /* set not q if passed */
+          s.setWire(gate.Outputs[1].Id, false);
+        }
+      } else {
+        /* The R side of the latch is active */
+        s.setWire(gate.Outputs[0].Id, false);
+        if len(gate.Outputs) > 1 { /* set not q if passed */
+          s.setWire(gate.Outputs[1].Id, true);
+        }
+      }
+    }
   }
+}
 
+// Run the given gates and wires until they reach a stable state, and return them.
+func Execute(gates []*Gate, wires []*Wire) ([]*Gate, []*Wire) {
+  NewSimulation(gates, wires).Settle()
   return gates, wires
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "strings"
+)
+
+// Find the first gate with the given label.
+func findGateByLabel(gates []*Gate, label string) *Gate {
+  for _, gate := range gates {
+    if gate.Label == label {
+      return gate
+    }
+  }
+  return nil
+}
+
+func TestExecuteAndGate(t *testing.T) {
+  summary, err := RunString("led(toggle() and toggle())", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // Both toggles are off, so the led should be off.
+  gates, _ := Execute(summary.Gates, summary.Wires)
+  if led := findGateByLabel(gates, "led"); led.State != "off" {
+    t.Errorf("Led should be off, is %s", led.State)
+  }
+
+  // Turn both toggles on, and the led should turn on.
+  for _, gate := range gates {
+    if gate.Label == "toggle" {
+      gate.State = "on"
+    }
+  }
+  gates, _ = Execute(gates, summary.Wires)
+  if led := findGateByLabel(gates, "led"); led.State != "on" {
+    t.Errorf("Led should be on, is %s", led.State)
+  }
+}
+
+func TestExecuteTwoInputGates(t *testing.T) {
+  for operator, expected := range map[string][]string{
+    // The led's state for each combination of toggles: off off, off on, on off, on on.
+    "and": []string{"off", "off", "off", "on"},
+    "or": []string{"off", "on", "on", "on"},
+    "xor": []string{"off", "on", "on", "off"},
+    "nand": []string{"on", "on", "on", "off"},
+    "nor": []string{"on", "off", "off", "off"},
+    "xnor": []string{"on", "off", "off", "on"},
+  } {
+    summary, err := RunString(fmt.Sprintf("led(toggle() %s toggle())", operator), false)
+    if err != nil {
+      t.Errorf(fmt.Sprintf("Error returned! %s", err))
+      return
+    }
+
+    for row, state := range expected {
+      toggles := 0
+      for _, gate := range summary.Gates {
+        if gate.Label == "toggle" {
+          if row & (2 >> uint(toggles)) != 0 {
+            gate.State = "on"
+          } else {
+            gate.State = "off"
+          }
+          toggles += 1
+        }
+      }
+
+      gates, _ := Execute(summary.Gates, summary.Wires)
+      if led := findGateByLabel(gates, "led"); led.State != state {
+        t.Errorf("Row %d of %s: led should be %s, is %s", row, operator, state, led.State)
+      }
+    }
+  }
+}
+
+func TestExecuteManyInputGates(t *testing.T) {
+  for operator, expected := range map[string][]string{
+    // The led's state for each number of toggles that are on, from zero to three.
+    "and": []string{"off", "off", "off", "on"},
+    "or": []string{"off", "on", "on", "on"},
+    "xor": []string{"off", "on", "off", "on"},
+    "nand": []string{"on", "on", "on", "off"},
+    "nor": []string{"on", "off", "off", "off"},
+    "xnor": []string{"on", "off", "on", "off"},
+  } {
+    summary, err := RunString("led(toggle() toggle() toggle())", false)
+    if err != nil {
+      t.Errorf(fmt.Sprintf("Error returned! %s", err))
+      return
+    }
+
+    // Feed all three toggles into a single gate.
+    led := findGateByLabel(summary.Gates, "led")
+    output := &Wire{Id: 100}
+    summary.Gates = append(summary.Gates, &Gate{Id: 100, Type: GateType(strings.ToUpper(operator)), Inputs: led.Inputs, Outputs: []*Wire{output}})
+    summary.Wires = append(summary.Wires, output)
+    led.Inputs = []*Wire{output}
+
+    for on, state := range expected {
+      toggles := 0
+      for _, gate := range summary.Gates {
+        if gate.Label == "toggle" {
+          if toggles < on {
+            gate.State = "on"
+          } else {
+            gate.State = "off"
+          }
+          toggles += 1
+        }
+      }
+
+      gates, _ := Execute(summary.Gates, summary.Wires)
+      if led := findGateByLabel(gates, "led"); led.State != state {
+        t.Errorf("%d inputs of %s on: led should be %s, is %s", on, operator, state, led.State)
+      }
+    }
+  }
+}
+
+// `and` binds more tightly than `or`, so `1 or 0 and 0` is on. Without precedence, it would be off.
+func TestExecuteOperatorPrecedence(t *testing.T) {
+  summary, err := RunString("led(1 or 0 and 0)\nled(not 1 and 0 or 1)\nled(0 xor 1 or 1 and 0)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  gates, _ := Execute(summary.Gates, summary.Wires)
+  for _, gate := range gates {
+    if gate.Label == "led" && gate.State != "on" {
+      t.Errorf("Led should be on, is %s", gate.State)
+    }
+  }
+}
+
+// Chained flip flops should only toggle the second flip flop on every other clock pulse.
+func TestExecuteChainedFlipFlops(t *testing.T) {
+  summary, err := RunString(`
+    import counter
+    let a b c d = counter8(momentary() 0)
+    led(a) led(b) led(c) led(d)
+  `, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  clock := findGateByLabel(summary.Gates, "momentary")
+  simulation := NewSimulation(summary.Gates, summary.Wires)
+  simulation.Settle()
+
+  for pulse := 1; pulse <= 10; pulse++ {
+    // Press and release the clock button.
+    for _, state := range []string{"on", "off"} {
+      clock.State = state
+      for index, gate := range summary.Gates {
+        if gate == clock {
+          simulation.MarkDirty(index)
+        }
+      }
+      simulation.Settle()
+    }
+
+    // Read the value of the counter from the leds.
+    value := 0
+    place := 1
+    for _, gate := range summary.Gates {
+      if gate.Label == "led" {
+        if gate.State == "on" {
+          value += place
+        }
+        place *= 2
+      }
+    }
+
+    if value != pulse {
+      t.Errorf("After %d clock pulses, counter is at %d", pulse, value)
+    }
+  }
+}
+
+// A circuit that never stabilizes should still return.
+func TestExecuteOscillatingCircuit(t *testing.T) {
+  summary, err := RunString("let a = (not a)\nled(a)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if NewSimulation(summary.Gates, summary.Wires).Settle() {
+    t.Error("Oscillating circuit reported that it was stable!")
+  }
+}
+
+// A wave should be able to drive a counter without any user input.
+func TestExecuteWaveDrivesCounter(t *testing.T) {
+  summary, err := RunString(`
+    import counter
+    let a b c d = counter8(wave(1 4 1) 0)
+    led(a) led(b) led(c) led(d)
+  `, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  simulation := NewSimulation(summary.Gates, summary.Wires)
+  simulation.Settle()
+
+  // The wave is on for the first tick of every four, so the counter should increment once every four
+  // ticks.
+  for tick := 1; tick <= 40; tick++ {
+    simulation.Tick()
+
+    value := 0
+    place := 1
+    for _, gate := range summary.Gates {
+      if gate.Label == "led" {
+        if gate.State == "on" {
+          value += place
+        }
+        place *= 2
+      }
+    }
+
+    if expected := (tick / 4 + 1) % 16; value != expected {
+      t.Errorf("After %d ticks, counter is at %d (expected %d)", tick, value, expected)
+    }
+  }
+}
+
+func TestExecuteDisabledWaveStaysOff(t *testing.T) {
+  summary, err := RunString("led(wave(0))", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  simulation := NewSimulation(summary.Gates, summary.Wires)
+  for tick := 0; tick < 5; tick++ {
+    simulation.Tick()
+    if led := findGateByLabel(summary.Gates, "led"); led.State != "off" {
+      t.Errorf("Led attached to a disabled wave turned on after %d ticks", tick)
+    }
+  }
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// Blocks can be parameterized by integers that are known at compile time, like the width of the
+// buses that they accept:
+//
+//   block reverse<N>(a[N]) { ... }
+//   reverse<8>(byte)
+//
+// These integers are called constants. Each time a block with constants is invoked, its content is
+// copied with each constant replaced by its value (see `instantiateBlock`). Constants can be used
+// anywhere that an integer can be, including within bus widths and indexes (`a[N-1]`), and as the
+// constants passed to other blocks (`reverse<N*2>(a a)`).
+//
+// Constants can also control which parts of a block are compiled, with `for` and `if` (see
+// `unrollGenerate`):
+//
+//   for i in 0..N {
+//     led(a[i])
+//   }
+//   if N == 1 { ... } else { ... }
+
+// Matches each part of a constant expression: integers, names of constants, and operators.
+var MATCH_CONSTANT_EXPRESSION_PART *regexp.Regexp = regexp.MustCompile(`\s*([0-9]+|[A-Za-z_][A-Za-z0-9_]*|[-+*/%])`)
+
+// Evaluate an expression made of integers and constants, joined by `+`, `-`, `*`, `/`, and `%`.
+// `*`, `/`, and `%` are evaluated before `+` and `-`. Division rounds down.
+func evaluateConstant(expression string, constants map[string]int) (int, error) {
+  var parts []string
+  rest := expression
+  for len(strings.TrimSpace(rest)) > 0 {
+    match := MATCH_CONSTANT_EXPRESSION_PART.FindStringSubmatchIndex(rest)
+    if match == nil || match[0] != 0 {
+      return 0, errors.New(fmt.Sprintf("`%s` isn't a valid constant expression", expression))
+    }
+    parts = append(parts, rest[match[2]:match[3]])
+    rest = rest[match[1]:]
+  }
+
+  // Read a single integer or constant from the start of `parts`.
+  value := func() (int, error) {
+    if len(parts) == 0 {
+      return 0, errors.New(fmt.Sprintf("`%s` isn't a valid constant expression", expression))
+    }
+    part := parts[0]
+    parts = parts[1:]
+
+    if integer, err := strconv.Atoi(part); err == nil {
+      return integer, nil
+    }
+    if constant, ok := constants[part]; ok {
+      return constant, nil
+    }
+    return 0, errors.New(fmt.Sprintf("The constant %s in `%s` isn't defined", part, expression))
+  }
+
+  // Read a series of values multiplied or divided together from the start of `parts`.
+  product := func() (int, error) {
+    result, err := value()
+    for err == nil && len(parts) > 0 && (parts[0] == "*" || parts[0] == "/" || parts[0] == "%") {
+      operator := parts[0]
+      parts = parts[1:]
+
+      var next int
+      next, err = value()
+      if err != nil {
+        break
+      }
+
+      switch operator {
+      case "*":
+        result *= next
+      case "/", "%":
+        if next == 0 {
+          return 0, errors.New(fmt.Sprintf("`%s` divides by zero", expression))
+        }
+        if operator == "/" {
+          result /= next
+        } else {
+          result %= next
+        }
+      }
+    }
+    return result, err
+  }
+
+  result, err := product()
+  for err == nil && len(parts) > 0 && (parts[0] == "+" || parts[0] == "-") {
+    operator := parts[0]
+    parts = parts[1:]
+
+    var next int
+    next, err = product()
+    if operator == "+" {
+      result += next
+    } else {
+      result -= next
+    }
+  }
+  if err != nil {
+    return 0, err
+  }
+  if len(parts) > 0 {
+    return 0, errors.New(fmt.Sprintf("`%s` isn't a valid constant expression", expression))
+  }
+  return result, nil
+}
+
+// Matches a comparison between two constant expressions, like `N == 0`.
+var MATCH_CONSTANT_CONDITION *regexp.Regexp = regexp.MustCompile(`^(.+?)\s*(==|!=|<=|>=|<|>)\s*(.+)$`)
+
+// Evaluate a comparison between two constant expressions, like `N == 0` or `N*2 > WIDTH`.
+func evaluateCondition(condition string, constants map[string]int) (bool, error) {
+  match := MATCH_CONSTANT_CONDITION.FindStringSubmatch(strings.TrimSpace(condition))
+  if match == nil {
+    return false, errors.New(fmt.Sprintf(
+      "`%s` isn't a valid condition, expected a comparison like `N == 0`",
+      condition,
+    ))
+  }
+
+  left, err := evaluateConstant(match[1], constants)
+  if err != nil {
+    return false, err
+  }
+  right, err := evaluateConstant(match[3], constants)
+  if err != nil {
+    return false, err
+  }
+
+  switch match[2] {
+  case "==": return left == right, nil
+  case "!=": return left != right, nil
+  case "<=": return left <= right, nil
+  case ">=": return left >= right, nil
+  case "<": return left < right, nil
+  default: return left > right, nil
+  }
+}
+
+// Is the token a `for`, `if`, or `else`?
+func TokenNameIsGenerate(name string) bool {
+  return name == "GENERATE_FOR" || name == "GENERATE_IF" || name == "GENERATE_ELSE"
+}
+
+// Expand the `for` or `if` at the start of `nodes` into the nodes that it generates:
+// - `for i in 0..N { ... }` repeats its content for each `i` from 0 up to (but not including) N.
+//   Within each repetition, `i` is a constant.
+// - `if N == 0 { ... } else { ... }` is replaced by the content of the branch that the condition
+//   picks. The other branch is never compiled, so it can invoke the block that it's within without
+//   recursing forever.
+// Returns the generated nodes, and the number of nodes at the start of `nodes` that they replace (an
+// `if` that is followed by an `else` replaces both).
+func (c *Compiler) unrollGenerate(nodes []Node, constants map[string]int) ([]Node, int, error) {
+  node := nodes[0]
+
+  // Errors are reported at the `for` or `if`.
+  fail := func(err error) ([]Node, int, error) {
+    return nil, 0, NewNodeError(INVALID_ARGUMENT, node, fmt.Sprintf(
+      "Error: %s, at %s. Stop.",
+      err,
+      formatPosition(node.File, node.Line, node.Col),
+    ))
+  }
+
+  switch data := node.Data.(type) {
+  case *ForLoop:
+    start, err := evaluateConstant(data.Start, constants)
+    if err != nil {
+      return fail(err)
+    }
+    end, err := evaluateConstant(data.End, constants)
+    if err != nil {
+      return fail(err)
+    }
+
+    // Check the limit before unrolling anything, so that a huge loop fails right away.
+    if end > start {
+      c.unrolledIterations += end - start
+    }
+    if c.MaxUnrolledIterations > 0 && c.unrolledIterations > c.MaxUnrolledIterations {
+      return nil, 0, NewNodeError(MAX_UNROLLED_ITERATIONS, node, fmt.Sprintf(
+        "The for loop at %s repeats its content %d times, which would surpass the max of %d repetitions in a program. Stop.",
+        formatPosition(node.File, node.Line, node.Col),
+        end - start,
+        c.MaxUnrolledIterations,
+      ))
+    }
+
+    unrolled := []Node{}
+    for i := start; i < end; i++ {
+      iteration := map[string]int{data.Variable: i}
+      for name, value := range constants {
+        if _, ok := iteration[name]; !ok {
+          iteration[name] = value
+        }
+      }
+
+      body, err := c.substituteChildren(*node.Children, iteration)
+      if err != nil {
+        return nil, 0, err
+      }
+      unrolled = append(unrolled, body...)
+    }
+    return unrolled, 1, nil
+
+  case *IfBranch:
+    condition, err := evaluateCondition(data.Condition, constants)
+    if err != nil {
+      return fail(err)
+    }
+
+    consumed := 1
+    branch := []Node{}
+    if condition {
+      branch = *node.Children
+    }
+    if len(nodes) > 1 && nodes[1].Token == "GENERATE_ELSE" {
+      consumed = 2
+      if !condition {
+        branch = *nodes[1].Children
+      }
+    }
+
+    unrolled, err := c.substituteChildren(branch, constants)
+    if err != nil {
+      return nil, 0, err
+    }
+    return unrolled, consumed, nil
+
+  default:
+    return nil, 0, NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf(
+      "The else at %s doesn't follow an if. Stop.",
+      formatPosition(node.File, node.Line, node.Col),
+    ))
+  }
+}
+
+// Copy a list of nodes, replacing each constant with its value and expanding each `for` and `if`.
+func (c *Compiler) substituteChildren(nodes []Node, constants map[string]int) ([]Node, error) {
+  substituted := []Node{}
+  for index := 0; index < len(nodes); {
+    if TokenNameIsGenerate(nodes[index].Token) {
+      unrolled, consumed, err := c.unrollGenerate(nodes[index:], constants)
+      if err != nil {
+        return nil, err
+      }
+      substituted = append(substituted, unrolled...)
+      index += consumed
+      continue
+    }
+
+    node, err := c.substituteConstants(nodes[index], constants)
+    if err != nil {
+      return nil, err
+    }
+    substituted = append(substituted, node)
+    index += 1
+  }
+  return substituted, nil
+}
+
+// Expand each `for` and `if` within a list of nodes that are parsed one at a time, like the content
+// of a group or the arguments to an invocation. Generates there produce values, like
+// `(for i in 0..4 { not a[i] })`.
+func (c *Compiler) expandGenerates(nodes []Node) ([]Node, error) {
+  for _, node := range nodes {
+    if TokenNameIsGenerate(node.Token) {
+      return c.substituteChildren(nodes, nil)
+    }
+  }
+  return nodes, nil
+}
+
+// Matches the width or index of a bus, like the `[N-1]` in `a[N-1]`.
+var MATCH_BUS_WIDTH *regexp.Regexp = regexp.MustCompile(`\[([^\]:]+)(?::([^\]]+))?]`)
+
+// Replace each bus width or index within a name with its value, so `a[N]` becomes `a[8]` when N is 8.
+func substituteBusWidths(name string, constants map[string]int) (string, error) {
+  var err error
+  substituted := MATCH_BUS_WIDTH.ReplaceAllStringFunc(name, func(width string) string {
+    match := MATCH_BUS_WIDTH.FindStringSubmatch(width)
+
+    start, startErr := evaluateConstant(match[1], constants)
+    if startErr != nil {
+      err = startErr
+      return width
+    }
+    if len(match[2]) == 0 {
+      return fmt.Sprintf("[%d]", start)
+    }
+
+    end, endErr := evaluateConstant(match[2], constants)
+    if endErr != nil {
+      err = endErr
+      return width
+    }
+    return fmt.Sprintf("[%d:%d]", start, end)
+  })
+  return substituted, err
+}
+
+// Expand the parameters of a block, so that each bus is replaced by a parameter for every wire in
+// it. For example, `a b[2]` is expanded into `a b0 b1`. Returns the expanded parameters and the
+// width of each bus.
+func expandBlockParams(params string, constants map[string]int) ([]string, map[string]int, error) {
+  var expanded []string
+  buses := map[string]int{}
+  for _, param := range strings.Fields(params) {
+    param, err := substituteBusWidths(param, constants)
+    if err != nil {
+      return nil, nil, err
+    }
+
+    if name, width, ok := parseBusDeclaration(param); ok {
+      // A bus without any wires (ie, `a[N]` when N is 0) would leave `a[0]` to be declared as an
+      // undriven wire within the block.
+      if width < 1 {
+        return nil, nil, errors.New(fmt.Sprintf("Parameter %s must be at least one wire wide", param))
+      }
+      if err := checkBusWidth(name, width); err != nil {
+        return nil, nil, err
+      }
+      for i := 0; i < width; i++ {
+        expanded = append(expanded, busWireName(name, i))
+      }
+      buses[name] = width
+    } else if strings.Contains(param, "[") {
+      return nil, nil, errors.New(fmt.Sprintf("Parameter %s isn't a valid bus", param))
+    } else {
+      expanded = append(expanded, param)
+    }
+  }
+  return expanded, buses, nil
+}
+
+// Copy the content of a block that accepts constants, replacing each constant with the value that
+// the invocation passed for it. Returns the copy, along with a name for the block that includes the
+// values of its constants, like `adder<8>`.
+func (c *Compiler) instantiateBlock(block *Block, invocation Node) (*Node, string, error) {
+  names := strings.Fields(block.Declaration().Constants)
+  arguments := strings.Fields(invocation.Data.(*Invocation).Constants)
+  if len(names) == 0 && len(arguments) == 0 {
+    return block.Content, block.Name, nil
+  }
+
+  if len(names) != len(arguments) {
+    return nil, "", NewNodeError(ARITY_ERROR, invocation, fmt.Sprintf(
+      "The invocation at %s passes %d constants to block %s, which accepts %d. Stop.",
+      formatPosition(invocation.File, invocation.Line, invocation.Col),
+      len(arguments),
+      block.Name,
+      len(names),
+    ))
+  }
+
+  // Any constants in the arguments have already been substituted by the block that contains the
+  // invocation, so the arguments are all integers by now.
+  constants := map[string]int{}
+  for index, name := range names {
+    value, err := evaluateConstant(arguments[index], nil)
+    if err != nil {
+      return nil, "", NewNodeError(INVALID_ARGUMENT, invocation, fmt.Sprintf(
+        "Error: %s, at %s. Stop.",
+        err,
+        formatPosition(invocation.File, invocation.Line, invocation.Col),
+      ))
+    }
+    constants[name] = value
+  }
+
+  content, err := c.substituteConstants(*block.Content, constants)
+  if err != nil {
+    return nil, "", err
+  }
+
+  // Now that the constants are known, the parameters can be expanded.
+  declaration := content.Data.(*BlockDecl)
+  params, buses, err := expandBlockParams(declaration.Params, constants)
+  if err != nil {
+    // The parameters depend on the constants that were passed, so the invocation is at fault.
+    return nil, "", NewNodeError(INVALID_ARGUMENT, invocation, fmt.Sprintf(
+      "Error: %s, in block %s invoked at %s. Stop.",
+      err,
+      block.Name,
+      formatPosition(invocation.File, invocation.Line, invocation.Col),
+    ))
+  }
+  declaration.Params = strings.Join(params, " ")
+  declaration.Buses = buses
+  declaration.InputQuantity = len(params)
+
+  var values []string
+  for _, name := range names {
+    values = append(values, strconv.Itoa(constants[name]))
+  }
+  return &content, fmt.Sprintf("%s<%s>", block.Name, strings.Join(values, " ")), nil
+}
+
+// Copy a node and everything within it, replacing each constant with its value.
+func (c *Compiler) substituteConstants(node Node, constants map[string]int) (Node, error) {
+  if node.Data != nil {
+    node.Data = node.Data.copyData()
+  }
+
+  // Errors are reported at the node that contains the constant.
+  fail := func(err error) (Node, error) {
+    return node, NewNodeError(INVALID_ARGUMENT, node, fmt.Sprintf(
+      "Error: %s, at %s. Stop.",
+      err,
+      formatPosition(node.File, node.Line, node.Col),
+    ))
+  }
+
+  switch data := node.Data.(type) {
+  case *Identifier:
+    // A constant that is used on its own is an integer, ie, `wave(enable N)`.
+    if value, ok := constants[data.Value]; ok {
+      node.Token = "INTEGER"
+      node.Data = &Integer{Value: value}
+    }
+
+  case *BusIndex:
+    if err := data.resolve(constants); err != nil {
+      return fail(err)
+    }
+    if data.End <= data.Start {
+      return fail(errors.New(fmt.Sprintf("Slice %s[%d:%d] must end after it starts", data.Name, data.Start, data.End)))
+    }
+
+  case *Assignment:
+    names, err := substituteBusWidths(data.Names, constants)
+    if err != nil {
+      return fail(err)
+    }
+    data.Names = names
+
+  case *Invocation:
+    var values []string
+    for _, argument := range strings.Fields(data.Constants) {
+      value, err := evaluateConstant(argument, constants)
+      if err != nil {
+        return fail(err)
+      }
+      values = append(values, strconv.Itoa(value))
+    }
+    data.Constants = strings.Join(values, " ")
+
+  case *BinaryExpr:
+    for _, operand := range []**Node{&data.LeftHandSide, &data.RightHandSide} {
+      if *operand == nil {
+        continue
+      }
+      substituted, err := c.substituteConstants(**operand, constants)
+      if err != nil {
+        return node, err
+      }
+      *operand = &substituted
+    }
+
+  case *UnaryExpr:
+    if data.RightHandSide != nil {
+      substituted, err := c.substituteConstants(*data.RightHandSide, constants)
+      if err != nil {
+        return node, err
+      }
+      data.RightHandSide = &substituted
+    }
+  }
+
+  if node.Children != nil {
+    children, err := c.substituteChildren(*node.Children, constants)
+    if err != nil {
+      return node, err
+    }
+    node.Children = &children
+  }
+
+  return node, nil
+}
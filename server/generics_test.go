@@ -0,0 +1,302 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "reflect"
+  "strings"
+)
+
+func TestEvaluateConstant(t *testing.T) {
+  constants := map[string]int{"N": 4, "WIDTH": 8}
+  for expression, expected := range map[string]int{
+    "3": 3,
+    "N": 4,
+    "N-1": 3,
+    "N - 1": 3,
+    "2+3*4": 14,
+    "WIDTH*2-N": 12,
+  } {
+    if value, err := evaluateConstant(expression, constants); err != nil || value != expected {
+      t.Errorf("%s should be %d, got %d (%v)", expression, expected, value, err)
+    }
+  }
+
+  for expression, expected := range map[string]string{
+    "M": "The constant M in `M` isn't defined",
+    "N+": "`N+` isn't a valid constant expression",
+    "N$": "`N$` isn't a valid constant expression",
+  } {
+    if _, err := evaluateConstant(expression, constants); err == nil || err.Error() != expected {
+      t.Errorf("%s should fail with %q, got %v", expression, expected, err)
+    }
+  }
+}
+
+func TestTokenizeBlockWithConstants(t *testing.T) {
+  result, err := Tokenizer("block last<N>(a[N]) {\n  return a[N-1]\n}\nlast<4>(x)")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{
+      Token: "BLOCK",
+      Line: 1,
+      Col: 1,
+      Data: &BlockDecl{
+        Name: "last",
+        Constants: "N",
+        Params: "a[N]",
+        Buses: map[string]int{},
+        InputQuantity: 0,
+        OutputQuantity: 1,
+      },
+      Children: &[]Node{
+        Node{Token: "BLOCK_RETURN", Line: 2, Col: 3},
+        Node{Token: "BUS_INDEX", Line: 2, Col: 10, Data: &BusIndex{Name: "a", StartExpression: "N-1", EndExpression: "N-1+1"}},
+      },
+    },
+    Node{Token: "INVOCATION", Line: 4, Col: 1, Data: &Invocation{Name: "last", Constants: "4"}, Children: &[]Node{
+      Node{Token: "IDENTIFIER", Line: 4, Col: 9, Data: &Identifier{Value: "x"}},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+const GENERICS_TEST_SOURCE = `
+block last<N>(a[N]) {
+  return a[N-1]
+}
+block reverse2<N>(a[N] b[N]) {
+  return b a
+}
+block lastofboth<N>(a[N] b[N]) {
+  let both[N*2] = reverse2<N>(a b)
+  return last<N*2>(both)
+}
+let nibble[4] = 0 0 0 1
+let byte[8] = 1 0 0 0 0 0 0 0
+led(last<4>(nibble))
+led(last<8>(byte))
+led(lastofboth<4>(nibble nibble[0:1] nibble[0:1] nibble[0:1] nibble[0:1]))
+`
+
+func TestInvokeBlockWithConstants(t *testing.T) {
+  states := ledStates(t, GENERICS_TEST_SOURCE)
+  if strings.Join(states, " ") != "on off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+
+  summary, err := RunString(GENERICS_TEST_SOURCE, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // Each invocation is named after the values of its constants.
+  var names []string
+  for _, context := range summary.Contexts {
+    names = append(names, context.Name)
+  }
+  if strings.Join(names, " ") != "last<4> last<8> lastofboth<4> reverse2<4> last<8>" {
+    t.Errorf("Contexts don't match! %v", names)
+  }
+}
+
+func TestConstantUsedAsInteger(t *testing.T) {
+  summary, err := RunString("block clock<PERIOD>(enable) {\n  return wave(enable PERIOD)\n}\nled(clock<4>(1))", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+  if wave := findGateByLabel(summary.Gates, "wave"); wave.State != formatWaveState(0, 4, 2) {
+    t.Errorf("Wave has the wrong state: %s", wave.State)
+  }
+}
+
+func TestConstantErrors(t *testing.T) {
+  for _, test := range []struct{
+    Source string
+    Code ErrorCode
+    Error string
+  }{
+    {
+      "block last<N>(a[N]) {\n  return a[N-1]\n}\nled(last<2 3>(1 1))",
+      ARITY_ERROR,
+      "The invocation at 4:5 passes 2 constants to block last, which accepts 1. Stop.",
+    },
+    {
+      "block last<N>(a[N]) {\n  return a[N-1]\n}\nlet bus[4] = 1 0 1 0\nled(last<2>(bus))",
+      ARITY_ERROR,
+      "The 4 bit bus passed to block last<2> at 5:13 doesn't match the width of parameter a (2 bits). Stop.",
+    },
+    {
+      "block last<N>(a[N]) {\n  return a[M]\n}\nled(last<2>(1 1))",
+      INVALID_ARGUMENT,
+      "Error: The constant M in `M` isn't defined, at 2:10. Stop.",
+    },
+    {
+      "let bus[4] = 1 0 1 0\nled(bus[N])",
+      INVALID_ARGUMENT,
+      "Error: The constant N in `N` isn't defined, at 2:5. Stop.",
+    },
+  } {
+    _, err := RunString(test.Source, false)
+    if err == nil {
+      t.Errorf("Compiling %q didn't return an error", test.Source)
+      continue
+    }
+    if err.Error() != test.Error {
+      t.Errorf("Compiling %q returned the wrong error: %q", test.Source, err.Error())
+    }
+    if compileErr, ok := err.(*CompileError); !ok || compileErr.Code != test.Code {
+      t.Errorf("Compiling %q returned the wrong code: %+v", test.Source, err)
+    }
+  }
+}
+
+func TestEvaluateCondition(t *testing.T) {
+  constants := map[string]int{"N": 4}
+  for condition, expected := range map[string]bool{
+    "N == 4": true,
+    "N != 4": false,
+    "N/2 < 2": false,
+    "N%3 <= 1": true,
+    "N*2 > 7": true,
+    "0 >= N": false,
+  } {
+    result, err := evaluateCondition(condition, constants)
+    if err != nil {
+      t.Errorf("Evaluating %q returned an error: %s", condition, err)
+    } else if result != expected {
+      t.Errorf("Evaluating %q returned %t, expected %t", condition, result, expected)
+    }
+  }
+
+  for _, condition := range []string{"N", "N = 4", "M == 1"} {
+    if _, err := evaluateCondition(condition, constants); err == nil {
+      t.Errorf("Evaluating %q didn't return an error", condition)
+    }
+  }
+}
+
+func TestForLoop(t *testing.T) {
+  states := ledStates(t, "let bus[4] = 1 0 0 1\nfor i in 0..4 {\n  led(bus[3-i])\n}")
+  if strings.Join(states, " ") != "on off off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestForLoopWithinGroup(t *testing.T) {
+  states := ledStates(t, `
+    block invert<N>(a[N]) {
+      return (for i in 0..N { not a[i] })
+    }
+    let bus[3] = 1 0 0
+    let inverted[3] = invert<3>(bus)
+    led(inverted[0])
+    led(inverted[1])
+    led(inverted[2])
+  `)
+  if strings.Join(states, " ") != "off on on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestIfElse(t *testing.T) {
+  states := ledStates(t, `
+    block pick<N>(a b) {
+      if N == 0 {
+        return a
+      } else {
+        return b
+      }
+    }
+    if 1 > 2 {
+      led(1)
+    }
+    led(pick<0>(1 0))
+    led(pick<1>(1 0))
+  `)
+  if strings.Join(states, " ") != "on off" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestTerminatingRecursion(t *testing.T) {
+  // A tree of or gates, which is split in half until each half is a single wire.
+  source := `
+    block any<N>(a[N]) {
+      if N == 1 {
+        return a[0]
+      } else {
+        return any<N/2>(a[0:N/2]) or any<N-N/2>(a[N/2:N])
+      }
+    }
+    let none[5] = 0 0 0 0 0
+    let one[5] = 0 0 0 1 0
+    led(any<5>(none))
+    led(any<5>(one))
+  `
+  states := ledStates(t, source)
+  if strings.Join(states, " ") != "off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+
+  // Combining 5 wires takes four or gates, and each is within its own invocation of `any`.
+  summary, _ := RunString(source, false)
+  if ors := len(findGatesByType(summary.Gates, OR)); ors != 8 {
+    t.Errorf("Expected 8 or gates, found %d", ors)
+  }
+}
+
+func TestGenerateErrors(t *testing.T) {
+  for _, test := range []struct{
+    Source string
+    Code ErrorCode
+    Error string
+  }{
+    {
+      "else {\n  led(1)\n}",
+      VALIDATION_ERROR,
+      "The else at 1:1 doesn't follow an if. Stop.",
+    },
+    {
+      "for i in 0..N {\n  led(1)\n}",
+      INVALID_ARGUMENT,
+      "Error: The constant N in `N` isn't defined, at 1:1. Stop.",
+    },
+    {
+      "block first<N>(a[N]) {\n  if N {\n    return a[0]\n  }\n}\nled(first<2>(1 0))",
+      INVALID_ARGUMENT,
+      "Error: `N` isn't a valid condition, expected a comparison like `N == 0`, at 2:3. Stop.",
+    },
+    {
+      "block f<N>(a[N]) {\n  return a[0]\n}\nled(f<0>())",
+      INVALID_ARGUMENT,
+      "Error: Parameter a[0] must be at least one wire wide, in block f invoked at 4:5. Stop.",
+    },
+    {
+      "for i in 0..100000000 {\n  led(1)\n}",
+      MAX_UNROLLED_ITERATIONS,
+      "The for loop at 1:1 repeats its content 100000000 times, which would surpass the max of 100000 repetitions in a program. Stop.",
+    },
+    {
+      // Each loop is small, but together they repeat their content too many times.
+      "for i in 0..1000 {\n  for j in 0..1000 {\n    led(1)\n  }\n}",
+      MAX_UNROLLED_ITERATIONS,
+      "The for loop at 2:3 repeats its content 1000 times, which would surpass the max of 100000 repetitions in a program. Stop.",
+    },
+  } {
+    _, err := RunString(test.Source, false)
+    if err == nil {
+      t.Errorf("Compiling %q didn't return an error", test.Source)
+      continue
+    }
+    if err.Error() != test.Error {
+      t.Errorf("Compiling %q returned the wrong error: %q", test.Source, err.Error())
+    }
+    if compileErr, ok := err.(*CompileError); !ok || compileErr.Code != test.Code {
+      t.Errorf("Compiling %q returned the wrong code: %+v", test.Source, err)
+    }
+  }
+}
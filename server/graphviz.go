@@ -0,0 +1,136 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "bytes"
+)
+
+// The mime type that is used to request a graphviz graph from `/v1/compile`.
+const GRAPHVIZ_MIME_TYPE = "text/vnd.graphviz"
+
+// Convert a compiled summary into a graphviz DOT graph. Each gate is a node, each wire is an edge
+// from the gate that drives it to every gate that reads from it, and the gates within each block
+// invocation are grouped into a cluster.
+func ExportGraphviz(summary *Summary) string {
+  var output bytes.Buffer
+  output.WriteString("digraph lovelace {\n")
+  output.WriteString("  rankdir=LR;\n")
+  output.WriteString("  node [fontname=\"monospace\"];\n")
+
+  // Group gates by the calling context they are in.
+  gatesByContext := map[int][]*Gate{}
+  for _, gate := range summary.Gates {
+    gatesByContext[gate.CallingContext] = append(gatesByContext[gate.CallingContext], gate)
+  }
+  contextsById := map[int]*CallingContext{}
+  for _, context := range summary.Contexts {
+    contextsById[context.Id] = context
+  }
+
+  // Write gates in the top level context, and then recursively write each block invocation as a
+  // cluster.
+  for _, gate := range gatesByContext[0] {
+    writeGraphvizGate(&output, gate, 1)
+  }
+  for _, context := range summary.Contexts {
+    if context.Parent == 0 {
+      writeGraphvizContext(&output, context, contextsById, gatesByContext, 1)
+    }
+  }
+
+  // Find the gate that drives each wire.
+  drivers := map[int][]*Gate{}
+  for _, gate := range summary.Gates {
+    for _, wire := range gate.Outputs {
+      drivers[wire.Id] = append(drivers[wire.Id], gate)
+    }
+  }
+
+  // Then, draw an edge from the driver of each wire to each gate that reads from it.
+  danglingWires := map[int]bool{}
+  for _, gate := range summary.Gates {
+    for _, wire := range gate.Inputs {
+      if len(drivers[wire.Id]) == 0 {
+        // Nothing drives this wire (ie, it's an implicitly declared variable that was never
+        // assigned), so draw the wire as a dangling point.
+        if !danglingWires[wire.Id] {
+          danglingWires[wire.Id] = true
+          fmt.Fprintf(&output, "  w%d [shape=point];\n", wire.Id)
+        }
+        fmt.Fprintf(&output, "  w%d -> g%d [label=\"w%d\"];\n", wire.Id, gate.Id, wire.Id)
+        continue
+      }
+
+      for _, driver := range drivers[wire.Id] {
+        fmt.Fprintf(&output, "  g%d -> g%d [label=\"w%d\"];\n", driver.Id, gate.Id, wire.Id)
+      }
+    }
+  }
+
+  output.WriteString("}\n")
+  return output.String()
+}
+
+func writeGraphvizContext(
+  output *bytes.Buffer,
+  context *CallingContext,
+  contextsById map[int]*CallingContext,
+  gatesByContext map[int][]*Gate,
+  depth int,
+) {
+  indent := strings.Repeat("  ", depth)
+  fmt.Fprintf(output, "%ssubgraph cluster_%d {\n", indent, context.Id)
+  fmt.Fprintf(output, "%s  label=%s;\n", indent, graphvizQuote(fmt.Sprintf("%s (%d)", context.Name, context.Id)))
+
+  for _, gate := range gatesByContext[context.Id] {
+    writeGraphvizGate(output, gate, depth + 1)
+  }
+  for _, childId := range context.Children {
+    if child, ok := contextsById[childId]; ok {
+      writeGraphvizContext(output, child, contextsById, gatesByContext, depth + 1)
+    }
+  }
+
+  fmt.Fprintf(output, "%s}\n", indent)
+}
+
+func writeGraphvizGate(output *bytes.Buffer, gate *Gate, depth int) {
+  var label string
+  shape := "box"
+
+  switch gate.Type {
+  case SOURCE:
+    label = "1"
+    shape = "plaintext"
+  case GROUND:
+    label = "0"
+    shape = "plaintext"
+  case BLOCK_INPUT:
+    label = gate.Label
+    shape = "rarrow"
+  case BLOCK_OUTPUT:
+    label = gate.Label
+    shape = "larrow"
+  case BUILTIN_FUNCTION:
+    label = gate.Label
+    shape = "ellipse"
+  default:
+    label = string(gate.Type)
+  }
+
+  fmt.Fprintf(
+    output,
+    "%sg%d [label=%s, shape=%s];\n",
+    strings.Repeat("  ", depth),
+    gate.Id,
+    graphvizQuote(label),
+    shape,
+  )
+}
+
+func graphvizQuote(value string) string {
+  value = strings.Replace(value, `\`, `\\`, -1)
+  value = strings.Replace(value, `"`, `\"`, -1)
+  return `"` + value + `"`
+}
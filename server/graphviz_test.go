@@ -0,0 +1,45 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+)
+
+func TestExportGraphviz(t *testing.T) {
+  summary, err := RunString(`
+    block inverter(a) {
+      return (not a)
+    }
+    led(inverter(toggle()) and b)
+  `, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  expected := `digraph lovelace {
+  rankdir=LR;
+  node [fontname="monospace"];
+  g1 [label="toggle", shape=ellipse];
+  g5 [label="AND", shape=box];
+  g6 [label="led", shape=ellipse];
+  subgraph cluster_1 {
+    label="inverter (1)";
+    g2 [label="Input 0 into block inverter invocation 1", shape=rarrow];
+    g3 [label="NOT", shape=box];
+    g4 [label="Output 0 from block inverter invocation 1", shape=larrow];
+  }
+  g1 -> g2 [label="w1"];
+  g2 -> g3 [label="w2"];
+  g3 -> g4 [label="w3"];
+  g4 -> g5 [label="w4"];
+  w5 [shape=point];
+  w5 -> g5 [label="w5"];
+  g5 -> g6 [label="w6"];
+}
+`
+
+  if result := ExportGraphviz(summary); result != expected {
+    t.Errorf("Graph doesn't match!\n%s", result)
+  }
+}
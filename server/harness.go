@@ -0,0 +1,219 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "regexp"
+  "strings"
+)
+
+// Matches the name of a block that is simulated on its own, which can include the constants that
+// are passed to it, like `adder<4>`.
+var MATCH_HARNESS_BLOCK *regexp.Regexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)(?:<([^>]*)>)?$`)
+
+// A BlockHarness is a single invocation of a block, where each of the block's inputs is driven by a
+// switch so that the block can be simulated with any inputs. This is used to test blocks, and to
+// print their truth tables.
+type BlockHarness struct {
+  Name string
+
+  // The name of each input and output wire of the block. A wire within a bus parameter is named
+  // after its index, like `a[2]`.
+  Inputs []string
+  Outputs []string
+
+  Summary *Summary
+
+  simulation *Simulation
+  // The index within `Summary.Gates` of the switch that drives each input.
+  switches []int
+  outputs []*Wire
+}
+
+// Read and tokenize `path`, and then simulate the block called `name` within it.
+func (c *Compiler) HarnessFile(path string, name string) (*BlockHarness, error) {
+  source, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, &CompileError{
+      Code: FILE_ERROR,
+      Message: fmt.Sprintf("Error reading file %s: %s. Stop.\n", path, err),
+      File: path,
+    }
+  }
+
+  return c.harnessSource(string(source), path, name)
+}
+
+// Tokenize lovelace source, and then simulate the block called `name` within it.
+func (c *Compiler) HarnessString(input string, name string) (*BlockHarness, error) {
+  return c.harnessSource(input, "", name)
+}
+
+func (c *Compiler) harnessSource(input string, path string, name string) (*BlockHarness, error) {
+  nodes, err := NewModuleResolver().Tokenize(input, path)
+  if err != nil {
+    return nil, err
+  }
+  return c.Harness(*nodes, name, Node{File: path})
+}
+
+// Parse `nodes`, and then invoke the block called `name` with a switch connected to each of its
+// inputs. Errors that aren't within the source are reported at `at`.
+func (c *Compiler) Harness(nodes []Node, name string, at Node) (*BlockHarness, error) {
+  c.Warnings = nil
+  stack := []*StackFrame{ &StackFrame{} }
+  summary := &Summary{}
+
+  // Everything outside of the block is parsed too, so that the block can be invoked like it would be
+  // from the end of the source.
+  for len(nodes) > 0 {
+    gates, wires, contexts, _, err := c.Parse(&nodes, stack)
+    if err != nil {
+      return nil, err
+    }
+    summary.Gates = append(summary.Gates, gates...)
+    summary.Wires = append(summary.Wires, wires...)
+    summary.Contexts = append(summary.Contexts, contexts...)
+  }
+
+  match := MATCH_HARNESS_BLOCK.FindStringSubmatch(strings.TrimSpace(name))
+  if match == nil {
+    return nil, NewNodeError(INVALID_ARGUMENT, at, fmt.Sprintf("%s isn't the name of a block, like `halfadder` or `adder<4>`. Stop.", name))
+  }
+  block := findBlock(stack, match[1])
+  if block == nil {
+    return nil, NewNodeError(UNDEFINED_BLOCK, at, fmt.Sprintf("No block named %s could be found. Stop.", match[1]))
+  }
+
+  invocation := at
+  invocation.Token = "INVOCATION"
+  invocation.Data = &Invocation{Name: match[1], Constants: strings.Join(strings.Fields(match[2]), " ")}
+
+  // The parameters of a block with constants are only known once the constants are.
+  content, _, err := c.instantiateBlock(block, invocation)
+  if err != nil {
+    return nil, err
+  }
+
+  harness := &BlockHarness{Name: name}
+  arguments := []Node{}
+  for _, parameter := range blockParameters(&Block{Name: block.Name, Content: content}) {
+    for index := 0; index < parameter.Width; index++ {
+      wireName := parameter.Name
+      if parameter.IsBus {
+        wireName = fmt.Sprintf("%s[%d]", parameter.Name, index)
+      }
+
+      // Each input is connected to its own switch, which is bound to a variable that is passed to
+      // the block.
+      c.wireId += 1
+      wire := &Wire{Id: c.wireId, Desc: fmt.Sprintf("for input %s of %s", wireName, name)}
+      c.gateId += 1
+      summary.Gates = append(summary.Gates, &Gate{
+        Id: c.gateId,
+        Type: BUILTIN_FUNCTION,
+        Label: "toggle",
+        Inputs: []*Wire{},
+        Outputs: []*Wire{wire},
+        CallingContext: stack[0].Id,
+        State: "off",
+      })
+      summary.Wires = append(summary.Wires, wire)
+
+      variable := fmt.Sprintf("__input%d", len(harness.Inputs))
+      stack[0].Variables = append(stack[0].Variables, &Variable{Name: variable, Value: wire})
+      argument := invocation
+      argument.Token = "IDENTIFIER"
+      argument.Data = &Identifier{Value: variable}
+      arguments = append(arguments, argument)
+
+      harness.Inputs = append(harness.Inputs, wireName)
+      harness.switches = append(harness.switches, len(summary.Gates) - 1)
+    }
+  }
+  invocation.Children = &arguments
+
+  gates, wires, contexts, outputs, err := c.Parse(&[]Node{invocation}, stack)
+  if err != nil {
+    return nil, err
+  }
+  summary.Gates = append(summary.Gates, gates...)
+  summary.Wires = append(summary.Wires, wires...)
+  summary.Contexts = append(summary.Contexts, contexts...)
+  summary.Outputs = outputs
+
+  harness.Summary = summary
+  harness.Outputs = returnNames(*content, len(outputs))
+  harness.outputs = outputs
+  harness.simulation = NewSimulation(summary.Gates, summary.Wires)
+  return harness, nil
+}
+
+// Set the state of each input, and run the block until it's stable. Returns the state of each
+// output, or an error if the block didn't stabilize. The block keeps its state between calls, so
+// blocks with flip flops can be stepped through a sequence of inputs.
+func (h *BlockHarness) Evaluate(inputs []bool) ([]bool, error) {
+  if len(inputs) != len(h.Inputs) {
+    return nil, errors.New(fmt.Sprintf("%s has %d inputs, but %d were given", h.Name, len(h.Inputs), len(inputs)))
+  }
+
+  for index, value := range inputs {
+    gate := h.Summary.Gates[h.switches[index]]
+    if value {
+      gate.State = "on"
+    } else {
+      gate.State = "off"
+    }
+    h.simulation.MarkDirty(h.switches[index])
+  }
+
+  if !h.simulation.Settle() {
+    return nil, errors.New(fmt.Sprintf("%s didn't stabilize", h.Name))
+  }
+
+  outputs := []bool{}
+  for _, wire := range h.outputs {
+    outputs = append(outputs, h.simulation.getWire(wire.Id))
+  }
+  return outputs, nil
+}
+
+// The names of the outputs of a block, which are the names that the block returns when it returns
+// only variables (like `return sum carry`), or `out0`, `out1`, and so on otherwise.
+func returnNames(content Node, count int) []string {
+  names := []string{}
+  returned := false
+  for _, child := range *content.Children {
+    if child.Token == "BLOCK_RETURN" {
+      returned = true
+      continue
+    }
+    if !returned {
+      continue
+    }
+
+    switch data := child.Data.(type) {
+    case *Identifier:
+      names = append(names, data.Value)
+    case *BusIndex:
+      for index := data.Start; index < data.End; index++ {
+        names = append(names, fmt.Sprintf("%s[%d]", data.Name, index))
+      }
+    default:
+      names = nil
+    }
+    if names == nil {
+      break
+    }
+  }
+
+  // A variable that holds a bus returns many wires, so it can't be named on its own.
+  if len(names) != count {
+    names = []string{}
+    for index := 0; index < count; index++ {
+      names = append(names, fmt.Sprintf("out%d", index))
+    }
+  }
+  return names
+}
@@ -16,25 +16,117 @@ func help(subcomponent string) {
   dollar0 := os.Args[0]
   switch subcomponent {
   case "build":
-    fmt.Printf("Usage: %s build <file.bit> [--verbose]", dollar0)
+    fmt.Printf("Usage: %s build <file.bit> [--optimize] [--merge] [--verbose]", dollar0)
     fmt.Println()
     fmt.Println("Compiles lovelace source into a list of gates and wires that can be executed.")
     fmt.Println()
     fmt.Println("Flags:")
+    fmt.Println("   --optimize		Remove gates that don't change what the circuit does, and print how many were removed to stderr")
+    fmt.Println("   --merge		Merge chains of the same gate, like `a and b and c`, into a single gate with many inputs")
     fmt.Println("   --verbose\t\tPrint debugging information")
     fmt.Println("   --max-call-depth\tChange the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
 
   case "tokenize":
-    fmt.Printf("Usage: %s tokenize <file.bit>", dollar0)
+    fmt.Printf("Usage: %s tokenize [--json] <file.bit>", dollar0)
     fmt.Println()
     fmt.Println("Tokenizes lovelace source into an array of tokens. This is mostly useful for debugging lovelace itself when it won't parse a known-good file.")
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --json		Print the tokens as json, which other tools can read")
+
+  case "export":
+    fmt.Printf("Usage: %s export <file.bit> [--format verilog] [--hierarchical] [--module name]", dollar0)
+    fmt.Println()
+    fmt.Println("Compiles lovelace source and exports the resulting gates and wires in a format that other tools can read.")
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --format		The format to export to. Currently, only verilog is supported. Defaults to verilog.")
+    fmt.Println("   --hierarchical	Export each block invocation as its own verilog module.")
+    fmt.Println("   --module		The name of the top level verilog module. Defaults to the name of the file.")
+    fmt.Println("   --optimize		Remove gates that don't change what the circuit does before exporting")
+    fmt.Println("   --merge		Merge chains of the same gate, like `a and b and c`, into a single gate with many inputs")
+    fmt.Println("   --verbose		Print debugging information")
+    fmt.Println("   --max-call-depth	Change the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
+
+  case "graph":
+    fmt.Printf("Usage: %s graph <file.bit> [--optimize] [--merge]", dollar0)
+    fmt.Println()
+    fmt.Println("Compiles lovelace source and prints the resulting gates and wires as a graphviz DOT graph. Gates within each block invocation are grouped together.")
+    fmt.Println()
+    fmt.Println("Usage Examples:")
+    fmt.Printf("$ %s graph foo.bit | dot -Tsvg > foo.svg\n", dollar0)
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --optimize\t\tRemove gates that don't change what the circuit does before graphing")
+    fmt.Println("   --merge\t\tMerge chains of the same gate, like `a and b and c`, into a single gate with many inputs")
+    fmt.Println("   --verbose\t\tPrint debugging information")
+    fmt.Println("   --max-call-depth\tChange the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
+
+  case "truthtable":
+    fmt.Printf("Usage: %s truthtable <file.bit> --block <name> [--format markdown]", dollar0)
+    fmt.Println()
+    fmt.Println("Runs a block with every combination of its inputs, and prints the outputs that it produces as a truth table.")
+    fmt.Printf("Blocks with more than %d inputs have too many combinations to print.\n", MAX_TRUTH_TABLE_INPUTS)
+    fmt.Println()
+    fmt.Println("Usage Examples:")
+    fmt.Printf("$ %s truthtable adder.bit --block halfadder\n", dollar0)
+    fmt.Printf("$ %s truthtable adder.bit --block \"adder<4>\" --format csv > adder.csv\n", dollar0)
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --block\t\tThe block to print the truth table of. Constants can be passed like adder<4>.")
+    fmt.Println("   --format\t\tThe format to print the truth table in, either markdown or csv. Defaults to markdown.")
+    fmt.Println("   --verbose\t\tPrint debugging information")
+    fmt.Println("   --max-call-depth\tChange the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
+
+  case "equiv":
+    fmt.Printf("Usage: %s equiv <file.bit>:<block> <file.bit>:<block>", dollar0)
+    fmt.Println()
+    fmt.Println("Proves that two combinational blocks produce the same outputs for every combination of their inputs.")
+    fmt.Println("Inputs and outputs are matched by position. If the blocks differ, inputs that they disagree on are printed, and the exit status is 1.")
+    fmt.Println()
+    fmt.Println("Usage Examples:")
+    fmt.Printf("$ %s equiv adder.bit:halfadder adder2.bit:halfadder2\n", dollar0)
+    fmt.Printf("$ %s equiv adder.bit:\"adder<4>\" fastadder.bit:\"carrylookahead<4>\"\n", dollar0)
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --verbose\t\tPrint debugging information")
+    fmt.Println("   --max-call-depth\tChange the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
+
+  case "test":
+    fmt.Printf("Usage: %s test [<file.bit or directory>...]", dollar0)
+    fmt.Println()
+    fmt.Println("Runs every `test` within lovelace source, and prints whether each test passed. Exits with a non-zero status if any test fails.")
+    fmt.Println("Each directory that is passed (or the working directory, if nothing is passed) is searched for files ending in .test.bit.")
+    fmt.Println()
+    fmt.Println("Usage Examples:")
+    fmt.Println(`  test "halfadder truth table" halfadder {`)
+    fmt.Println("    0 0 -> 0 0")
+    fmt.Println("    0 1 -> 1 0")
+    fmt.Println("  }")
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --verbose\t\tPrint debugging information")
+    fmt.Println("   --max-call-depth\tChange the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
+
+  case "run":
+    fmt.Printf("Usage: %s run <file.bit> [--port 8080] [--tick-interval 500ms]", dollar0)
+    fmt.Println()
+    fmt.Println("Compiles lovelace source and opens it in a live-preview window. The program is recompiled whenever it (or a file it imports) changes.")
+    fmt.Println()
+    fmt.Println("Flags:")
+    fmt.Println("   --port		Specify an alternative port to run on. Defaults to 8080.")
+    fmt.Println("   --tick-interval	How often to advance `wave` clocks, like 500ms. Setting to 0 stops clocks from advancing. Defaults to 500ms.")
+    fmt.Println("   --verbose		Print debugging information")
+    fmt.Println("   --max-call-depth	Change the max block invocation depth. Setting to 0 disables the limit. Defaults to 100.")
 
   case "serve":
     fmt.Printf("Usage: %s serve [--port 8080] [--verbose]", dollar0)
     fmt.Println()
     fmt.Println("Runs a http server that can be used to remotely compile and run lovelace ast. The server exposes two http endpoints:")
-    fmt.Println(" POST /v1/compile, which compiles any lovelace source included in the request into ast.")
-    fmt.Println(" POST /v1/run, which executes any ast, returning the state of all wires.")
+    fmt.Println(" POST /v1/compile, which compiles any lovelace source included in the request into ast. Send `Accept: text/vnd.graphviz` to receive a graphviz DOT graph instead, add `?optimize=true` to optimize the gates, and add `?merge=true` to merge chains of gates.")
+    fmt.Println("   If the source doesn't compile, the response has an `Error` message and a `CompileError` with the error's code, file, and start and end line and column.")
+    fmt.Printf(" POST /v1/run, which executes any ast, returning the state of all wires. Include a \"Ticks\" key (up to %d) to advance any `wave` clocks.\n", MAX_SESSION_TICKS)
+    fmt.Println(" POST /v1/truthtable?block=halfadder, which prints the truth table of a block within any lovelace source. Add `&format=markdown` or `&format=csv` to receive a table instead of json.")
     fmt.Println()
     fmt.Println("Usage Examples:")
     fmt.Println("The below request compiles the program led(toggle()) into two gates (toggle switch and led) and one wire connecting them:")
@@ -52,9 +144,14 @@ func help(subcomponent string) {
     fmt.Println(" - run        Execute a lovelace program interactively in a live-preview window")
     fmt.Println(" - build      Compile lovelace syntax into an ast that can be run")
     fmt.Println(" - serve      Run a lovelace server that can compile and run ast")
+    fmt.Println(" - test       Run the tests within lovelace source")
     fmt.Println()
     fmt.Println("Less-commonly used subcommands:")
     fmt.Println(" - tokenize   Compile lovelace syntax into a list of tokens. ")
+    fmt.Println(" - export     Export compiled lovelace into another format, like verilog")
+    fmt.Println(" - graph      Print compiled lovelace as a graphviz graph")
+    fmt.Println(" - truthtable Print the truth table of a block")
+    fmt.Println(" - equiv      Check whether two blocks compute the same outputs")
   }
 }
 
@@ -74,27 +171,44 @@ func main() {
 
   // lovel tokenize foo.bit
   case "tokenize":
-    if len(os.Args) < 3 {
+    tokenizeFlags := flag.NewFlagSet("tokenize", flag.ExitOnError)
+    tokenizeJson := tokenizeFlags.Bool("json", false, "Print the tokens as json")
+    tokenizeFlags.Usage = func() { help("tokenize") }
+    tokenizeFlags.Parse(os.Args[2:])
+
+    if tokenizeFlags.NArg() != 1 {
       fmt.Println("No file was passed to tokenize. Stop.")
       os.Exit(2)
       return
     }
+    filePath := tokenizeFlags.Args()[0]
 
     // Read source code from disk
-    source, err := ioutil.ReadFile(os.Args[2])
+    source, err := ioutil.ReadFile(filePath)
     if err != nil {
-      fmt.Printf("Error reading file %s: %s. Stop.\n", os.Args[2], err);
+      fmt.Printf("Error reading file %s: %s. Stop.\n", filePath, err);
       os.Exit(2)
     }
 
     // Tokenize the source code
-    result, err := Tokenizer(string(source))
+    result, err := NewModuleResolver().Tokenize(string(source), filePath)
     if err != nil {
-      fmt.Printf("Error tokenizing file %s: %s\n", os.Args[2], err);
+      fmt.Printf("Error tokenizing file %s: %s\n", filePath, err);
       os.Exit(2)
     }
 
-    PrintAst(result, 0, "")
+    if !*tokenizeJson {
+      PrintAst(result, 0, "")
+      return
+    }
+
+    serialized, err := json.MarshalIndent(result, "", "  ")
+    if err != nil {
+      fmt.Printf("Error serializing tokens: %s. Stop.\n", err);
+      os.Exit(2)
+      return
+    }
+    fmt.Println(string(serialized))
 
   // lovel build foo.bit
   case "build":
@@ -102,37 +216,48 @@ func main() {
     buildFlags := flag.NewFlagSet("build", flag.ExitOnError)
     buildVerbose := buildFlags.Bool("verbose", false, "Print debug information")
     buildMaxCallDepth := buildFlags.Int("max-call-depth", -1, "Set the maximum call depth")
+    buildOptimize := buildFlags.Bool("optimize", false, "Optimize the compiled gates")
+    buildMerge := buildFlags.Bool("merge", false, "Merge chains of gates into gates with many inputs")
     buildFlags.Usage = func() { help("build") }
     buildFlags.Parse(os.Args[2:])
 
-    wireId = 0
-    gateId = 0
-    stackFrameId = 0
-
-    // Set max call depth if a value was specified.
-    if *buildMaxCallDepth != -1 {
-      INVOCATION_MAX_RECURSION_DEPTH = *buildMaxCallDepth
-    }
-
-    fmt.Println(buildFlags.NArg())
-    if buildFlags.NArg() != 1 {
+    // Flags can also come after the file, like `lovel build foo.bit --optimize`.
+    if buildFlags.NArg() < 1 {
       fmt.Println("No file path was passed to build. Stop.")
       os.Exit(2)
       return
     }
+    filePath := buildFlags.Arg(0)
+    buildFlags.Parse(buildFlags.Args()[1:])
+    if buildFlags.NArg() > 0 {
+      fmt.Println("Only one file can be passed to build. Stop.")
+      os.Exit(2)
+      return
+    }
 
+    compiler := NewCompiler()
+    compiler.Verbose = *buildVerbose
+    compiler.Optimize = *buildOptimize
+    compiler.MergeGates = *buildMerge
+
+    // Set max call depth if a value was specified.
+    if *buildMaxCallDepth != -1 {
+      compiler.MaxRecursionDepth = *buildMaxCallDepth
+    }
 
     // Read source code from disk
-    summary, err := RunFile(buildFlags.Args()[0], *buildVerbose)
+    summary, err := compiler.RunFile(filePath)
     if err != nil {
       fmt.Println(err);
       os.Exit(2)
       return
     }
+    compiler.PrintWarnings()
+    compiler.PrintOptimizations()
 
     serialized, err2 := json.Marshal(summary)
     if err2 != nil {
-      fmt.Println("Error serializing result: %s. Stop.", err2);
+      fmt.Printf("Error serializing result: %s. Stop.\n", err2);
       os.Exit(2)
       return
     }
@@ -141,6 +266,21 @@ func main() {
   // lovel serve --port 2185
   case "serve": Serve()
 
+  // lovel export foo.bit --format verilog
+  case "export": Export()
+
+  // lovel graph foo.bit
+  case "graph": Graph()
+
+  // lovel truthtable foo.bit --block halfadder
+  case "truthtable": PrintTruthTable()
+
+  // lovel equiv a.bit:halfadder b.bit:halfadder2
+  case "equiv": Equiv()
+
+  // lovel test foo.test.bit
+  case "test": Test()
+
   // Print out help info
   case "--help": fallthrough
   case "-h": fallthrough
@@ -0,0 +1,94 @@
+package main
+
+// The gates that a gate can be merged into when its output is only read by that gate. For example,
+// `(a and b) and c` is the same as a single `AND` gate with the inputs `a`, `b`, and `c`, and
+// `(a or b) nor c` is the same as a single `NOR` gate.
+var MERGEABLE_GATE_TYPES map[GateType][]GateType = map[GateType][]GateType{
+  AND: []GateType{AND, NAND},
+  OR: []GateType{OR, NOR},
+}
+
+// Merge chains of gates into a single gate with many inputs. Without this, a wide expression like
+// `a and b and c and d` becomes three gates that are each evaluated separately by the simulation.
+//
+// A gate is merged into the gate that reads its output when:
+// - Its output wire is read by only that gate, and isn't one of the program's outputs.
+// - The gate that reads it is a different gate.
+// - Both gates are within the same block invocation, so that the invocation still contains the
+//   same inputs and outputs.
+// The merged gate keeps its id, and its inputs are replaced by the inputs of the gates merged into
+// it, in order. The wires between merged gates are removed.
+func mergeGateChains(summary *Summary) {
+  isOutput := map[int]bool{}
+  for _, wire := range summary.Outputs {
+    isOutput[wire.Id] = true
+  }
+
+  // Find how many times each wire is read, and the gate that reads it.
+  reads := map[int]int{}
+  readers := map[int]*Gate{}
+  for _, gate := range summary.Gates {
+    for _, wire := range gate.Inputs {
+      reads[wire.Id] += 1
+      readers[wire.Id] = gate
+    }
+  }
+
+  mergedGates := map[*Gate]bool{}
+  mergedWires := map[int]bool{}
+  for _, gate := range summary.Gates {
+    if len(gate.Outputs) != 1 {
+      continue
+    }
+    wire := gate.Outputs[0]
+    if reads[wire.Id] != 1 || isOutput[wire.Id] {
+      continue
+    }
+    // A gate that reads its own output (ie, `let x = (x and a)`) has nothing to be merged into.
+    reader := readers[wire.Id]
+    if reader == gate || reader.CallingContext != gate.CallingContext || !canMergeGate(gate.Type, reader.Type) {
+      continue
+    }
+
+    // Replace the wire with the inputs of the gate that drove it.
+    var inputs []*Wire
+    for _, input := range reader.Inputs {
+      if input.Id == wire.Id {
+        inputs = append(inputs, gate.Inputs...)
+      } else {
+        inputs = append(inputs, input)
+      }
+    }
+    reader.Inputs = inputs
+
+    for _, input := range gate.Inputs {
+      readers[input.Id] = reader
+    }
+    mergedGates[gate] = true
+    mergedWires[wire.Id] = true
+  }
+
+  var gates []*Gate
+  for _, gate := range summary.Gates {
+    if !mergedGates[gate] {
+      gates = append(gates, gate)
+    }
+  }
+  var wires []*Wire
+  for _, wire := range summary.Wires {
+    if !mergedWires[wire.Id] {
+      wires = append(wires, wire)
+    }
+  }
+  summary.Gates = gates
+  summary.Wires = wires
+}
+
+func canMergeGate(gateType GateType, readerType GateType) bool {
+  for _, mergeable := range MERGEABLE_GATE_TYPES[gateType] {
+    if mergeable == readerType {
+      return true
+    }
+  }
+  return false
+}
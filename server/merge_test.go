@@ -0,0 +1,143 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+)
+
+// Find every gate with the given type.
+func findGatesByType(gates []*Gate, gateType GateType) []*Gate {
+  var found []*Gate
+  for _, gate := range gates {
+    if gate.Type == gateType {
+      found = append(found, gate)
+    }
+  }
+  return found
+}
+
+// Compile source with chains of gates merged, which is off by default.
+func compileMerged(source string) (*Summary, error) {
+  compiler := NewCompiler()
+  compiler.MergeGates = true
+  return compiler.RunString(source)
+}
+
+func TestMergeGateChains(t *testing.T) {
+  summary, err := compileMerged("led(toggle() and toggle() and toggle() and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  ands := findGatesByType(summary.Gates, AND)
+  if len(ands) != 1 {
+    t.Errorf("Expected the chain to be merged into one and gate, found %d", len(ands))
+    return
+  }
+  if len(ands[0].Inputs) != 4 {
+    t.Errorf("Expected the and gate to have four inputs, found %d", len(ands[0].Inputs))
+  }
+
+  // The inputs are kept in the order that they were written.
+  toggles := 0
+  for _, gate := range summary.Gates {
+    if gate.Label == "toggle" {
+      if input := ands[0].Inputs[toggles]; input.Id != gate.Outputs[0].Id {
+        t.Errorf("Input %d should be wire %d, is wire %d", toggles, gate.Outputs[0].Id, input.Id)
+      }
+      toggles += 1
+    }
+  }
+
+  // The wires between the merged gates are gone.
+  if len(summary.Wires) != 5 {
+    t.Errorf("Expected five wires, found %d", len(summary.Wires))
+  }
+}
+
+func TestMergeGateChainsIntoInvertedGate(t *testing.T) {
+  summary, err := compileMerged("led(toggle() or toggle() nor toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if nors := findGatesByType(summary.Gates, NOR); len(nors) != 1 || len(nors[0].Inputs) != 3 {
+    t.Errorf("Expected one nor gate with three inputs, found %+v", nors)
+  }
+  if ors := findGatesByType(summary.Gates, OR); len(ors) != 0 {
+    t.Errorf("Expected the or gate to be merged, found %d", len(ors))
+  }
+}
+
+func TestMergeGateChainsKeepsSharedWires(t *testing.T) {
+  // `x` is read by both leds, so it can't be merged into the gate that reads it.
+  summary, err := compileMerged("let x = toggle() and toggle()\nled(x)\nled(x and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if ands := findGatesByType(summary.Gates, AND); len(ands) != 2 {
+    t.Errorf("Expected two and gates, found %d", len(ands))
+  }
+}
+
+func TestMergeGateChainsKeepsDifferentGates(t *testing.T) {
+  summary, err := compileMerged("led(toggle() and toggle() or toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if len(findGatesByType(summary.Gates, AND)) != 1 || len(findGatesByType(summary.Gates, OR)) != 1 {
+    t.Errorf("Expected an and gate and an or gate")
+  }
+}
+
+func TestMergeGateChainsKeepsBlockBoundaries(t *testing.T) {
+  summary, err := compileMerged("block both(a b) {\n  return a and b\n}\nled(both(toggle() toggle()) and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if ands := findGatesByType(summary.Gates, AND); len(ands) != 2 {
+    t.Errorf("Expected two and gates, found %d", len(ands))
+  }
+}
+
+func TestMergeGatesIsOffByDefault(t *testing.T) {
+  summary, err := NewCompiler().RunString("led(toggle() and toggle() and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if ands := findGatesByType(summary.Gates, AND); len(ands) != 2 {
+    t.Errorf("Expected two and gates, found %d", len(ands))
+  }
+}
+
+func TestMergeGateChainsKeepsLoops(t *testing.T) {
+  // A gate that reads its own output can't be merged into itself.
+  summary, err := compileMerged("let x = (x and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+  if ands := findGatesByType(summary.Gates, AND); len(ands) != 1 {
+    t.Errorf("Expected one and gate, found %d", len(ands))
+  }
+
+  // Neither can two gates that read each other, once the first is merged into the second.
+  summary, err = compileMerged("let x = (y and toggle())\nlet y = (x and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+  if ands := findGatesByType(summary.Gates, AND); len(ands) != 1 || len(ands[0].Inputs) != 3 {
+    t.Errorf("Expected one and gate with three inputs, found %+v", ands)
+  }
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+  "sort"
+  "strings"
+)
+
+// A product of inputs, like `a and (not c)`. Each input is a bit, where the first input is the most
+// significant bit. Inputs that are set in `Mask` aren't part of the product, and the rest must have
+// the value that they have in `Value`.
+type implicant struct {
+  Value uint32
+  Mask uint32
+}
+
+func (i implicant) covers(combination uint32) bool {
+  return combination & ^i.Mask == i.Value
+}
+
+// The number of inputs that are part of the product.
+func (i implicant) literals(inputs int) int {
+  count := 0
+  for bit := 0; bit < inputs; bit++ {
+    if i.Mask & (1 << uint(bit)) == 0 {
+      count += 1
+    }
+  }
+  return count
+}
+
+// Find a small sum of products that is true for every combination of inputs in `ones`, and false
+// for every combination that isn't in `ones` or `dontCares`, using the Quine-McCluskey method.
+//
+// First, every prime implicant is found by repeatedly merging products that differ by a single
+// input (ie, `a and b` and `a and (not b)` merge into `a`). Then, the primes that are the only ones
+// to cover a combination are picked, and the rest of the combinations are covered by picking the
+// prime that covers the most of them until none are left. Picking the rest exactly is NP-hard, so
+// the result is minimal for most tables but not all of them.
+func minimize(inputs int, ones []uint32, dontCares []uint32) []implicant {
+  if len(ones) == 0 {
+    return []implicant{}
+  }
+
+  // Find the prime implicants. Each round merges the implicants from the last round that have the
+  // same mask, and implicants that can't be merged with anything are prime.
+  current := map[implicant]bool{}
+  for _, combination := range append(append([]uint32{}, ones...), dontCares...) {
+    current[implicant{Value: combination}] = false
+  }
+  primes := []implicant{}
+  for len(current) > 0 {
+    next := map[implicant]bool{}
+    for term := range current {
+      for bit := uint32(1); bit < 1 << uint(inputs); bit <<= 1 {
+        if term.Mask & bit != 0 || term.Value & bit != 0 {
+          continue
+        }
+        partner := implicant{Value: term.Value | bit, Mask: term.Mask}
+        if _, ok := current[partner]; ok {
+          current[term], current[partner] = true, true
+          next[implicant{Value: term.Value, Mask: term.Mask | bit}] = false
+        }
+      }
+    }
+    for term, merged := range current {
+      if !merged {
+        primes = append(primes, term)
+      }
+    }
+    current = next
+  }
+
+  // Order the primes so that the result doesn't depend on the order of a map, preferring products of
+  // fewer inputs.
+  sort.Slice(primes, func(i, j int) bool {
+    if primes[i].literals(inputs) != primes[j].literals(inputs) {
+      return primes[i].literals(inputs) < primes[j].literals(inputs)
+    }
+    if primes[i].Mask != primes[j].Mask {
+      return primes[i].Mask > primes[j].Mask
+    }
+    return primes[i].Value > primes[j].Value
+  })
+
+  uncovered := map[uint32]bool{}
+  for _, combination := range ones {
+    uncovered[combination] = true
+  }
+  picked := map[int]bool{}
+  pick := func(index int) {
+    picked[index] = true
+    for combination := range uncovered {
+      if primes[index].covers(combination) {
+        delete(uncovered, combination)
+      }
+    }
+  }
+
+  // Pick the essential primes, which are the only primes that cover a combination.
+  for _, combination := range ones {
+    only := -1
+    for index, prime := range primes {
+      if !prime.covers(combination) {
+        continue
+      }
+      if only != -1 {
+        only = -1
+        break
+      }
+      only = index
+    }
+    if only != -1 && !picked[only] {
+      pick(only)
+    }
+  }
+
+  // Then, cover whatever is left.
+  for len(uncovered) > 0 {
+    best, bestCount := -1, 0
+    for index, prime := range primes {
+      if picked[index] {
+        continue
+      }
+      count := 0
+      for combination := range uncovered {
+        if prime.covers(combination) {
+          count += 1
+        }
+      }
+      if count > bestCount {
+        best, bestCount = index, count
+      }
+    }
+    pick(best)
+  }
+
+  result := []implicant{}
+  for index, prime := range primes {
+    if picked[index] {
+      result = append(result, prime)
+    }
+  }
+  return result
+}
+
+// Write a sum of products as a lovelace expression, like `(a and b) or (not c)`.
+func formatSumOfProducts(names []string, terms []implicant) string {
+  if len(terms) == 0 {
+    return "0"
+  }
+
+  products := []string{}
+  for _, term := range terms {
+    literals := []string{}
+    for index, name := range names {
+      bit := uint32(1) << uint(len(names) - 1 - index)
+      if term.Mask & bit != 0 {
+        continue
+      }
+      if term.Value & bit != 0 {
+        literals = append(literals, name)
+      } else {
+        literals = append(literals, "(not " + name + ")")
+      }
+    }
+
+    // A product of nothing is always true.
+    if len(literals) == 0 {
+      return "1"
+    }
+    product := strings.Join(literals, " and ")
+    if len(literals) > 1 && len(terms) > 1 {
+      product = "(" + product + ")"
+    }
+    products = append(products, product)
+  }
+  return strings.Join(products, " or ")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+  "fmt"
+)
+
+// A module holds the blocks from an import that has a namespace, like `import adder as arith`.
+// Outside of the module, its blocks are invoked by their qualified name (`arith.adder4(a b)`).
+// Within the module, blocks invoke each other by their own names, so a block in the module always
+// invokes the other blocks in the module, even if a block with the same name is defined elsewhere.
+type Module struct {
+  Name string
+  Blocks []*Block
+}
+
+// Collect the blocks within a `MODULE` node into a module. The blocks of modules that were imported
+// by the module are included under their qualified names.
+func newModule(node Node) (*Module, error) {
+  module := &Module{Name: node.Data.(*ModuleDecl).Name}
+
+  for _, child := range *node.Children {
+    switch child.Token {
+    case "SINGLE_COMMENT", "MULTI_COMMENT":
+      continue
+
+    case "BLOCK":
+      content := child
+      module.Blocks = append(module.Blocks, &Block{
+        Name: content.Data.(*BlockDecl).Name,
+        Content: &content,
+        Module: module,
+      })
+
+    case "MODULE":
+      inner, err := newModule(child)
+      if err != nil {
+        return nil, err
+      }
+      for _, block := range inner.Blocks {
+        module.Blocks = append(module.Blocks, &Block{
+          Name: qualifiedBlockName(inner.Name, block.Name),
+          Content: block.Content,
+          Module: block.Module,
+        })
+      }
+
+    default:
+      return nil, NewNodeError(IMPORT_ERROR, child, fmt.Sprintf(
+        "The import of %s at %s contains a %s at %s, but only blocks can be imported with a namespace. Stop.",
+        module.Name,
+        formatPosition(node.File, node.Line, node.Col),
+        child.Token,
+        formatPosition(child.File, child.Line, child.Col),
+      ))
+    }
+  }
+
+  return module, nil
+}
+
+// The name of a block within a namespace, ie `arith.adder4`.
+func qualifiedBlockName(namespace string, name string) string {
+  return fmt.Sprintf("%s.%s", namespace, name)
+}
+
+// Add a block to the top stack frame. If the block has the same name as a block that can already be
+// invoked, it hides that block from now on, which is usually a mistake, so a warning is recorded.
+func (c *Compiler) defineBlock(block *Block, stack []*StackFrame) {
+  if shadowed := findBlock(stack, block.Name); shadowed != nil {
+    c.warn(fmt.Sprintf(
+      "Block %s defined at %s shadows the block of the same name defined at %s.",
+      block.Name,
+      formatPosition(block.Content.File, block.Content.Line, block.Content.Col),
+      formatPosition(shadowed.Content.File, shadowed.Content.Line, shadowed.Content.Col),
+    ))
+  }
+
+  stack[len(stack) - 1].Blocks = append(stack[len(stack) - 1].Blocks, block)
+}
+
+// Find the block that a name refers to, looking through the stack from top to bottom. Within a stack
+// frame, later definitions of a block hide earlier ones.
+func findBlock(stack []*StackFrame, name string) *Block {
+  for i := len(stack) - 1; i >= 0; i-- {
+    for j := len(stack[i].Blocks) - 1; j >= 0; j-- {
+      if stack[i].Blocks[j].Name == name {
+        return stack[i].Blocks[j]
+      }
+    }
+  }
+  return nil
+}
+
+// Record a warning, which doesn't stop compilation. Each warning is only recorded once.
+func (c *Compiler) warn(message string) {
+  for _, warning := range c.Warnings {
+    if warning == message {
+      return
+    }
+  }
+  c.Warnings = append(c.Warnings, message)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "os"
+  "path/filepath"
+  "reflect"
+  "strings"
+)
+
+func TestNamespacedImport(t *testing.T) {
+  states := ledStates(t, "import adder as arith\nlet sum carry = arith.halfadder(1 1)\nled(sum)\nled(carry)")
+  if strings.Join(states, " ") != "off on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+
+  // Blocks from a namespaced import can only be invoked by their qualified name.
+  _, err := RunString("import adder as arith\nled(halfadder(1 1))", false)
+  if compileErr, ok := err.(*CompileError); !ok || compileErr.Code != UNDEFINED_BLOCK {
+    t.Errorf("Expected an undefined block error, found %+v", err)
+  }
+}
+
+func TestNamespacedImportInvokesItsOwnBlocks(t *testing.T) {
+  // `arith.adder` invokes the `halfadder` from its own module, not the one defined afterwards.
+  states := ledStates(t, `
+    import adder as arith
+    block halfadder(a b) {
+      return 0 0
+    }
+    let sum carry = arith.adder(1 0 0)
+    led(sum)
+  `)
+  if strings.Join(states, " ") != "on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestImportWithAndWithoutNamespace(t *testing.T) {
+  states := ledStates(t, "import adder\nimport adder as arith\nimport adder as math\nled(halfadder(1 0))\nled(arith.halfadder(1 0))\nled(math.halfadder(0 0))")
+  if strings.Join(states, " ") != "on on off" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestNamespacedLocalImport(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": `
+      import "./gates.bit" as gates
+      led(gates.invert(1))
+    `,
+    "gates.bit": `
+      import "./nand.bit" as logic
+      block invert(a) {
+        return logic.nand2(a a)
+      }
+    `,
+    "nand.bit": `
+      block nand2(a b) {
+        return not (a and b)
+      }
+    `,
+  })
+  defer os.RemoveAll(dir)
+
+  summary, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  var names []string
+  for _, context := range summary.Contexts {
+    names = append(names, context.Name)
+  }
+  if !reflect.DeepEqual(names, []string{"gates.invert", "logic.nand2"}) {
+    t.Errorf("Wrong calling contexts: %v", names)
+  }
+}
+
+func TestNamespacedImportCanOnlyContainBlocks(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": "import \"./lib.bit\" as lib",
+    "lib.bit": "led(1)",
+  })
+  defer os.RemoveAll(dir)
+
+  _, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  expected := fmt.Sprintf(
+    "The import of lib at %s:1:1 contains a INVOCATION at %s:1:1, but only blocks can be imported with a namespace. Stop.",
+    filepath.Join(dir, "main.bit"),
+    filepath.Join(dir, "lib.bit"),
+  )
+  if err == nil || err.Error() != expected {
+    t.Errorf("Wrong error: %v", err)
+  }
+}
+
+func TestShadowingWarnings(t *testing.T) {
+  compiler := NewCompiler()
+  summary, err := compiler.RunString("import adder\nblock halfadder(a b) {\n  return 1 1\n}\nlet sum carry = halfadder(0 0)\nled(sum)")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if !reflect.DeepEqual(compiler.Warnings, []string{
+    "Block halfadder defined at 2:1 shadows the block of the same name defined at stdlib:adder:2:5.",
+  }) {
+    t.Errorf("Wrong warnings: %v", compiler.Warnings)
+  }
+
+  // The block that was defined last is used.
+  gates, _ := Execute(summary.Gates, summary.Wires)
+  for _, gate := range gates {
+    if gate.Label == "led" && gate.State != "on" {
+      t.Errorf("Expected the led to be on, the halfadder from the standard library was used")
+    }
+  }
+
+  // Blocks with different names don't cause warnings.
+  compiler.RunString("import adder as arith\nblock halfadder(a b) {\n  return 1 1\n}")
+  if len(compiler.Warnings) != 0 {
+    t.Errorf("Expected no warnings, found %v", compiler.Warnings)
+  }
+}
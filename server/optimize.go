@@ -0,0 +1,409 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// How much `optimizeSummary` shrunk a summary, and how many gates each pass removed.
+type OptimizationReport struct {
+  GatesBefore int
+  GatesAfter int
+  WiresBefore int
+  WiresAfter int
+
+  ConstantsFolded int
+  BuffersCollapsed int
+  SubexpressionsShared int
+  DeadGatesRemoved int
+}
+
+func (r *OptimizationReport) String() string {
+  return fmt.Sprintf(
+    "Optimized %d gates and %d wires into %d gates and %d wires (constant propagation removed %d gates, buffer collapsing %d, common subexpression elimination %d, and dead gate elimination %d)",
+    r.GatesBefore,
+    r.WiresBefore,
+    r.GatesAfter,
+    r.WiresAfter,
+    r.ConstantsFolded,
+    r.BuffersCollapsed,
+    r.SubexpressionsShared,
+    r.DeadGatesRemoved,
+  )
+}
+
+// The gate types whose inputs can be given in any order.
+var COMMUTATIVE_GATE_TYPES map[GateType]bool = map[GateType]bool{
+  AND: true,
+  OR: true,
+  XOR: true,
+  NAND: true,
+  NOR: true,
+  XNOR: true,
+}
+
+// Shrink a compiled summary without changing what it does. These passes are run until none of them
+// can change anything:
+// - Constant propagation: a gate with an input that is always on or off is simplified, or replaced
+//   with a constant when its output no longer depends on its other inputs (ie, `a and 0`). Every
+//   constant is driven by a single `SOURCE` or `GROUND`.
+// - Buffer collapsing: `BLOCK_INPUT` and `BLOCK_OUTPUT` gates (and gates with a single input, like
+//   an `AND` whose other inputs were constants) are removed, and their readers read from the wire
+//   that the buffer read from instead.
+// - Common subexpression elimination: gates with the same type and inputs are merged into one.
+// - Dead gate elimination: gates that don't lead to a builtin (ie, an `led`) or an output of the
+//   program are removed.
+// Builtins are never removed, since they're how a circuit interacts with the world. The gates that
+// remain keep their ids, but can end up reading from wires in another block invocation.
+func optimizeSummary(summary *Summary) *OptimizationReport {
+  o := &optimizer{
+    summary: summary,
+    aliases: map[int]*Wire{},
+    removed: map[*Gate]bool{},
+    report: &OptimizationReport{GatesBefore: len(summary.Gates), WiresBefore: len(summary.Wires)},
+  }
+
+  for {
+    changed := o.propagateConstants()
+    changed = o.collapseBuffers() || changed
+    changed = o.shareSubexpressions() || changed
+    changed = o.removeDeadGates() || changed
+    if !changed {
+      break
+    }
+  }
+  o.compact()
+
+  o.report.GatesAfter, o.report.WiresAfter = len(summary.Gates), len(summary.Wires)
+  return o.report
+}
+
+type optimizer struct {
+  summary *Summary
+
+  // Wires that have been replaced by another wire, by id. Every gate that read a replaced wire reads
+  // the replacement instead.
+  aliases map[int]*Wire
+  removed map[*Gate]bool
+
+  // The gate that drives each wire, which is only set for wires that are driven by exactly one gate.
+  // A wire with many drivers is left alone.
+  drivers map[int]*Gate
+
+  report *OptimizationReport
+}
+
+// Follow a wire's aliases to the wire that replaced it.
+func (o *optimizer) resolve(wire *Wire) *Wire {
+  for steps := 0; steps <= len(o.aliases); steps++ {
+    alias, ok := o.aliases[wire.Id]
+    if !ok {
+      break
+    }
+    wire = alias
+  }
+  return wire
+}
+
+// Replace the output of a gate with another wire, and remove the gate.
+func (o *optimizer) replace(gate *Gate, wire *Wire) {
+  o.aliases[gate.Outputs[0].Id] = wire
+  o.removed[gate] = true
+}
+
+// Point every input at the wire that replaced it, and find the driver of each wire. This runs before
+// each pass, so that each pass sees the changes of the last one.
+func (o *optimizer) refresh() {
+  drivers := map[int]*Gate{}
+  driverCount := map[int]int{}
+  for _, gate := range o.summary.Gates {
+    if o.removed[gate] {
+      continue
+    }
+    for index, input := range gate.Inputs {
+      gate.Inputs[index] = o.resolve(input)
+    }
+    for _, output := range gate.Outputs {
+      drivers[output.Id] = gate
+      driverCount[output.Id] += 1
+    }
+  }
+  for id, count := range driverCount {
+    if count > 1 {
+      delete(drivers, id)
+    }
+  }
+  o.drivers = drivers
+
+  for index, output := range o.summary.Outputs {
+    o.summary.Outputs[index] = o.resolve(output)
+  }
+}
+
+// Can the output of a gate be replaced with another wire? Builtins have state, and a wire that is
+// driven by more than one gate can't be replaced by any one of them.
+func (o *optimizer) isReplaceable(gate *Gate) bool {
+  return !o.removed[gate] &&
+    gate.Type != BUILTIN_FUNCTION &&
+    len(gate.Outputs) == 1 &&
+    o.drivers[gate.Outputs[0].Id] == gate
+}
+
+// The state of a wire if it's always on or off.
+func (o *optimizer) constant(wire *Wire) (bool, bool) {
+  driver, ok := o.drivers[wire.Id]
+  if !ok {
+    return false, false
+  }
+  switch driver.Type {
+  case SOURCE:
+    return true, true
+  case GROUND:
+    return false, true
+  }
+  return false, false
+}
+
+func (o *optimizer) propagateConstants() bool {
+  o.refresh()
+  changed := false
+
+  // The first constant gate of each state is the one that every other constant is replaced with.
+  constants := map[bool]*Wire{}
+  for _, gate := range o.summary.Gates {
+    if !o.isReplaceable(gate) || (gate.Type != SOURCE && gate.Type != GROUND) {
+      continue
+    }
+    state := gate.Type == SOURCE
+    if constants[state] == nil {
+      constants[state] = gate.Outputs[0]
+    } else if constants[state] != gate.Outputs[0] {
+      o.replace(gate, constants[state])
+      o.report.ConstantsFolded += 1
+      changed = true
+    }
+  }
+
+  for _, gate := range o.summary.Gates {
+    if !o.isReplaceable(gate) || gate.Type == SOURCE || gate.Type == GROUND {
+      continue
+    }
+
+    // Split the inputs into the constants and the rest.
+    var inputs []*Wire
+    ons, offs := 0, 0
+    for _, input := range gate.Inputs {
+      if state, ok := o.constant(input); !ok {
+        inputs = append(inputs, input)
+      } else if state {
+        ons += 1
+      } else {
+        offs += 1
+      }
+    }
+    if ons + offs == 0 {
+      continue
+    }
+
+    // Either the output of the gate is known, or the constants can be left out of its inputs. When
+    // leaving out the constants flips the output (ie, an `XOR` with an input that is on), the gate
+    // becomes its inverse.
+    var state, known bool
+    gateType := gate.Type
+    switch gate.Type {
+    case AND, NAND:
+      state, known = (offs > 0) == (gate.Type == NAND), offs > 0 || len(inputs) == 0
+    case OR, NOR:
+      state, known = (ons > 0) == (gate.Type == OR), ons > 0 || len(inputs) == 0
+    case XOR, XNOR:
+      if ons % 2 == 1 {
+        gateType = map[GateType]GateType{XOR: XNOR, XNOR: XOR}[gate.Type]
+      }
+      state, known = gateType == XNOR, len(inputs) == 0
+    case NOT:
+      state, known = offs > 0, true
+    case BLOCK_INPUT, BLOCK_OUTPUT:
+      state, known = ons > 0, true
+    default:
+      continue
+    }
+
+    if known {
+      if constants[state] == nil {
+        // This gate becomes the constant that others are replaced with.
+        if state {
+          gate.Type = SOURCE
+        } else {
+          gate.Type = GROUND
+        }
+        gate.Inputs = []*Wire{}
+        constants[state] = gate.Outputs[0]
+        o.drivers[gate.Outputs[0].Id] = gate
+      } else {
+        o.replace(gate, constants[state])
+        o.report.ConstantsFolded += 1
+      }
+    } else {
+      gate.Type = gateType
+      gate.Inputs = inputs
+    }
+    changed = true
+  }
+  return changed
+}
+
+func (o *optimizer) collapseBuffers() bool {
+  o.refresh()
+  changed := false
+  for _, gate := range o.summary.Gates {
+    if !o.isReplaceable(gate) || len(gate.Inputs) != 1 {
+      continue
+    }
+
+    switch gate.Type {
+    case BLOCK_INPUT, BLOCK_OUTPUT, AND, OR, XOR:
+      // A buffer that reads from itself is a loop that nothing drives, so it's left alone.
+      if o.resolve(gate.Inputs[0]).Id == gate.Outputs[0].Id {
+        continue
+      }
+      o.replace(gate, gate.Inputs[0])
+      o.report.BuffersCollapsed += 1
+      changed = true
+    case NAND, NOR, XNOR:
+      gate.Type = NOT
+      changed = true
+    }
+  }
+  return changed
+}
+
+func (o *optimizer) shareSubexpressions() bool {
+  o.refresh()
+  changed := false
+  first := map[string]*Gate{}
+  for _, gate := range o.summary.Gates {
+    if !o.isReplaceable(gate) {
+      continue
+    }
+    switch gate.Type {
+    case SOURCE, GROUND, BLOCK_INPUT, BLOCK_OUTPUT:
+      continue
+    }
+
+    // Gates are the same if they have the same type and read from the same wires. Inputs are
+    // compared in order, unless the order doesn't matter.
+    ids := []string{}
+    for _, input := range gate.Inputs {
+      ids = append(ids, fmt.Sprint(input.Id))
+    }
+    if COMMUTATIVE_GATE_TYPES[gate.Type] {
+      sort.Strings(ids)
+    }
+    key := fmt.Sprintf("%s %s", gate.Type, strings.Join(ids, " "))
+
+    if existing, ok := first[key]; ok {
+      o.replace(gate, existing.Outputs[0])
+      o.report.SubexpressionsShared += 1
+      changed = true
+    } else {
+      first[key] = gate
+    }
+  }
+  return changed
+}
+
+func (o *optimizer) removeDeadGates() bool {
+  o.refresh()
+
+  // Walk back from every builtin and output to find the wires that they depend on.
+  live := map[int]bool{}
+  var stack []*Wire
+  stack = append(stack, o.summary.Outputs...)
+  for _, gate := range o.summary.Gates {
+    if !o.removed[gate] && gate.Type == BUILTIN_FUNCTION {
+      stack = append(stack, gate.Inputs...)
+    }
+  }
+  drivers := map[int][]*Gate{}
+  for _, gate := range o.summary.Gates {
+    if o.removed[gate] {
+      continue
+    }
+    for _, output := range gate.Outputs {
+      drivers[output.Id] = append(drivers[output.Id], gate)
+    }
+  }
+  for len(stack) > 0 {
+    wire := stack[len(stack) - 1]
+    stack = stack[:len(stack) - 1]
+    if live[wire.Id] {
+      continue
+    }
+    live[wire.Id] = true
+    for _, driver := range drivers[wire.Id] {
+      stack = append(stack, driver.Inputs...)
+    }
+  }
+
+  changed := false
+  for _, gate := range o.summary.Gates {
+    if o.removed[gate] || gate.Type == BUILTIN_FUNCTION {
+      continue
+    }
+    isLive := false
+    for _, output := range gate.Outputs {
+      isLive = isLive || live[output.Id]
+    }
+    if !isLive {
+      o.removed[gate] = true
+      o.report.DeadGatesRemoved += 1
+      changed = true
+    }
+  }
+  return changed
+}
+
+// Remove every gate that was removed, and every wire that was replaced or was driven by a removed
+// gate and isn't used anymore.
+func (o *optimizer) compact() {
+  o.refresh()
+
+  used := map[int]bool{}
+  var gates []*Gate
+  for _, gate := range o.summary.Gates {
+    if o.removed[gate] {
+      continue
+    }
+    gates = append(gates, gate)
+    for _, wire := range append(append([]*Wire{}, gate.Inputs...), gate.Outputs...) {
+      used[wire.Id] = true
+    }
+  }
+  for _, wire := range o.summary.Outputs {
+    used[wire.Id] = true
+  }
+
+  orphaned := map[int]bool{}
+  for _, gate := range o.summary.Gates {
+    if o.removed[gate] {
+      for _, wire := range gate.Outputs {
+        orphaned[wire.Id] = true
+      }
+    }
+  }
+
+  var wires []*Wire
+  for _, wire := range o.summary.Wires {
+    if _, ok := o.aliases[wire.Id]; ok && !used[wire.Id] {
+      continue
+    }
+    if orphaned[wire.Id] && !used[wire.Id] {
+      continue
+    }
+    wires = append(wires, wire)
+  }
+
+  o.summary.Gates = gates
+  o.summary.Wires = wires
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+  "testing"
+  "reflect"
+  "strings"
+)
+
+func optimize(t *testing.T, source string) (*Summary, *OptimizationReport) {
+  compiler := NewCompiler()
+  compiler.Optimize = true
+  summary, err := compiler.RunString(source)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return summary, compiler.Optimizations
+}
+
+func gateTypes(summary *Summary) []string {
+  types := []string{}
+  for _, gate := range summary.Gates {
+    if gate.Type == BUILTIN_FUNCTION {
+      types = append(types, gate.Label)
+    } else {
+      types = append(types, string(gate.Type))
+    }
+  }
+  return types
+}
+
+func TestOptimizeIsOptIn(t *testing.T) {
+  compiler := NewCompiler()
+  summary, err := compiler.RunString("led(toggle() and 0)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if compiler.Optimizations != nil || len(findGatesByType(summary.Gates, AND)) != 1 {
+    t.Errorf("Source was optimized without asking: %v", gateTypes(summary))
+  }
+}
+
+func TestOptimizeConstants(t *testing.T) {
+  summary, report := optimize(t, "led(toggle() and 0)\nled(toggle() or 0)\nled(toggle() xor 1)\nled(1 nand 1)")
+  if !reflect.DeepEqual(gateTypes(summary), []string{"toggle", "GROUND", "led", "toggle", "led", "toggle", "NOT", "led", "led"}) {
+    t.Errorf("Wrong gates: %v", gateTypes(summary))
+  }
+
+  // `toggle() or 0` is the toggle, and `1 nand 1` is off like `toggle() and 0`.
+  if summary.Gates[4].Inputs[0] != summary.Gates[3].Outputs[0] || summary.Gates[8].Inputs[0] != summary.Gates[1].Outputs[0] {
+    t.Errorf("Leds read the wrong wires: %+v %+v", summary.Gates[4].Inputs, summary.Gates[8].Inputs)
+  }
+  if report.GatesBefore != 16 || report.GatesAfter != 9 {
+    t.Errorf("Wrong report: %+v", report)
+  }
+}
+
+func TestOptimizeBuffers(t *testing.T) {
+  summary, report := optimize(t, "block id(a) {\n  return a\n}\nled(id(id(toggle())))")
+  if !reflect.DeepEqual(gateTypes(summary), []string{"toggle", "led"}) || report.BuffersCollapsed != 4 {
+    t.Errorf("Wrong gates: %v %+v", gateTypes(summary), report)
+  }
+  if summary.Gates[1].Inputs[0] != summary.Gates[0].Outputs[0] {
+    t.Errorf("Led doesn't read the toggle: %+v", summary.Gates[1].Inputs)
+  }
+}
+
+func TestOptimizeCommonSubexpressions(t *testing.T) {
+  summary, report := optimize(t, `
+    let a = toggle()
+    let b = toggle()
+    led(a and b)
+    led(b and a)
+    led(not (a and b))
+    led(not (b and a))
+  `)
+  if !reflect.DeepEqual(gateTypes(summary), []string{"toggle", "toggle", "AND", "led", "led", "NOT", "led", "led"}) || report.SubexpressionsShared != 4 {
+    t.Errorf("Wrong gates: %v %+v", gateTypes(summary), report)
+  }
+}
+
+func TestOptimizeDeadGates(t *testing.T) {
+  summary, report := optimize(t, `
+    let a = toggle()
+    let unused = not (a and a)
+    led(a)
+  `)
+  if !reflect.DeepEqual(gateTypes(summary), []string{"toggle", "led"}) || report.DeadGatesRemoved != 2 {
+    t.Errorf("Wrong gates: %v %+v", gateTypes(summary), report)
+  }
+  for _, wire := range summary.Wires {
+    if wire.Id != summary.Gates[0].Outputs[0].Id {
+      t.Errorf("Wire %d should have been removed", wire.Id)
+    }
+  }
+}
+
+// Optimizing doesn't change what a circuit does, including circuits with state.
+func TestOptimizeKeepsBehavior(t *testing.T) {
+  source := `
+    import counter
+    import adder
+    let clock = momentary()
+    let a b c d = counter8(clock)
+    let s1 s2 s3 s4 carry = adder4(a b c d 1 (b or 0) (c and 1) 0)
+    led(s1) led(s2) led(s3) led(s4) led(carry)
+    led(a xor 1) led(not (d nand 1))
+  `
+  run := func(optimized bool) []string {
+    compiler := NewCompiler()
+    compiler.Optimize = optimized
+    summary, err := compiler.RunString(source)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    simulation := NewSimulation(summary.Gates, summary.Wires)
+    var states []string
+    for step := 0; step < 40; step++ {
+      for index, gate := range summary.Gates {
+        if gate.Label == "momentary" {
+          gate.State = map[bool]string{true: "on", false: "off"}[step % 2 == 0]
+          simulation.MarkDirty(index)
+        }
+      }
+      simulation.Settle()
+
+      leds := ""
+      for _, gate := range summary.Gates {
+        if gate.Label == "led" {
+          leds += gate.State + " "
+        }
+      }
+      states = append(states, strings.TrimSpace(leds))
+    }
+    return states
+  }
+
+  original, optimized := run(false), run(true)
+  if !reflect.DeepEqual(original, optimized) {
+    t.Errorf("Optimizing changed the circuit!\n%v\n%v", original, optimized)
+  }
+}
@@ -2,17 +2,21 @@ package main
 
 import (
   "fmt"
-  "errors"
   "strings"
 )
 
-var wireId int = 0
 type Wire struct {
   Id int
   Desc string
   Start *Gate
   End *Gate
   Powered bool
+
+  // The source that the wire was declared by, and the invocations that it's within. See
+  // `attachSourceMap`.
+  Source SourceSpan
+  Expression string
+  Invocations []InvocationSite `json:",omitempty"`
 }
 
 type GateType string
@@ -20,6 +24,10 @@ const (
   AND GateType = "AND"
   OR = "OR"
   NOT = "NOT"
+  XOR = "XOR"
+  NAND = "NAND"
+  NOR = "NOR"
+  XNOR = "XNOR"
   SOURCE = "SOURCE"
   GROUND = "GROUND"
   BLOCK_INPUT = "BLOCK_INPUT"
@@ -27,7 +35,6 @@ const (
   BUILTIN_FUNCTION = "BUILTIN_FUNCTION"
 )
 
-var gateId int = 0
 type Gate struct {
   Id int
   Type GateType
@@ -39,6 +46,24 @@ type Gate struct {
   // A reference to the id of the block that this gate is within.
   CallingContext int
   State string
+
+  // The source that the gate was created from, the text of that source, and the block invocations
+  // that the gate is within. See `attachSourceMap`.
+  Source SourceSpan
+  Expression string
+  Invocations []InvocationSite `json:",omitempty"`
+}
+
+// A range of source code. Lines and columns start at 1, offsets are the number of bytes from the
+// start of the file, and the end is exclusive.
+type SourceSpan struct {
+  File string `json:",omitempty"`
+  Line int
+  Col int
+  Offset int
+  EndLine int
+  EndCol int
+  EndOffset int
 }
 
 type Variable struct {
@@ -50,6 +75,14 @@ type Block struct {
   Name string
   Content *Node
   InvocationCount int
+
+  // The module that the block was imported within, if it was imported with a namespace.
+  Module *Module
+}
+
+// The declaration that the block was tokenized from.
+func (b *Block) Declaration() *BlockDecl {
+  return b.Content.Data.(*BlockDecl)
 }
 
 type CallingContext struct {
@@ -58,22 +91,33 @@ type CallingContext struct {
   Depth int
   Parent int
   Children []int
+
+  // The invocation that created the context.
+  Source SourceSpan
 }
 
-var stackFrameId int = 0
 type StackFrame struct {
   Id int
   Variables []*Variable
   Blocks []*Block
+  Buses []*Bus
+}
+
+// The type of gate that each binary operator token creates.
+var BINARY_OPERATOR_GATE_TYPES map[string]GateType = map[string]GateType{
+  "OP_AND": AND,
+  "OP_OR": OR,
+  "OP_XOR": XOR,
+  "OP_NAND": NAND,
+  "OP_NOR": NOR,
+  "OP_XNOR": XNOR,
 }
 
 var BUILTIN_FUNCTION_NAMES []string =        []string{"led", "wave", "momentary", "toggle", "tflipflop"}
 var BUILTIN_FUNCTION_MINIMUM_INPUT_NUMBER []int=[]int{1    , 1     , 0          , 0       , 2}
 var BUILTIN_FUNCTION_RETURN_NUMBER []int=       []int{0    , 1     , 1          , 1       , 2}
 
-var INVOCATION_MAX_RECURSION_DEPTH = 100
-
-func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingContext, []*Wire, error) {
+func (c *Compiler) Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingContext, []*Wire, error) {
   gates := []*Gate{}
   wires := []*Wire{}
   contexts := []*CallingContext{}
@@ -89,20 +133,30 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     break
 
   case "OP_AND": fallthrough
-  case "OP_OR":
+  case "OP_OR": fallthrough
+  case "OP_XOR": fallthrough
+  case "OP_NAND": fallthrough
+  case "OP_NOR": fallthrough
+  case "OP_XNOR":
     var lhsOutput *Wire
     var rhsOutput *Wire
 
-    var gateType GateType
-    if input.Token == "OP_AND" {
-      gateType = AND
-    } else {
-      gateType = OR
+    gateType := BINARY_OPERATOR_GATE_TYPES[input.Token]
+    lhs, rhs := input.Operands()
+
+    // The tokenizer's validator rejects operators that are missing an operand, but a gate must never
+    // be built with a nil input, so check again here.
+    if lhs == nil || rhs == nil {
+      return nil, nil, nil, nil, NewNodeError(SYNTAX_ERROR, input, fmt.Sprintf(
+        "%s gate at %s is missing an operand. Stop.",
+        input.Token,
+        formatPosition(input.File, input.Line, input.Col),
+      ))
     }
 
     // Parse the left hand side of the gate.
-    if lhs, ok := input.Data["LeftHandSide"].(Node); ok {
-      lhsGates, lhsWires, lhsContexts, outputs, err := Parse(&[]Node{lhs}, stack)
+    if lhs != nil {
+      lhsGates, lhsWires, lhsContexts, outputs, err := c.Parse(&[]Node{*lhs}, stack)
       if err != nil {
         return nil, nil, nil, nil, err
       }
@@ -110,19 +164,17 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // Ensure that there is only one output from the thing on the left hand side (an and gate can
       // only operate on a single value)
       if len(outputs) > 1 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Left hand side of %s gate at %d:%d outputs multiple values in a single value context. Stop.",
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Left hand side of %s gate at %s outputs multiple values in a single value context. Stop.",
           input.Token,
-          input.Row,
-          input.Col,
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       if len(outputs) == 0 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Left hand side of %s gate at %d:%d outputs zero values in a single value context. Stop.",
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Left hand side of %s gate at %s outputs zero values in a single value context. Stop.",
           input.Token,
-          input.Row,
-          input.Col,
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       lhsOutput = outputs[0]
@@ -134,26 +186,26 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     }
 
     // Parse the right hand side of the gate.
-    if rhs, ok := input.Data["RightHandSide"].(Node); ok {
-      rhsGates, rhsWires, rhsContexts, outputs, err := Parse(&[]Node{rhs}, stack)
+    if rhs != nil {
+      rhsGates, rhsWires, rhsContexts, outputs, err := c.Parse(&[]Node{*rhs}, stack)
       if err != nil {
         return nil, nil, nil, nil, err
       }
 
-      // Ensure that thre is only one output from the thing on the left hand side (an and gate can
+      // Ensure that there is only one output from the thing on the right hand side (an and gate can
       // only operate on a single value)
       if len(outputs) > 1 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Right hand side of and gate at %d:%d outputs multiple values in a single value context. Stop.",
-          input.Row,
-          input.Col,
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Right hand side of %s gate at %s outputs multiple values in a single value context. Stop.",
+          input.Token,
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       if len(outputs) == 0 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Right hand side of and gate at %d:%d outputs zero values in a single value context. Stop.",
-          input.Row,
-          input.Col,
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Right hand side of %s gate at %s outputs zero values in a single value context. Stop.",
+          input.Token,
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       rhsOutput = outputs[0]
@@ -165,15 +217,15 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     }
 
     // Add a new wire as output
-    wireId += 1
-    wire := &Wire{ Id: wireId }
+    c.wireId += 1
+    wire := &Wire{ Id: c.wireId }
     wires = append(wires, wire)
     outputs = append(outputs, wire)
 
     // Create the gate, using the wire we just created as the single output of the and gate.
-    gateId += 1
+    c.gateId += 1
     gates = append(gates, &Gate{
-      Id: gateId,
+      Id: c.gateId,
       Type: gateType,
 
       Inputs: append(append([]*Wire{}, lhsOutput), rhsOutput),
@@ -181,6 +233,7 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
       // The stack frame that this gate is within
       CallingContext: stack[len(stack)-1].Id,
+      Source: input.Span(),
     })
 
     // Remove token that was just parsed.
@@ -188,27 +241,32 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
   case "OP_NOT":
     var rhsOutput *Wire
+    if _, rhs := input.Operands(); rhs == nil {
+      return nil, nil, nil, nil, NewNodeError(SYNTAX_ERROR, input, fmt.Sprintf(
+        "Not gate at %s is missing its right hand side. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+      ))
+    }
+
     // Parse the right hand side of the gate.
-    if rhs, ok := input.Data["RightHandSide"].(Node); ok {
-      rhsGates, rhsWires, rhsContexts, outputs, err := Parse(&[]Node{rhs}, stack)
+    if _, rhs := input.Operands(); rhs != nil {
+      rhsGates, rhsWires, rhsContexts, outputs, err := c.Parse(&[]Node{*rhs}, stack)
       if err != nil {
         return nil, nil, nil, nil, err
       }
 
-      // Ensure that thre is only one output from the thing on the left hand side (an and gate can
+      // Ensure that there is only one output from the thing on the right hand side (an and gate can
       // only operate on a single value)
       if len(outputs) > 1 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Right hand side of a not gate at %d:%d outputs multiple values in a single value context. Stop.",
-          input.Row,
-          input.Col,
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Right hand side of a not gate at %s outputs multiple values in a single value context. Stop.",
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       if len(outputs) == 0 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Right hand side of not gate at %d:%d outputs zero values in a single value context. Stop.",
-          input.Row,
-          input.Col,
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Right hand side of not gate at %s outputs zero values in a single value context. Stop.",
+          formatPosition(input.File, input.Line, input.Col),
         ))
       }
       rhsOutput = outputs[0]
@@ -220,21 +278,22 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     }
 
     // Add a new wire as output
-    wireId += 1
-    wire := &Wire{ Id: wireId }
+    c.wireId += 1
+    wire := &Wire{ Id: c.wireId }
     wires = append(wires, wire)
     outputs = append(outputs, wire)
 
     // Create the gate, using the wire we just created as the single output of the and gate.
-    gateId += 1
+    c.gateId += 1
     gates = append(gates, &Gate{
-      Id: gateId,
+      Id: c.gateId,
       Type: NOT,
       Inputs: append([]*Wire{}, rhsOutput),
       Outputs: []*Wire{ wire },
 
       // The stack frame that this gate is within
       CallingContext: stack[len(stack)-1].Id,
+      Source: input.Span(),
     })
 
     // Remove token that was just parsed.
@@ -242,8 +301,17 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
   case "ASSIGNMENT":
     // fmt.Printf("/ Assigning! Token = %+v\n", input)
-    if names, ok := input.Data["Names"].(string); ok {
-      numberOfLhsValues := len(strings.Split(names, " "))
+    if assignment, ok := input.Data.(*Assignment); ok {
+      // Any buses on the left hand side are assigned one wire at a time.
+      variableNames, buses, err := expandBusDeclarations(strings.Split(assignment.Names, " "))
+      if err != nil {
+        return nil, nil, nil, nil, NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+          "Error: %s, in the assignment at %s. Stop.",
+          err,
+          formatPosition(input.File, input.Line, input.Col),
+        ))
+      }
+      numberOfLhsValues := len(variableNames)
       // fmt.Printf("  * assignment takes %d parameters\n", numberOfLhsValues)
 
       // First, extract all the tokens after the assignment (rhs) that are assigned to the variabled
@@ -252,10 +320,9 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       for len(rhsValues) < numberOfLhsValues {
         // Ensure that the there are still tokens to pull from
         if len(*inputs) <= 1 {
-          return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-            "Assignment at %d:%d has more variables on the left hand side (%d) than tokens on the right hand side to assign (%d). Stop.",
-            input.Row,
-            input.Col,
+          return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+            "Assignment at %s has more variables on the left hand side (%d) than tokens on the right hand side to assign (%d). Stop.",
+            formatPosition(input.File, input.Line, input.Col),
             numberOfLhsValues,
             len(rhsValues),
           ))
@@ -267,19 +334,17 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
         // Verify that the token is of the proper type.
         if !TokenNameIsExtendedExpression(parameter.Token) {
-          return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-            "Token that is after assignment (assignment is at %d:%d, token is at %d:%d) and trying to be assigned to variable `%s` is not an expression (is %s). Stop.\n",
-            input.Row,
-            input.Col,
-            parameter.Row,
-            parameter.Col,
-            strings.Split(names, " ")[len(rhsValues)],
+          return nil, nil, nil, nil, NewNodeError(VALIDATION_ERROR, parameter, fmt.Sprintf(
+            "Token that is after assignment (assignment is at %s, token is at %s) and trying to be assigned to variable `%s` is not an expression (is %s). Stop.\n",
+            formatPosition(input.File, input.Line, input.Col),
+            formatPosition(parameter.File, parameter.Line, parameter.Col),
+            variableNames[len(rhsValues)],
             parameter.Token,
           ))
         }
 
         // Execute it
-        paramGates, paramWires, paramContexts, paramOutputs, err := Parse(&[]Node{parameter}, stack)
+        paramGates, paramWires, paramContexts, paramOutputs, err := c.Parse(&[]Node{parameter}, stack)
 
         // Bubble errors up from the invocation
         if err != nil {
@@ -290,12 +355,10 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
         // Ensure that the parameter, when evaluated, returns outputs.
         if len(paramOutputs) == 0 {
           // fmt.Printf("PARAM %+v %+v %+v\n", parameter, paramGates, paramWires)
-          return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-            "Parameter to assignment (assignment located at %d:%d, parameter located at %d:%d) outputted no values after being evaluated, please remove from assignment. Stop.\n",
-            input.Row,
-            input.Col,
-            parameter.Row,
-            parameter.Col,
+          return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+            "Parameter to assignment (assignment located at %s, parameter located at %s) outputted no values after being evaluated, please remove from assignment. Stop.\n",
+            formatPosition(input.File, input.Line, input.Col),
+            formatPosition(parameter.File, parameter.Line, parameter.Col),
           ))
         }
 
@@ -312,7 +375,18 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
         *inputs = append([]Node{input}, (*inputs)[2:]...)
       }
 
-      for ct, name := range strings.Split(names, " ") {
+      // A bus must be assigned exactly as many wires as it is wide, so a value can't be silently
+      // dropped.
+      if len(buses) > 0 && len(rhsValues) != numberOfLhsValues {
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Assignment at %s assigns %d wires to %d wires on the left hand side. Stop.",
+          formatPosition(input.File, input.Line, input.Col),
+          len(rhsValues),
+          numberOfLhsValues,
+        ))
+      }
+
+      for ct, name := range variableNames {
         // The variable _ is a throwaway value. Any assignments to it should be skipped.
         if name == "_" { continue }
 
@@ -358,33 +432,54 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
         wires = append(wires, rhsValues[ct])
       }
+      stack[len(stack) - 1].Buses = append(stack[len(stack) - 1].Buses, buses...)
 
       // Remove token that was just parsed.
       *inputs = (*inputs)[1:]
       // fmt.Println("Tokens left:", inputs)
     } else {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "The name within the assignment at %d:%d isn't a valid string - got %s. Stop.\n",
-        input.Row,
-        input.Col,
-        input.Data["Value"],
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The assignment at %s doesn't have any names to assign to - got %T. Stop.\n",
+        formatPosition(input.File, input.Line, input.Col),
+        input.Data,
       ))
     }
 
   case "INVOCATION":
     var block *Block
 
-    if value, ok := input.Data["Name"].(string); ok {
+    if invocation, ok := input.Data.(*Invocation); ok {
+      value := invocation.Name
+
       // Check to see if the invocation refers to a builtin function instead. These are converted
       // into a special gate type, `BUILTIN_FUNCTION`
       for builtinIndex, builtinName := range BUILTIN_FUNCTION_NAMES {
         if value == builtinName {
           var builtinInputs []*Wire = []*Wire{}
+          state := ""
+          children, err := c.expandGenerates(*input.Children)
+          if err != nil {
+            return nil, nil, nil, nil, err
+          }
+          children, err = orderBuiltinArguments(builtinName, input, children)
+          if err != nil {
+            return nil, nil, nil, nil, err
+          }
+          input.Children = &children
+
+          // A wave takes compile-time integer arguments after its enable input, which are stored in
+          // the state of the gate.
+          if builtinName == "wave" {
+            children, state, err = parseWaveArguments(input)
+            if err != nil {
+              return nil, nil, nil, nil, err
+            }
+          }
 
           // Add a wire to each input to the `builtinInputs` slice.
-          for _, child := range *input.Children {
+          for _, child := range children {
             // Execute each parameter passed into the invocation to get an output wire to its result.
-            paramGates, paramWires, paramContexts, paramOutputs, err := Parse(&[]Node{child}, stack)
+            paramGates, paramWires, paramContexts, paramOutputs, err := c.Parse(&[]Node{child}, stack)
 
             // Bubble errors up from the invocation
             if err != nil {
@@ -400,19 +495,18 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
           // Ensure that the builtin was called with enough parameters
           if len(builtinInputs) < BUILTIN_FUNCTION_MINIMUM_INPUT_NUMBER[builtinIndex] {
-            return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-              "The buitin block at %d:%d wasn't called with enough parameters (expected at least %d, was called with %d). Stop.",
-              input.Row,
-              input.Col,
+            return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+              "The buitin block at %s wasn't called with enough parameters (expected at least %d, was called with %d). Stop.",
+              formatPosition(input.File, input.Line, input.Col),
               BUILTIN_FUNCTION_RETURN_NUMBER[builtinIndex],
               len(builtinInputs),
             ))
           }
 
           // Create a new gate with those inputs from `builtinInputs`
-          gateId += 1
+          c.gateId += 1
           gate := &Gate{
-            Id: gateId,
+            Id: c.gateId,
             Type: BUILTIN_FUNCTION,
             Label: builtinName,
 
@@ -421,13 +515,15 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
             // The stack frame that this gate is within
             CallingContext: stack[len(stack)-1].Id,
+            State: state,
+            Source: input.Span(),
           }
           gates = append(gates, gate)
 
           // Create a new wire for each output, and add each to the outputs.
           for i := 0; i < BUILTIN_FUNCTION_RETURN_NUMBER[builtinIndex]; i++ {
-            wireId += 1
-            wire := &Wire{ Id: wireId }
+            c.wireId += 1
+            wire := &Wire{ Id: c.wireId }
             wires = append(wires, wire)
 
             gate.Outputs = append(gate.Outputs, wire)
@@ -442,22 +538,13 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // (end builtin code)
 
       // Look through the stack, from top to bottom, to find an identifier that matches.
-      BlockOuter:
-      for i := len(stack) - 1; i >= 0; i-- {
-        for _, blk := range stack[i].Blocks {
-          if blk.Name == value {
-            block = blk
-            break BlockOuter;
-          }
-        }
-      }
+      block = findBlock(stack, value)
 
       // Ensure that the invokation is inkoving something that can be invoked.
       if block == nil {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "The invocation at %d:%d (trying to invoke %s) doesn't invoke a block that can be found in the current or any parent scope. Stop.\n",
-          input.Row,
-          input.Col,
+        return nil, nil, nil, nil, NewNodeError(UNDEFINED_BLOCK, input, fmt.Sprintf(
+          "The invocation at %s (trying to invoke %s) doesn't invoke a block that can be found in the current or any parent scope. Stop.\n",
+          formatPosition(input.File, input.Line, input.Col),
           value,
         ))
       }
@@ -467,64 +554,95 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // Increment the invocation count for the block
       block.InvocationCount += 1
 
+      // If the block accepts constants, invoke a copy of the block with the values of its constants
+      // filled in.
+      content, name, err := c.instantiateBlock(block, input)
+      if err != nil {
+        return nil, nil, nil, nil, err
+      }
+      block = &Block{Name: name, Content: content, InvocationCount: block.InvocationCount, Module: block.Module}
+
       // For each parameter passed into the invocation, execute it and get a reference to it to link
       // to each value that is in the context of the invocation.
+      arguments, err := c.expandGenerates(*input.Children)
+      if err != nil {
+        return nil, nil, nil, nil, err
+      }
+      positional, named, err := splitNamedArguments(input, arguments)
+      if err != nil {
+        return nil, nil, nil, nil, err
+      }
+
       var vars []*Variable
-      for ct, child := range *input.Children {
-        // Execute each parameter passed into the invocation to get an output wire to its result.
-        paramGates, paramWires, paramContexts, paramOutputs, err := Parse(&[]Node{child}, stack)
+      for ct, child := range positional {
+        // A bus that is passed to a block must be passed to a bus parameter of the same width.
+        if width, ok := nodeBusWidth(child, stack); ok {
+          if err := checkBusArgument(block, child, len(vars), width); err != nil {
+            return nil, nil, nil, nil, err
+          }
+        }
 
-        // Bubble errors up from the invocation
+        argumentGates, argumentWires, argumentContexts, argumentVars, err := c.bindArgument(block, input, child, ct, len(vars), stack)
         if err != nil {
           return nil, nil, nil, nil, err
         }
 
         // Add gates and generated to master collections.
-        gates = append(gates, paramGates...)
-        wires = append(wires, paramWires...)
-        contexts = append(contexts, paramContexts...)
-
-        // But add each output from invoking into the variables slice to use to perform the actual
-        // invocation, joining through a special type of gate called "BLOCK_INPUT" to denote that
-        // we're entering a block.
-        for _, output := range paramOutputs {
-          numberOfVars := len(vars) - 1
+        gates = append(gates, argumentGates...)
+        wires = append(wires, argumentWires...)
+        contexts = append(contexts, argumentContexts...)
+        vars = append(vars, argumentVars...)
+      }
 
-          // Create a wire to join between the block input node and the bound variable
-          wireId += 1
-          wire := &Wire{ Id: wireId }
-          wires = append(wires, wire)
+      // Then, bind each argument that was passed by name, and the default of each parameter that
+      // wasn't passed.
+      bound, err := bindNamedArguments(block, input, named, len(vars))
+      if err != nil {
+        return nil, nil, nil, nil, err
+      }
+      for index, argument := range bound {
+        argumentGates, argumentWires, argumentContexts, argumentVars, err := c.bindArgument(
+          block,
+          input,
+          argument.Value,
+          len(positional) + index,
+          argument.Parameter.Start,
+          stack,
+        )
+        if err != nil {
+          return nil, nil, nil, nil, err
+        }
 
-          // Create a new block input gate to express that we're entering a block.
-          gateId += 1
-          gates = append(gates, &Gate{
-            Id: gateId,
-            Type: BLOCK_INPUT,
-            Label: fmt.Sprintf("Input %d into block %s invocation %d", ct, block.Name, block.InvocationCount),
-            Inputs: []*Wire{output}, /* parameter => BLOCK_INPUT */
-            Outputs: []*Wire{wire}, /* BLOCK_INPUT => variable bound in local scope */
-
-            // The id of the new stack frame that is about to be created.
-            CallingContext: stackFrameId + 1,
-          })
-
-          params := strings.Split(block.Content.Data["Params"].(string), " ")
-          if (len(params) - 1) < numberOfVars + 1 {
-            fmt.Println(block.Content)
-            return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-              "The invocation at %d:%d (trying to invoke %s) is invoking the block with too many parameters (expected %d, received %d). Stop.\n",
-              input.Row,
-              input.Col,
-              block.Name,
-              block.Content.Data["InputQuantity"],
-              len(*input.Children),
-            ))
-          }
-          vars = append(vars, &Variable{
-            Name: params[numberOfVars+1],
-            Value: wire,
-          })
+        // Unlike arguments passed by position, an argument passed by name is bound to exactly one
+        // parameter.
+        if len(argumentVars) != argument.Parameter.Width {
+          return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, argument.Value, fmt.Sprintf(
+            "The argument passed to parameter %s of block %s at %s is %d wires wide, but the parameter is %d wires wide. Stop.",
+            argument.Parameter.Name,
+            block.Name,
+            formatPosition(argument.Value.File, argument.Value.Line, argument.Value.Col),
+            len(argumentVars),
+            argument.Parameter.Width,
+          ))
         }
+
+        gates = append(gates, argumentGates...)
+        wires = append(wires, argumentWires...)
+        contexts = append(contexts, argumentContexts...)
+        vars = append(vars, argumentVars...)
+      }
+
+      // Blocks with bus parameters must be passed a wire for every parameter, so that a bus that's
+      // too narrow isn't silently padded with wires that are always off.
+      buses := block.Declaration().Buses
+      if params := strings.Fields(block.Declaration().Params); len(buses) > 0 && len(vars) < len(params) {
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "The invocation at %s (trying to invoke %s) is invoking the block with too few parameters (expected %d, received %d). Stop.\n",
+          formatPosition(input.File, input.Line, input.Col),
+          block.Name,
+          len(params),
+          len(vars),
+        ))
       }
 
       var deref_vars []Variable
@@ -535,23 +653,28 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // that were passed in as parameters as defines in the new stack frame. Also, add a new block
       // called `__self` tht points to the current block. This allows other functions later on to
       // get the reference to the block that it is contained within (one example is BLOCK_RETURN).
-      stackFrameId += 1
+      // A block from a module can also invoke the other blocks within the module by name.
+      invocationBlocks := []*Block{}
+      if block.Module != nil {
+        invocationBlocks = append(invocationBlocks, block.Module.Blocks...)
+      }
+      invocationBlocks = append(invocationBlocks, &Block{Name: "__self", Content: block.Content})
+
+      c.stackFrameId += 1
       invocationStack := append(stack, &StackFrame{
-        Id: stackFrameId,
+        Id: c.stackFrameId,
         Variables: vars,
-        Blocks: []*Block{
-          &Block{Name: "__self", Content: block.Content},
-        },
+        Blocks: invocationBlocks,
+        Buses: blockBuses(block),
       })
 
       // Verify that the user hasn't called deeper into the stack then they should
-      if INVOCATION_MAX_RECURSION_DEPTH > 0 && len(invocationStack) > INVOCATION_MAX_RECURSION_DEPTH {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "The invocation at %d:%d (trying to invoke %s) has surpassed the max call depth of %d. Stop.\n",
-          input.Row,
-          input.Col,
+      if c.MaxRecursionDepth > 0 && len(invocationStack) > c.MaxRecursionDepth {
+        return nil, nil, nil, nil, NewNodeError(MAX_CALL_DEPTH, input, fmt.Sprintf(
+          "The invocation at %s (trying to invoke %s) has surpassed the max call depth of %d. Stop.\n",
+          formatPosition(input.File, input.Line, input.Col),
           block.Name,
-          INVOCATION_MAX_RECURSION_DEPTH,
+          c.MaxRecursionDepth,
         ))
       }
 
@@ -559,11 +682,12 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // information that was put onto the stack. but this collection is insert only.
       parentContextId := invocationStack[(len(invocationStack) - 1) - 1].Id
       contexts = append(contexts, &CallingContext{
-        Id: stackFrameId,
+        Id: c.stackFrameId,
         Name: block.Name,
         Depth: len(invocationStack) - 1,
         Parent: parentContextId,
         Children: []int{},
+        Source: input.Span(),
       });
 
       // Make a copy of the children within the block so that they can be destructively mutated
@@ -572,9 +696,9 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
       // Execute the invocation
       for len(blockChildren) > 0 {
-        headToken := blockChildren[0].Token
+        head := blockChildren[0]
 
-        invocationResultGates, invocationResultWires, invocationResultContexts, invocationResultOutputs, err := Parse(
+        invocationResultGates, invocationResultWires, invocationResultContexts, invocationResultOutputs, err := c.Parse(
           &blockChildren,
           invocationStack,
         )
@@ -591,18 +715,18 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
         // If a return token is found, take each value that is outputted, connect it to a
         // `BLOCK_OUTPUT` node, and put the output wire of that `BLOCK_OUTPUT` node in the outputs
         // for this action.
-        if headToken == "BLOCK_RETURN" {
+        if head.Token == "BLOCK_RETURN" {
           // fmt.Println("  * block has return!")
           for ct, output := range invocationResultOutputs {
             // Create a wire to join between the block output node and the bound variable
-            wireId += 1
-            wire := &Wire{ Id: wireId }
+            c.wireId += 1
+            wire := &Wire{ Id: c.wireId }
             wires = append(wires, wire)
 
             // Create a new block output gate to express that we're leaving a block.
-            gateId += 1
+            c.gateId += 1
             gates = append(gates, &Gate{
-              Id: gateId,
+              Id: c.gateId,
               Type: BLOCK_OUTPUT,
               Label: fmt.Sprintf("Output %d from block %s invocation %d", ct, block.Name, block.InvocationCount),
               Inputs: []*Wire{output}, /* parameter => BLOCK_OUTPUT */
@@ -610,6 +734,7 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
               // The stack frame that this gate is within
               CallingContext: invocationStack[len(invocationStack)-1].Id,
+              Source: head.Span(),
             })
 
             // Add the output wire to the outputs for the block.
@@ -621,9 +746,30 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
       // fmt.Println("\\ Done Invoking block: ", block)
       // Remove token that was just parsed.
-      *inputs = (*inputs)[:len(*inputs) - 1]
+      *inputs = (*inputs)[1:]
     }
 
+  case "TEST":
+    // Tests are only run by `lovel test`. See `RunTests`.
+    *inputs = (*inputs)[1:]
+
+  case "ARGUMENT_NAME":
+    return nil, nil, nil, nil, NewNodeError(VALIDATION_ERROR, input, fmt.Sprintf(
+      "The argument %s at %s isn't within an invocation. Stop.",
+      input.Data.(*ArgumentName).Name,
+      formatPosition(input.File, input.Line, input.Col),
+    ))
+
+  case "GENERATE_FOR": fallthrough
+  case "GENERATE_IF": fallthrough
+  case "GENERATE_ELSE":
+    // Replace the generate with the nodes that it expands into, which are parsed next.
+    unrolled, consumed, err := c.unrollGenerate(*inputs, nil)
+    if err != nil {
+      return nil, nil, nil, nil, err
+    }
+    *inputs = append(unrolled, (*inputs)[consumed:]...)
+
   case "BLOCK_RETURN":
     // Look for the special block defined called `__self`, and figure out how many of the next
     // tokens to evaluate and add as outputs.
@@ -638,24 +784,35 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
     // Ensure that the parent of the currently invoked function exists.
     if self == nil {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "Couldn't find the parent of the currently invoked function, on %d:%d.",
-        input.Row,
-        input.Col,
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "Couldn't find the parent of the currently invoked function, on %s.",
+        formatPosition(input.File, input.Line, input.Col),
       ))
     }
 
-    // Fetch the number of outputs required from the block we're within.
-    numberOfOutputs := self.Data["OutputQuantity"].(int)
+    // Every token after the return is returned. Usually, this is the same as the number of outputs
+    // that the tokenizer found for the block, but a return can also be within an `if` that was
+    // expanded into the block. Each token can output more than one wire (ie, a bus).
+    numberOfOutputs := len(*inputs) - 1
     // fmt.Println("* block return expects this many outputs:", numberOfOutputs)
 
-    for len(outputs) < numberOfOutputs {
+    for parsed := 0; parsed < numberOfOutputs; parsed++ {
       // Get the token after the current token
       parameter := (*inputs)[1]
       // fmt.Printf("  * found new token after return: %+v\n", parameter)
 
+      // Ensure that only expressions are returned, since a return that was within an `if` can be
+      // followed by other statements.
+      if !TokenNameIsExtendedExpression(parameter.Token) {
+        return nil, nil, nil, nil, NewNodeError(VALIDATION_ERROR, parameter, fmt.Sprintf(
+          "Non-expression token %s found after the return at %s, returns must be at the end of a block. Stop.",
+          parameter.Token,
+          formatPosition(input.File, input.Line, input.Col),
+        ))
+      }
+
       // Execute it
-      paramGates, paramWires, paramContexts, paramOutputs, err := Parse(&[]Node{parameter}, stack)
+      paramGates, paramWires, paramContexts, paramOutputs, err := c.Parse(&[]Node{parameter}, stack)
 
       // Bubble errors up from the invocation
       if err != nil {
@@ -665,12 +822,10 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
 
       // Ensure that the parameter, when evaluated, returns outputs.
       if len(paramOutputs) == 0 {
-        return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-          "Parameter to assignment (assignment located at %d:%d, parameter located at %d:%d) outputted no values after being evaluated, please remove from assignment. Stop.\n",
-          input.Row,
-          input.Col,
-          parameter.Row,
-          parameter.Col,
+        return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+          "Parameter to assignment (assignment located at %s, parameter located at %s) outputted no values after being evaluated, please remove from assignment. Stop.\n",
+          formatPosition(input.File, input.Line, input.Col),
+          formatPosition(parameter.File, parameter.Line, parameter.Col),
         ))
       }
 
@@ -691,11 +846,10 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     // There should be no tokens left in the input array after the block return that haven't already
     // been parsed.
     if !( len(*inputs) == 1 && (*inputs)[0].Token == "BLOCK_RETURN" ) {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "Block %s at %d:%d has too many return values, expected %d, got %d. Stop.\n",
-        self.Data["Name"],
-        input.Row,
-        input.Col,
+      return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+        "Block %s at %s has too many return values, expected %d, got %d. Stop.\n",
+        self.Data.(*BlockDecl).Name,
+        formatPosition(input.File, input.Line, input.Col),
         numberOfOutputs,
         numberOfOutputs + len(*inputs),
       ))
@@ -704,42 +858,24 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     *inputs = (*inputs)[:len(*inputs) - 1]
 
   case "IDENTIFIER":
-    if value, ok := input.Data["Value"].(string); ok {
-      // Look through the stack, from top to bottom, to find an identifier that matches.
-      var wire *Wire
-
-      IdentifierOuter:
-      for i := len(stack) - 1; i >= 0; i-- {
-        for _, variable := range stack[i].Variables {
-          if variable.Name == value {
-            wire = variable.Value
-            break IdentifierOuter;
-          }
-        }
-      }
-
-      // Ensure that a variable was found.
-      // if wire == nil {
-      //   return nil, nil, nil, errors.New(fmt.Sprintf(
-      //     "The variable `%s` found at %d:%d could not be found in the stack (did you assign it before usign it?). Stop.\n",
-      //     value,
-      //     input.Row,
-      //     input.Col,
-      //   ))
-      // }
+    if identifier, ok := input.Data.(*Identifier); ok {
+      value := identifier.Value
 
-      if wire == nil {
-        // Make a new wire
-        wireId += 1
-        wire = &Wire{Id: wireId, Desc: fmt.Sprintf("for implicitly declared variable %s", value)}
+      // An identifier that refers to a bus outputs every wire in the bus.
+      if bus := findBus(stack, value); bus != nil {
+        for index := 0; index < bus.Width; index++ {
+          wire := c.lookupVariable(busWireName(value, index), input, stack)
+          wires = append(wires, wire)
+          outputs = append(outputs, wire)
+        }
 
-        // Implicity declare a variable linked to that wire
-        stack[len(stack) - 1].Variables = append(stack[len(stack) - 1].Variables, &Variable{
-          Name: value,
-          Value: wire,
-        })
+        // Remove token that was just parsed.
+        *inputs = (*inputs)[1:]
+        break
       }
 
+      wire := c.lookupVariable(value, input, stack)
+
       // Add wire to all wires, and to output.
       wires = append(wires, wire)
       outputs = append(outputs, wire)
@@ -747,25 +883,63 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
       // Remove token that was just parsed.
       *inputs = (*inputs)[1:]
     } else {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "The value within the identifier at %d:%d isn't a valid stril - got %s. Stop.",
-        input.Row,
-        input.Col,
-        input.Data["Value"],
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The identifier at %s doesn't have a name - got %T. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        input.Data,
+      ))
+    }
+
+  case "BUS_INDEX":
+    index := input.Data.(*BusIndex)
+    name, start, end := index.Name, index.Start, index.End
+
+    // An index that is still an expression refers to a constant that isn't defined, since constants
+    // are replaced when the block that defines them is invoked.
+    if !index.IsResolved() {
+      err := index.copyData().(*BusIndex).resolve(nil)
+      return nil, nil, nil, nil, NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+        "Error: %s, at %s. Stop.",
+        err,
+        formatPosition(input.File, input.Line, input.Col),
       ))
     }
 
+    // Buses that haven't been declared yet (ie, a bus that is assigned later on to create a loop)
+    // can't be checked.
+    if bus := findBus(stack, name); bus != nil && end > bus.Width {
+      return nil, nil, nil, nil, NewNodeError(ARITY_ERROR, input, fmt.Sprintf(
+        "The index at %s is past the end of bus %s, which is %d bits wide. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        name,
+        bus.Width,
+      ))
+    }
+
+    for index := start; index < end; index++ {
+      wire := c.lookupVariable(busWireName(name, index), input, stack)
+      wires = append(wires, wire)
+      outputs = append(outputs, wire)
+    }
+
+    // Remove token that was just parsed.
+    *inputs = (*inputs)[1:]
+
   case "GROUP":
     if input.Children == nil {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "The children attribute within the group at %d:%d is nil. Stop.",
-        input.Row,
-        input.Col,
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The children attribute within the group at %s is nil. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
       ))
     }
 
-    for _, child := range *input.Children {
-      childGates, childWires, childContexts, childOutputs, err := Parse(&[]Node{child}, stack)
+    children, err := c.expandGenerates(*input.Children)
+    if err != nil {
+      return nil, nil, nil, nil, err
+    }
+
+    for _, child := range children {
+      childGates, childWires, childContexts, childOutputs, err := c.Parse(&[]Node{child}, stack)
       if err != nil {
         return nil, nil, nil, nil, err
       }
@@ -779,70 +953,89 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
     *inputs = (*inputs)[1:]
 
   case "BLOCK":
-    if name, ok := input.Data["Name"].(string); ok {
+    if declaration, ok := input.Data.(*BlockDecl); ok {
+      name := declaration.Name
+
       // Add the block to the latest stackframe, in the blocks section.
-      stack[len(stack) - 1].Blocks = append(stack[len(stack) - 1].Blocks, &Block{
-        Name: name,
-        Content: &input,
-      })
+      c.defineBlock(&Block{Name: name, Content: &input}, stack)
 
       // Remove token that was just parsed.
       *inputs = (*inputs)[1:]
     } else {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "The block at %d:%d doesn't have a name, instead found %s. Stop.",
-        input.Row,
-        input.Col,
-        input.Data["Name"],
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The block at %s doesn't have a name, instead found %T. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        input.Data,
       ))
     }
 
-  case "BOOL":
-    if value, ok := input.Data["Value"].(bool); ok {
-      // Figure out the type of signal we have
-      var gateType GateType
-      if value {
-        gateType = SOURCE
-      } else {
-        gateType = GROUND
-      }
+  case "MODULE":
+    // Add each block within the module to the latest stackframe, under its qualified name.
+    module, err := newModule(input)
+    if err != nil {
+      return nil, nil, nil, nil, err
+    }
+    for _, block := range module.Blocks {
+      c.defineBlock(&Block{
+        Name: qualifiedBlockName(module.Name, block.Name),
+        Content: block.Content,
+        Module: block.Module,
+      }, stack)
+    }
 
-      // Add a new wire connected to voltage or ground
-      wireId += 1
-      wire := &Wire{ Id: wireId }
-      wires = append(wires, wire)
+    // Remove token that was just parsed.
+    *inputs = (*inputs)[1:]
+
+  case "BOOL":
+    if value, ok := input.Data.(*Bool); ok {
+      gate := c.constantGate(value.Value, input, stack)
+      gates = append(gates, gate)
+      wires = append(wires, gate.Outputs[0])
 
       // The wire is also an output of the bool, so add it to the outputs
-      outputs = append(outputs, wire)
+      outputs = append(outputs, gate.Outputs[0])
 
-      // Create a gate that represents voltage or ground that the wire attaches to.
-      gateId += 1
-      gates = append(gates, &Gate{
-        Id: gateId,
-        Type: gateType,
-        Inputs: []*Wire{},
-        Outputs: []*Wire{wire},
+      // Remove token that was just parsed.
+      *inputs = (*inputs)[1:]
+    } else {
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The value within the boolean at %s isn't true or false - got %T. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        input.Data,
+      ))
+    }
 
-        // The stack frame that this gate is within
-        CallingContext: stack[len(stack)-1].Id,
-      })
+  case "LITERAL":
+    if literal, ok := input.Data.(*Literal); ok {
+      // A literal is a bool for each of its bits.
+      for _, value := range literal.Bits {
+        gate := c.constantGate(value, input, stack)
+        gates = append(gates, gate)
+        wires = append(wires, gate.Outputs[0])
+        outputs = append(outputs, gate.Outputs[0])
+      }
 
       // Remove token that was just parsed.
       *inputs = (*inputs)[1:]
     } else {
-      return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-        "The value within the boolean at %d:%d isn't true or false - got %s. Stop.",
-        input.Row,
-        input.Col,
-        input.Data["Value"],
+      return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+        "The bits within the literal at %s aren't a list of booleans - got %T. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        input.Data,
       ))
     }
 
+  case "INTEGER":
+    return nil, nil, nil, nil, NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+      "The integer %d at %s can only be used as an argument to a builtin like wave. Stop.",
+      input.Data.(*Integer).Value,
+      formatPosition(input.File, input.Line, input.Col),
+    ))
+
   default:
-    return nil, nil, nil, nil, errors.New(fmt.Sprintf(
-      "Unknown token at %d:%d - %s. Stop.\n",
-      input.Row,
-      input.Col,
+    return nil, nil, nil, nil, NewNodeError(INTERNAL_ERROR, input, fmt.Sprintf(
+      "Unknown token at %s - %s. Stop.\n",
+      formatPosition(input.File, input.Line, input.Col),
       input.Token,
     ))
   }
@@ -850,3 +1043,143 @@ func Parse(inputs *[]Node, stack []*StackFrame) ([]*Gate, []*Wire, []*CallingCon
   return gates, wires, contexts, outputs, nil
 }
 
+
+// Create a gate that represents voltage (for true) or ground (for false), and the wire attached to it.
+func (c *Compiler) constantGate(value bool, input Node, stack []*StackFrame) *Gate {
+  // Figure out the type of signal we have
+  var gateType GateType
+  if value {
+    gateType = SOURCE
+  } else {
+    gateType = GROUND
+  }
+
+  // Add a new wire connected to voltage or ground
+  c.wireId += 1
+  wire := &Wire{ Id: c.wireId }
+
+  c.gateId += 1
+  return &Gate{
+    Id: c.gateId,
+    Type: gateType,
+    Inputs: []*Wire{},
+    Outputs: []*Wire{wire},
+
+    // The stack frame that this gate is within
+    CallingContext: stack[len(stack)-1].Id,
+    Source: input.Span(),
+  }
+}
+
+// Find the wire that a variable refers to, looking through the stack from top to bottom. If the
+// variable can't be found, it's implicitly declared in the top stack frame with a new wire, which is
+// connected up if the variable is assigned later on.
+func (c *Compiler) lookupVariable(name string, input Node, stack []*StackFrame) *Wire {
+  for i := len(stack) - 1; i >= 0; i-- {
+    for _, variable := range stack[i].Variables {
+      if variable.Name == name {
+        return variable.Value
+      }
+    }
+  }
+
+  // Make a new wire
+  c.wireId += 1
+  wire := &Wire{
+    Id: c.wireId,
+    Desc: fmt.Sprintf("for implicitly declared variable %s", name),
+    Source: input.Span(),
+  }
+
+  // Implicity declare a variable linked to that wire
+  stack[len(stack) - 1].Variables = append(stack[len(stack) - 1].Variables, &Variable{
+    Name: name,
+    Value: wire,
+  })
+  return wire
+}
+
+// The default number of ticks in each period of a `wave`.
+const DEFAULT_WAVE_PERIOD = 2
+
+// A wave is invoked like `wave(enable period duty)`, where both `period` (the number of ticks that
+// it takes for the wave to repeat) and `duty` (the number of ticks in each period that the wave is
+// on for) are optional integers. Returns the children that are wire inputs to the wave, and the
+// initial state of the wave gate.
+func parseWaveArguments(input Node) ([]Node, string, error) {
+  children := *input.Children
+  if len(children) == 0 {
+    return children, "", nil
+  }
+
+  var integers []int
+  for _, child := range children[1:] {
+    switch data := child.Data.(type) {
+    case *Integer:
+      integers = append(integers, data.Value)
+    case *Bool:
+      // The integers 0 and 1 are tokenized as booleans.
+      if data.Value {
+        integers = append(integers, 1)
+      } else {
+        integers = append(integers, 0)
+      }
+    default:
+      return nil, "", NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+        "The wave at %s accepts only integers after its enable input, found %s at %s. Stop.",
+        formatPosition(input.File, input.Line, input.Col),
+        child.Token,
+        formatPosition(child.File, child.Line, child.Col),
+      ))
+    }
+  }
+
+  if len(integers) > 2 {
+    return nil, "", NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+      "The wave at %s accepts at most a period and a duty, but was passed %d integers. Stop.",
+      formatPosition(input.File, input.Line, input.Col),
+      len(integers),
+    ))
+  }
+
+  period := DEFAULT_WAVE_PERIOD
+  if len(integers) > 0 {
+    period = integers[0]
+  }
+  duty := period / 2
+  if len(integers) > 1 {
+    duty = integers[1]
+  }
+
+  if period < 2 {
+    return nil, "", NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+      "The wave at %s must have a period of at least 2 ticks, got %d. Stop.",
+      formatPosition(input.File, input.Line, input.Col),
+      period,
+    ))
+  }
+  if duty < 1 || duty >= period {
+    return nil, "", NewNodeError(INVALID_ARGUMENT, input, fmt.Sprintf(
+      "The wave at %s must be on for between 1 and %d ticks of its period, got %d. Stop.",
+      formatPosition(input.File, input.Line, input.Col),
+      period - 1,
+      duty,
+    ))
+  }
+
+  return children[:1], formatWaveState(0, period, duty), nil
+}
+
+// Format for the state of a wave gate: `phase,period,duty`, where phase is the number of ticks
+// that have elapsed in the current period.
+func formatWaveState(phase int, period int, duty int) string {
+  return fmt.Sprintf("%d,%d,%d", phase, period, duty)
+}
+
+func parseWaveState(state string) (int, int, int) {
+  var phase, period, duty int
+  if _, err := fmt.Sscanf(state, "%d,%d,%d", &phase, &period, &duty); err != nil || period < 1 {
+    return 0, DEFAULT_WAVE_PERIOD, DEFAULT_WAVE_PERIOD / 2
+  }
+  return phase, period, duty
+}
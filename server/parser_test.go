@@ -7,9 +7,9 @@ import (
 )
 
 func TestParsingAnd(t *testing.T) {
-  ast := Node{Token: "OP_AND", Row: 3, Col: 1, Data: map[string]interface{}{
-    "LeftHandSide": Node{Token: "BOOL", Row: 1, Col: 1, Data: map[string]interface{}{"Value": true}},
-    "RightHandSide": Node{Token: "BOOL", Row: 7, Col: 1, Data: map[string]interface{}{"Value": false}},
+  ast := Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+    LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 1, Data: &Bool{Value: true}},
+    RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 7, Data: &Bool{Value: false}},
   }}
 
   stack := []*StackFrame{
@@ -18,10 +18,7 @@ func TestParsingAnd(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&[]Node{ast}, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&[]Node{ast}, stack)
 
   // Verify error
   if err != nil {
@@ -37,6 +34,7 @@ func TestParsingAnd(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 1},
     },
     &Gate{
       Id: 2,
@@ -44,6 +42,7 @@ func TestParsingAnd(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 7},
     },
     &Gate{
       Id: 3,
@@ -51,6 +50,7 @@ func TestParsingAnd(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: 1}, &Wire{Id: 2} },
       Outputs: []*Wire{ &Wire{Id: 3} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
   }) {
     t.Error(fmt.Sprintf("Gates doesn't match! %+v", gates))
@@ -80,9 +80,9 @@ func TestParsingAnd(t *testing.T) {
 
 // a and false (where a is already on the stack)
 func TestParsingVariable(t *testing.T) {
-  ast := Node{Token: "OP_AND", Row: 3, Col: 1, Data: map[string]interface{}{
-    "LeftHandSide": Node{Token: "IDENTIFIER", Row: 1, Col: 1, Data: map[string]interface{}{"Value": "a"}},
-    "RightHandSide": Node{Token: "BOOL", Row: 7, Col: 1, Data: map[string]interface{}{"Value": false}},
+  ast := Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+    LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+    RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 7, Data: &Bool{Value: false}},
   }}
 
   stack := []*StackFrame{
@@ -93,10 +93,7 @@ func TestParsingVariable(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&[]Node{ast}, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&[]Node{ast}, stack)
 
   // Verify error
   if err != nil {
@@ -112,6 +109,7 @@ func TestParsingVariable(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 7},
     },
     &Gate{
       Id: 2,
@@ -119,6 +117,7 @@ func TestParsingVariable(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: -1}, &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
   }) {
     // Dereference so we can see the contents of the pointers
@@ -154,8 +153,8 @@ func TestParsingVariable(t *testing.T) {
 // let a = 1
 func TestAssigningVariable(t *testing.T) {
   ast := []Node{
-    Node{Token: "ASSIGNMENT", Row: 3, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-    Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 3, Data: &Assignment{Names: "a"}},
+    Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
   }
 
   stack := []*StackFrame{
@@ -166,10 +165,7 @@ func TestAssigningVariable(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -185,6 +181,7 @@ func TestAssigningVariable(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: -1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
   }) {
     // Dereference so we can see the contents of the pointers
@@ -217,14 +214,14 @@ func TestAssigningVariable(t *testing.T) {
 // let a = foo(1)
 func TestAssigningVariableToInvokedBlock(t *testing.T) {
   ast := []Node{
-    Node{Token: "ASSIGNMENT", Row: 3, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 3, Data: &Assignment{Names: "a"}},
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
   }
@@ -236,15 +233,15 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 1,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 1,
             },
             Children: &[]Node{
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
             },
           },
         },
@@ -252,10 +249,7 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -271,6 +265,7 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -279,6 +274,7 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -310,7 +306,7 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}},
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}},
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -340,14 +336,14 @@ func TestAssigningVariableToInvokedBlock(t *testing.T) {
 // let a b = foo(1)
 func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
   ast := []Node{
-    Node{Token: "ASSIGNMENT", Row: 3, Col: 1, Data: map[string]interface{}{"Names": "a b", "Values": []Node{}}},
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 3, Data: &Assignment{Names: "a b"}},
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
   }
@@ -359,16 +355,16 @@ func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 2,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 2,
             },
             Children: &[]Node{
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
             },
           },
         },
@@ -376,10 +372,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -395,6 +388,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -403,6 +397,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -445,7 +440,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValues(t *testing.T) {
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}},
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}},
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -483,23 +478,22 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
   ast := []Node{
     Node{
       Token: "ASSIGNMENT",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{
-        "Names": "a b c",
-        "Values": []Node{},
+      Line: 1,
+      Col: 3,
+      Data: &Assignment{
+        Names: "a b c",
       },
     },
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
-    Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+    Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
   }
 
   stack := []*StackFrame{
@@ -509,16 +503,16 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 2,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 2,
             },
             Children: &[]Node{
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
             },
           },
         },
@@ -526,10 +520,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -545,6 +536,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -553,6 +545,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -576,6 +569,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 5} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
   }) {
     // Dereference so we can see the contents of the pointers
@@ -628,7 +622,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleTokens(t
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}},
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}},
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -649,29 +643,28 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
   ast := []Node{
     Node{
       Token: "ASSIGNMENT",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{
-        "Names": "a b c d",
-        "Values": []Node{},
+      Line: 1,
+      Col: 3,
+      Data: &Assignment{
+        Names: "a b c d",
       },
     },
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": false}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: false}},
       },
     },
   }
@@ -683,16 +676,16 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 2,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 2,
             },
             Children: &[]Node{
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
             },
           },
         },
@@ -700,10 +693,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -719,6 +709,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -727,6 +718,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -750,6 +742,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 5} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 6,
@@ -758,6 +751,7 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
       Inputs: []*Wire{ &Wire{Id: 5} },
       Outputs: []*Wire{ &Wire{Id: 6} },
       CallingContext: 2,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 7,
@@ -838,8 +832,8 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}}, /* first foo invocation */
-    {Id: 2, Name: "foo", Depth: 1, Parent: 0, Children: []int{}}, /* second foo invocation */
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}}, /* first foo invocation */
+    {Id: 2, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}}, /* second foo invocation */
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -862,14 +856,14 @@ func TestAssigningVariableToInvokedBlockWithMultipleValuesAcrossMultipleInvocati
 // let a = foo(1)
 func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
   ast := []Node{
-    Node{Token: "ASSIGNMENT", Row: 3, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 3, Data: &Assignment{Names: "a"}},
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
   }
@@ -881,22 +875,22 @@ func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 1,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 1,
             },
             Children: &[]Node{
-              Node{Token: "ASSIGNMENT", Data: map[string]interface{}{"Names": "b", "Values": []Node{}}},
+              Node{Token: "ASSIGNMENT", Data: &Assignment{Names: "b"}},
               Node{Token: "GROUP", Children: &[]Node{
-                Node{Token: "OP_AND", Data: map[string]interface{}{
-                  "LeftHandSide": Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-                  "RightHandSide": Node{Token: "BOOL", Data: map[string]interface{}{"Value": false}},
+                Node{Token: "OP_AND", Data: &BinaryExpr{
+                  LeftHandSide: &Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+                  RightHandSide: &Node{Token: "BOOL", Data: &Bool{Value: false}},
                 }},
               }},
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "b"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "b"}},
             },
           },
         },
@@ -904,10 +898,7 @@ func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -923,6 +914,7 @@ func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -931,6 +923,7 @@ func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -980,7 +973,7 @@ func TestAssigningVariableToInvokedBlockWithComplicatedBlock(t *testing.T) {
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}},
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}},
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -1012,16 +1005,16 @@ func TestBlockDefinitionByItselfDoesntCreateGatesOrWires(t *testing.T) {
   ast := []Node{
     Node{
       Token: "BLOCK",
-      Data: map[string]interface{}{
-        "Name": "foo",
-        "Params": "a",
-        "InputQuantity": 1,
-        "OutputQuantity": 2,
+      Data: &BlockDecl{
+        Name: "foo",
+        Params: "a",
+        InputQuantity: 1,
+        OutputQuantity: 2,
       },
       Children: &[]Node{
         Node{Token: "BLOCK_RETURN"},
-        Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-        Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+        Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+        Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
       },
     },
   }
@@ -1030,10 +1023,7 @@ func TestBlockDefinitionByItselfDoesntCreateGatesOrWires(t *testing.T) {
     &StackFrame{},
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -1074,7 +1064,7 @@ func TestBlockDefinitionByItselfDoesntCreateGatesOrWires(t *testing.T) {
   // Ensure that the right variables are on the stack
   for _, block := range stack[0].Blocks {
     if block.Name == "foo" {
-      if block.Content.Data["Name"].(string) != "foo" {
+      if block.Declaration().Name != "foo" {
         t.Errorf("Block foo was not assigned")
       }
       continue
@@ -1086,14 +1076,14 @@ func TestBlockDefinitionByItselfDoesntCreateGatesOrWires(t *testing.T) {
 // let _ b = foo(1)
 func TestThrowawayVariable(t *testing.T) {
   ast := []Node{
-    Node{Token: "ASSIGNMENT", Row: 3, Col: 1, Data: map[string]interface{}{"Names": "_ b", "Values": []Node{}}},
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 3, Data: &Assignment{Names: "_ b"}},
     Node{
       Token: "INVOCATION",
-      Row: 3,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Line: 1,
+      Col: 3,
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 3, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "BOOL", Line: 1, Col: 3, Data: &Bool{Value: true}},
       },
     },
   }
@@ -1106,16 +1096,16 @@ func TestThrowawayVariable(t *testing.T) {
           Name: "foo",
           Content: &Node{
             Token: "BLOCK",
-            Data: map[string]interface{}{
-              "Name": "foo",
-              "Params": "a",
-              "InputQuantity": 1,
-              "OutputQuantity": 2,
+            Data: &BlockDecl{
+              Name: "foo",
+              Params: "a",
+              InputQuantity: 1,
+              OutputQuantity: 2,
             },
             Children: &[]Node{
               Node{Token: "BLOCK_RETURN"},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
-              Node{Token: "IDENTIFIER", Data: map[string]interface{}{"Value": "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
+              Node{Token: "IDENTIFIER", Data: &Identifier{Value: "a"}},
             },
           },
         },
@@ -1123,10 +1113,7 @@ func TestThrowawayVariable(t *testing.T) {
     },
   }
 
-  wireId = 0
-  gateId = 0
-  stackFrameId = 0
-  gates, wires, callingcontexts, outputs, err := Parse(&ast, stack)
+  gates, wires, callingcontexts, outputs, err := NewCompiler().Parse(&ast, stack)
 
   // Verify error
   if err != nil {
@@ -1142,6 +1129,7 @@ func TestThrowawayVariable(t *testing.T) {
       Inputs: []*Wire{},
       Outputs: []*Wire{ &Wire{Id: 1} },
       CallingContext: 0,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 2,
@@ -1150,6 +1138,7 @@ func TestThrowawayVariable(t *testing.T) {
       Inputs: []*Wire{ &Wire{Id: 1} },
       Outputs: []*Wire{ &Wire{Id: 2} },
       CallingContext: 1,
+      Source: SourceSpan{Line: 1, Col: 3},
     },
     &Gate{
       Id: 3,
@@ -1196,7 +1185,7 @@ func TestThrowawayVariable(t *testing.T) {
 
   // Verify calling contexts
   if !reflect.DeepEqual(callingcontexts, []*CallingContext{
-    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}},
+    {Id: 1, Name: "foo", Depth: 1, Parent: 0, Children: []int{}, Source: SourceSpan{Line: 1, Col: 3}},
   }) {
     // Dereference so we can see the contents of the pointers
     deref := []CallingContext{}
@@ -1228,3 +1217,42 @@ func TestThrowawayVariable(t *testing.T) {
     t.Errorf(fmt.Sprintf("Unknown variable %s!", variable.Name))
   }
 }
+
+func TestStatementsAfterBlockInvocation(t *testing.T) {
+  // Each statement after an invocation of a block should be parsed once, in order.
+  states := ledStates(t, "block show(a) {\n  led(a)\n}\nshow(1)\nled(0)\nshow(1)")
+  if !reflect.DeepEqual(states, []string{"on", "off", "on"}) {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestRightHandSideErrorNamesOperator(t *testing.T) {
+  _, err := RunString("led(toggle() nor led(toggle()))", false)
+  if err == nil {
+    t.Errorf("No error returned!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Right hand side of OP_NOR gate at 1:14 outputs zero values in a single value context. Stop.") {
+    t.Errorf("Error doesn't match! %s", err)
+  }
+}
+
+func TestParsingOperatorWithMissingOperand(t *testing.T) {
+  // The tokenizer rejects these, but the parser must never build a gate with a nil input.
+  for _, ast := range []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 1, Data: &Bool{Value: true}},
+    }},
+    Node{Token: "OP_NOT", Line: 1, Col: 1, Data: &UnaryExpr{}},
+  } {
+    stack := []*StackFrame{
+      &StackFrame{
+        Variables: []*Variable{},
+      },
+    }
+
+    if _, _, _, _, err := NewCompiler().Parse(&[]Node{ast}, stack); err == nil {
+      t.Errorf("No error returned for %s with a missing operand", ast.Token)
+    }
+  }
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+  "regexp"
+  "path/filepath"
+
+  // For reading imported files from disk
+  "io/ioutil"
+)
+
+// Standard library collections are imported by name (ie, `import adder`), everything else is a path
+// to a local file (ie, `import "./alu.bit"`).
+var MATCH_STANDARD_LIBRARY_IMPORT *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z_]+$`)
+
+// Matches an import that puts its blocks within a namespace, ie `import adder as arith`.
+var MATCH_NAMESPACED_IMPORT *regexp.Regexp = regexp.MustCompile(`^(.+?)\s+as\s+([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+
+// A ModuleResolver finds the source for each import in a program. It keeps track of every file
+// that has been included so that a file imported twice is only included once, and of the chain of
+// files currently being tokenized so that import cycles can be detected.
+type ModuleResolver struct {
+  // Every file or standard library collection that has already been included.
+  included map[string]bool
+
+  // The files that are currently being tokenized, from the root file to the most deeply imported.
+  stack []string
+
+  // The source of everything that has been tokenized, by the file that its nodes refer to.
+  sources map[string]string
+}
+
+func NewModuleResolver() *ModuleResolver {
+  return &ModuleResolver{
+    included: map[string]bool{},
+    sources: map[string]string{},
+  }
+}
+
+// The source that nodes with a `File` of `file` were tokenized from.
+func (r *ModuleResolver) Source(file string) (string, bool) {
+  source, ok := r.sources[file]
+  return source, ok
+}
+
+// Every local file that has been tokenized, which includes the root file (if the source came from a
+// file) and each file that it imports, but not the standard library.
+func (r *ModuleResolver) Files() []string {
+  files := []string{}
+  for file := range r.sources {
+    if len(file) > 0 && !strings.HasPrefix(file, "stdlib:") {
+      files = append(files, file)
+    }
+  }
+  sort.Strings(files)
+  return files
+}
+
+// The file that is currently being tokenized, or an empty string if the source didn't come from a
+// file.
+func (r *ModuleResolver) CurrentFile() string {
+  if len(r.stack) == 0 {
+    return ""
+  }
+  return r.stack[len(r.stack) - 1]
+}
+
+// Tokenize source that was read from `path`. Any local imports within the source are resolved
+// relative to `path`. If the source didn't come from a file, `path` should be an empty string.
+func (r *ModuleResolver) Tokenize(input string, path string) (*[]Node, error) {
+  if len(path) > 0 {
+    r.included[importKey(path)] = true
+  }
+  return r.tokenizeFile(input, path)
+}
+
+// Tokenize source that was read from `path`, without marking it as included.
+func (r *ModuleResolver) tokenizeFile(input string, path string) (*[]Node, error) {
+  if len(path) > 0 {
+    r.stack = append(r.stack, path)
+    defer func() { r.stack = r.stack[:len(r.stack) - 1] }()
+  }
+
+  r.sources[path] = input
+  return tokenize(input, path, r)
+}
+
+// Resolve the path within an import token to a list of nodes that should replace the import. If the
+// import has already been included, no nodes are returned. A namespaced import always returns its
+// nodes, since its blocks have different names than the blocks from any other import.
+func (r *ModuleResolver) Resolve(importPath string, namespaced bool) ([]Node, error) {
+  importPath = strings.TrimSpace(importPath)
+  isStdLib := MATCH_STANDARD_LIBRARY_IMPORT.MatchString(importPath)
+
+  // Local paths can optionally be wrapped in quotes.
+  if len(importPath) >= 2 && importPath[0] == '"' && importPath[len(importPath) - 1] == '"' {
+    importPath = importPath[1:len(importPath) - 1]
+    isStdLib = false
+  }
+
+  if isRunningInServer && !isStdLib {
+    return nil, NewCompileError(IMPORT_ERROR, fmt.Sprintf("Server cannot import local path '%s'", importPath))
+  }
+
+  if isStdLib {
+    // Look up the standard lib function
+    input, ok := STANDARD_LIBRARY[importPath]
+    if !ok {
+      return nil, NewCompileError(IMPORT_ERROR, fmt.Sprintf("No such standard lib collection found: %s", importPath))
+    }
+
+    // Only include each collection once.
+    key := "stdlib:" + importPath
+    if r.included[key] && !namespaced {
+      return []Node{}, nil
+    }
+    if !namespaced {
+      r.included[key] = true
+    }
+
+    // Tokenize the contents of the standard library. Nodes from the standard library refer to the
+    // collection as their file, so that they aren't mistaken for nodes from the main program.
+    // TODO: Ideally, this would be a step that happens when the compiler starts and not on
+    // every `import`.
+    r.sources[key] = input
+    stdLibNodes, err := tokenize(input, key, r)
+    if err != nil {
+      return nil, WrapCompileError(err, IMPORT_ERROR, fmt.Sprintf("Error in tokenizing import '%s': %s", importPath, err))
+    }
+    return *stdLibNodes, nil
+  }
+
+  // Local imports are relative to the file that contains the import. If the source didn't come
+  // from a file, then they are relative to the working directory.
+  resolvedPath := importPath
+  if !filepath.IsAbs(resolvedPath) && len(r.CurrentFile()) > 0 {
+    resolvedPath = filepath.Join(filepath.Dir(r.CurrentFile()), importPath)
+  }
+  resolvedPath = filepath.Clean(resolvedPath)
+  key := importKey(resolvedPath)
+
+  // Ensure that the file isn't already being tokenized further up the chain of imports.
+  for index, file := range r.stack {
+    if importKey(file) == key {
+      chain := append(append([]string{}, r.stack[index:]...), resolvedPath)
+      return nil, NewCompileError(IMPORT_ERROR, fmt.Sprintf("Import cycle detected: %s", strings.Join(chain, " -> ")))
+    }
+  }
+
+  // A file that has already been included elsewhere doesn't need to be included again.
+  if r.included[key] && !namespaced {
+    return []Node{}, nil
+  }
+
+  source, err := ioutil.ReadFile(resolvedPath)
+  if err != nil {
+    return nil, NewCompileError(IMPORT_ERROR, fmt.Sprintf(
+      "Error reading import '%s' in %s: %s",
+      importPath,
+      describeFile(r.CurrentFile()),
+      err,
+    ))
+  }
+
+  tokenizeFile := r.Tokenize
+  if namespaced {
+    tokenizeFile = r.tokenizeFile
+  }
+  nodes, err := tokenizeFile(string(source), resolvedPath)
+  if err != nil {
+    return nil, WrapCompileError(err, IMPORT_ERROR, fmt.Sprintf("Error in tokenizing import '%s': %s", importPath, err))
+  }
+  return *nodes, nil
+}
+
+// Two paths that refer to the same file should be treated as the same import.
+func importKey(path string) string {
+  if absolute, err := filepath.Abs(path); err == nil {
+    return absolute
+  }
+  return filepath.Clean(path)
+}
+
+func describeFile(path string) string {
+  if len(path) == 0 {
+    return "<input>"
+  }
+  return path
+}
+
+// Format a location in source code for use in an error message, ie `alu.bit:3:1`. If the source
+// didn't come from a file, the file is left out.
+func formatPosition(file string, row int, col int) string {
+  if len(file) == 0 {
+    return fmt.Sprintf("%d:%d", row, col)
+  }
+  return fmt.Sprintf("%s:%d:%d", file, row, col)
+}
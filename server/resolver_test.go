@@ -0,0 +1,164 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "strings"
+  "os"
+  "path/filepath"
+  "io/ioutil"
+  "reflect"
+)
+
+// Write each file into a new temporary directory, returning the directory.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+  dir, err := ioutil.TempDir("", "lovelace")
+  if err != nil {
+    t.Fatalf("Error creating temporary directory: %s", err)
+  }
+
+  for name, contents := range files {
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+      t.Fatalf("Error creating directory for %s: %s", name, err)
+    }
+    if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+      t.Fatalf("Error writing %s: %s", name, err)
+    }
+  }
+
+  return dir
+}
+
+func TestImportLocalFile(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": `
+      import "./lib/alu.bit"
+      led(invert(toggle()))
+    `,
+    "lib/alu.bit": `
+      import "./gates.bit"
+      block invert(a) {
+        return nand2(a a)
+      }
+    `,
+    "lib/gates.bit": `
+      block nand2(a b) {
+        return (not (a and b))
+      }
+    `,
+  })
+  defer os.RemoveAll(dir)
+
+  summary, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if len(summary.Contexts) != 2 {
+    t.Errorf("Expected two calling contexts (invert and nand2), found %d", len(summary.Contexts))
+  }
+}
+
+func TestImportSameFileTwiceOnlyIncludesItOnce(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": `
+      import "./a.bit"
+      import "./b.bit"
+      import counter
+      import counter
+    `,
+    "a.bit": `import "./common.bit"`,
+    "b.bit": `import "common.bit"`,
+    "common.bit": `block foo(a) { return a }`,
+  })
+  defer os.RemoveAll(dir)
+
+  source, _ := ioutil.ReadFile(filepath.Join(dir, "main.bit"))
+  nodes, err := NewModuleResolver().Tokenize(string(source), filepath.Join(dir, "main.bit"))
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  if len(*nodes) != 2 {
+    t.Errorf("Expected two blocks (foo and counter8), found %d nodes", len(*nodes))
+  }
+}
+
+func TestResolverFilesIncludesImports(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": `
+      import "./a.bit"
+      import counter
+    `,
+    "a.bit": `import "./common.bit"`,
+    "common.bit": `block foo(a) { return a }`,
+  })
+  defer os.RemoveAll(dir)
+
+  resolver := NewModuleResolver()
+  source, _ := ioutil.ReadFile(filepath.Join(dir, "main.bit"))
+  if _, err := resolver.Tokenize(string(source), filepath.Join(dir, "main.bit")); err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  expected := []string{
+    filepath.Join(dir, "a.bit"),
+    filepath.Join(dir, "common.bit"),
+    filepath.Join(dir, "main.bit"),
+  }
+  if files := resolver.Files(); !reflect.DeepEqual(files, expected) {
+    t.Errorf("Wrong files returned: %v", files)
+  }
+}
+
+func TestImportCycle(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "a.bit": `import "./b.bit"`,
+    "b.bit": `import "./a.bit"`,
+  })
+  defer os.RemoveAll(dir)
+
+  _, err := RunFile(filepath.Join(dir, "a.bit"), false)
+  if err == nil {
+    t.Errorf("No Error returned!")
+    return
+  }
+  if !strings.Contains(err.Error(), "Import cycle detected") {
+    t.Errorf("Wrong error returned: %s", err)
+  }
+}
+
+func TestImportErrorNamesFile(t *testing.T) {
+  dir := writeTestFiles(t, map[string]string{
+    "main.bit": `import "./broken.bit"`,
+    "broken.bit": `1 and and`,
+  })
+  defer os.RemoveAll(dir)
+
+  _, err := RunFile(filepath.Join(dir, "main.bit"), false)
+  if err == nil {
+    t.Errorf("No Error returned!")
+    return
+  }
+  if !strings.Contains(err.Error(), filepath.Join(dir, "broken.bit")) {
+    t.Errorf("Error doesn't name the file that the error is in: %s", err)
+  }
+}
+
+func TestServerCannotImportLocalFiles(t *testing.T) {
+  isRunningInServer = true
+  defer func() { isRunningInServer = false }()
+
+  _, err := RunString(`import "./alu.bit"`, false)
+  if err == nil {
+    t.Errorf("No Error returned!")
+    return
+  }
+  if err.Error() != "Server cannot import local path './alu.bit'" {
+    t.Errorf("Wrong error returned: %s", err)
+  }
+}
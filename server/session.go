@@ -0,0 +1,174 @@
+package main
+
+import (
+  "fmt"
+  "errors"
+  "sort"
+)
+
+// The most ticks that a single tick event can advance a session by.
+const MAX_SESSION_TICKS = 10000
+
+// A Session is a simulation of a compiled program that lives on the server, so that clients only
+// have to send input events (like pressing a switch) instead of the whole program each time
+// something changes. A session outlives a single compile of the program: when the program is
+// recompiled, the state of each switch is carried over into the new program.
+type Session struct {
+  Summary *Summary
+
+  simulation *Simulation
+
+  // The index of each gate in `Summary.Gates`, by id.
+  gateIndexes map[int]int
+}
+
+// An input event sent by a client.
+type SessionEvent struct {
+  // Either "set", to change the state of a switch, or "tick", to advance clock sources.
+  Type string
+
+  // For "set" events, the id of the switch to change and the state to change it to ("on" or "off")
+  Gate int
+  State string
+
+  // For "tick" events, the number of ticks to advance by. Defaults to one.
+  Ticks int
+}
+
+type GateState struct {
+  Id int
+  State string
+}
+
+type WireState struct {
+  Id int
+  Powered bool
+}
+
+// Every gate and wire that changed state as the result of an event.
+type SessionDiff struct {
+  Gates []GateState
+  Wires []WireState
+}
+
+func NewSession() *Session {
+  return &Session{}
+}
+
+// Start simulating a newly compiled program, carrying over the state of every switch from the
+// previous program. Switches are matched up by their order within the program, so the third toggle
+// in the old program has the same state as the third toggle in the new program.
+func (s *Session) Load(summary *Summary) {
+  switchStates := map[string][]string{}
+  if s.Summary != nil {
+    for _, gate := range s.Summary.Gates {
+      if isSwitch(gate) {
+        switchStates[gate.Label] = append(switchStates[gate.Label], gate.State)
+      }
+    }
+  }
+
+  switchCounts := map[string]int{}
+  for _, gate := range summary.Gates {
+    if isSwitch(gate) {
+      if index := switchCounts[gate.Label]; index < len(switchStates[gate.Label]) {
+        gate.State = switchStates[gate.Label][index]
+      }
+      switchCounts[gate.Label] += 1
+    }
+  }
+
+  s.Summary = summary
+  s.gateIndexes = map[int]int{}
+  for index, gate := range summary.Gates {
+    s.gateIndexes[gate.Id] = index
+  }
+
+  s.simulation = NewSimulation(summary.Gates, summary.Wires)
+  s.simulation.Settle()
+}
+
+// Apply an input event to the simulation, returning every gate and wire that changed as a result.
+// If the circuit doesn't stabilize, whatever changed is returned along with the error, so that
+// clients don't fall out of sync with the session.
+func (s *Session) Apply(event SessionEvent) (*SessionDiff, error) {
+  if s.simulation == nil {
+    return nil, errors.New("No program has been compiled successfully yet")
+  }
+
+  var settled bool
+  switch event.Type {
+  case "set":
+    index, ok := s.gateIndexes[event.Gate]
+    if !ok {
+      return nil, errors.New(fmt.Sprintf("No gate with id %d exists", event.Gate))
+    }
+    gate := s.Summary.Gates[index]
+    if !isSwitch(gate) {
+      return nil, errors.New(fmt.Sprintf("Gate %d is not a toggle or momentary switch", event.Gate))
+    }
+    if event.State != "on" && event.State != "off" {
+      return nil, errors.New(fmt.Sprintf("A switch can only be set to on or off, not '%s'", event.State))
+    }
+
+    s.simulation.TrackChanges()
+    s.simulation.setState(index, event.State)
+    s.simulation.MarkDirty(index)
+    settled = s.simulation.Settle()
+
+  case "tick":
+    ticks := event.Ticks
+    if ticks == 0 {
+      ticks = 1
+    }
+    // The session is locked while ticking, so a single event can't tick forever.
+    if ticks < 0 || ticks > MAX_SESSION_TICKS {
+      return nil, errors.New(fmt.Sprintf("A tick event can advance by 1 to %d ticks, not %d", MAX_SESSION_TICKS, ticks))
+    }
+
+    s.simulation.TrackChanges()
+    settled = true
+    for i := 0; i < ticks && settled; i++ {
+      settled = s.simulation.Tick()
+    }
+
+  default:
+    return nil, errors.New(fmt.Sprintf("Unknown event type '%s'", event.Type))
+  }
+
+  // Only the gates and wires that the simulation saw change are compared to their state before the
+  // event, since a gate can change and then change back.
+  diff := &SessionDiff{Gates: []GateState{}, Wires: []WireState{}}
+  indexes := []int{}
+  for index, before := range s.simulation.gatesBefore {
+    if s.Summary.Gates[index].State != before {
+      indexes = append(indexes, index)
+    }
+  }
+  sort.Ints(indexes)
+  for _, index := range indexes {
+    gate := s.Summary.Gates[index]
+    diff.Gates = append(diff.Gates, GateState{Id: gate.Id, State: gate.State})
+  }
+
+  ids := []int{}
+  for id, before := range s.simulation.wiresBefore {
+    if s.simulation.wiresById[id].Powered != before {
+      ids = append(ids, id)
+    }
+  }
+  sort.Ints(ids)
+  for _, id := range ids {
+    diff.Wires = append(diff.Wires, WireState{Id: id, Powered: s.simulation.wiresById[id].Powered})
+  }
+
+  if !settled {
+    return diff, errors.New("The circuit didn't stabilize, it probably oscillates")
+  }
+  return diff, nil
+}
+
+// Is the gate a switch that a user can change the state of?
+func isSwitch(gate *Gate) bool {
+  return gate.Type == BUILTIN_FUNCTION && (gate.Label == "toggle" || gate.Label == "momentary")
+}
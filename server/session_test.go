@@ -0,0 +1,152 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "reflect"
+)
+
+func TestSessionSetSwitch(t *testing.T) {
+  summary, err := RunString("led(not toggle())", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+
+  diff, err := session.Apply(SessionEvent{Type: "set", Gate: 1, State: "on"})
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // The toggle turned on, which turned off the output of the not gate and the led.
+  if !reflect.DeepEqual(diff, &SessionDiff{
+    Gates: []GateState{
+      GateState{Id: 1, State: "on"},
+      GateState{Id: 3, State: "off"},
+    },
+    Wires: []WireState{
+      WireState{Id: 1, Powered: true},
+      WireState{Id: 2, Powered: false},
+    },
+  }) {
+    t.Errorf("Diff doesn't match! %+v", diff)
+  }
+
+  // Setting the switch to the state it's already in shouldn't change anything.
+  diff, _ = session.Apply(SessionEvent{Type: "set", Gate: 1, State: "on"})
+  if len(diff.Gates) != 0 || len(diff.Wires) != 0 {
+    t.Errorf("Diff should be empty! %+v", diff)
+  }
+}
+
+func TestSessionRejectsInvalidEvents(t *testing.T) {
+  summary, err := RunString("led(toggle())", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+
+  for _, event := range []SessionEvent{
+    SessionEvent{Type: "set", Gate: 2, State: "on"},
+    SessionEvent{Type: "set", Gate: 5, State: "on"},
+    SessionEvent{Type: "set", Gate: 1, State: "sideways"},
+    SessionEvent{Type: "explode"},
+  } {
+    if _, err := session.Apply(event); err == nil {
+      t.Errorf("No error returned for event %+v", event)
+    }
+  }
+}
+
+func TestSessionKeepsSwitchStatesAcrossRecompiles(t *testing.T) {
+  summary, err := RunString("led(toggle())", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+  session.Apply(SessionEvent{Type: "set", Gate: 1, State: "on"})
+
+  // Recompile a new version of the program, where the toggle has a different id.
+  summary, err = RunString("led(0)\nled(not toggle())", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+  session.Load(summary)
+
+  toggle := findGateByLabel(summary.Gates, "toggle")
+  if toggle.State != "on" {
+    t.Errorf("Toggle state wasn't carried over into the new program, state is '%s'", toggle.State)
+  }
+  if led := summary.Gates[len(summary.Gates) - 1]; led.State != "off" {
+    t.Errorf("Second led should be off, is '%s'", led.State)
+  }
+}
+
+func TestSessionTick(t *testing.T) {
+  summary, err := RunString("led(wave(1))", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+
+  diff, err := session.Apply(SessionEvent{Type: "tick"})
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // The wave should have turned off after one tick, turning off the led.
+  if led := findGateByLabel(summary.Gates, "led"); led.State != "off" {
+    t.Errorf("Led should be off after a tick, is '%s'", led.State)
+  }
+  if len(diff.Wires) != 1 || diff.Wires[0].Powered {
+    t.Errorf("Diff doesn't match! %+v", diff)
+  }
+}
+
+func TestSessionRejectsTooManyTicks(t *testing.T) {
+  summary, err := RunString("led(wave(1))", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+
+  for _, ticks := range []int{-1, MAX_SESSION_TICKS + 1} {
+    if _, err := session.Apply(SessionEvent{Type: "tick", Ticks: ticks}); err == nil {
+      t.Errorf("No error returned for %d ticks", ticks)
+    }
+  }
+}
+
+func TestSessionReportsOscillation(t *testing.T) {
+  summary, err := RunString("let a = toggle()\nlet x = not (x and a)\nled(x)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  session := NewSession()
+  session.Load(summary)
+
+  toggle := findGateByLabel(summary.Gates, "toggle")
+  if _, err := session.Apply(SessionEvent{Type: "set", Gate: toggle.Id, State: "on"}); err == nil {
+    t.Errorf("No error returned for a circuit that oscillates")
+  }
+}
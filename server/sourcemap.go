@@ -0,0 +1,112 @@
+package main
+
+import (
+  "strings"
+)
+
+// A block invocation that a gate or wire is within.
+type InvocationSite struct {
+  // The id of the calling context that the invocation created.
+  Context int
+  Block string
+  Source SourceSpan
+}
+
+// Fill in where every gate and wire came from, so that a gate or wire can be traced back to the
+// source that created it:
+// - `Expression` is the text of the source, with whitespace collapsed onto a single line.
+// - `Invocations` is the chain of block invocations that led to the gate or wire, outermost first.
+// Wires are traced to the gate that drives them. Wires that aren't driven by any gate (ie, an
+// implicitly declared variable that was never assigned) are traced to where they were declared.
+func attachSourceMap(summary *Summary, resolver *ModuleResolver) {
+  contextsById := map[int]*CallingContext{}
+  for _, context := range summary.Contexts {
+    contextsById[context.Id] = context
+  }
+
+  drivers := map[int]*Gate{}
+  for _, gate := range summary.Gates {
+    gate.Expression = sourceExpression(gate.Source, resolver)
+    gate.Invocations = invocationChain(gate.CallingContext, contextsById)
+
+    for _, wire := range gate.Outputs {
+      if wire == nil {
+        continue
+      }
+      if _, ok := drivers[wire.Id]; !ok {
+        drivers[wire.Id] = gate
+      }
+    }
+  }
+
+  // The same wire can be referred to by more than one pointer, so update every one of them.
+  wires := append([]*Wire{}, summary.Wires...)
+  for _, gate := range summary.Gates {
+    wires = append(wires, gate.Inputs...)
+    wires = append(wires, gate.Outputs...)
+  }
+  for _, wire := range wires {
+    if wire == nil {
+      continue
+    }
+    if driver, ok := drivers[wire.Id]; ok {
+      wire.Source = driver.Source
+      wire.Expression = driver.Expression
+      wire.Invocations = driver.Invocations
+    } else {
+      wire.Expression = sourceExpression(wire.Source, resolver)
+    }
+  }
+}
+
+// Find every wire that is read by a gate but isn't driven by any gate. These wires are stuck off,
+// which is usually a mistake (ie, a misspelled variable name).
+func UndrivenWires(summary *Summary) []*Wire {
+  driven := map[int]bool{}
+  for _, gate := range summary.Gates {
+    for _, wire := range gate.Outputs {
+      if wire != nil {
+        driven[wire.Id] = true
+      }
+    }
+  }
+
+  var undriven []*Wire
+  reported := map[int]bool{}
+  for _, gate := range summary.Gates {
+    for _, wire := range gate.Inputs {
+      if wire != nil && !driven[wire.Id] && !reported[wire.Id] {
+        reported[wire.Id] = true
+        undriven = append(undriven, wire)
+      }
+    }
+  }
+  return undriven
+}
+
+// The text of the source within a span, on a single line.
+func sourceExpression(span SourceSpan, resolver *ModuleResolver) string {
+  source, ok := resolver.Source(span.File)
+  if !ok || span.EndOffset <= span.Offset || span.EndOffset > len(source) {
+    return ""
+  }
+  return strings.Join(strings.Fields(source[span.Offset:span.EndOffset]), " ")
+}
+
+func invocationChain(contextId int, contextsById map[int]*CallingContext) []InvocationSite {
+  var chain []InvocationSite
+  for context, ok := contextsById[contextId]; ok; context, ok = contextsById[context.Parent] {
+    chain = append([]InvocationSite{
+      InvocationSite{Context: context.Id, Block: context.Name, Source: context.Source},
+    }, chain...)
+  }
+  return chain
+}
+
+// Format where a span starts for a message, ie `alu.bit:3:1`.
+func formatSpan(span SourceSpan) string {
+  if span.Line == 0 {
+    return "an unknown location"
+  }
+  return formatPosition(span.File, span.Line, span.Col)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "reflect"
+  "strings"
+)
+
+const SOURCE_MAP_TEST_SOURCE = `block inv(a) {
+  return not a
+}
+led(inv(toggle()))
+led(x)`
+
+func TestSourceMapOfGatesAndWires(t *testing.T) {
+  summary, err := RunString(SOURCE_MAP_TEST_SOURCE, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  invocations := []InvocationSite{
+    InvocationSite{
+      Context: 1,
+      Block: "inv",
+      Source: SourceSpan{Line: 4, Col: 5, Offset: 36, EndLine: 4, EndCol: 18, EndOffset: 49},
+    },
+  }
+
+  // The not gate is within the invocation of `inv`.
+  var not *Gate
+  for _, gate := range summary.Gates {
+    if gate.Type == NOT {
+      not = gate
+    }
+  }
+  if not.Expression != "not a" || not.Source.Line != 2 || not.Source.Col != 10 {
+    t.Errorf("Not gate has the wrong source: %s at %+v", not.Expression, not.Source)
+  }
+  if !reflect.DeepEqual(not.Invocations, invocations) {
+    t.Errorf("Not gate has the wrong invocations: %+v", not.Invocations)
+  }
+
+  // The wire that the not gate drives is traced back to the not gate.
+  if wire := not.Outputs[0]; wire.Expression != "not a" || !reflect.DeepEqual(wire.Invocations, invocations) {
+    t.Errorf("Wire has the wrong source: %s %+v", wire.Expression, wire.Invocations)
+  }
+
+  // Gates that aren't in a block aren't within any invocations.
+  if toggle := findGateByLabel(summary.Gates, "toggle"); toggle.Expression != "toggle()" || toggle.Invocations != nil {
+    t.Errorf("Toggle has the wrong source: %s %+v", toggle.Expression, toggle.Invocations)
+  }
+}
+
+func TestUndrivenWires(t *testing.T) {
+  summary, err := RunString(SOURCE_MAP_TEST_SOURCE, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // `x` is never assigned, so it's traced back to where it was used.
+  undriven := UndrivenWires(summary)
+  if len(undriven) != 1 {
+    t.Errorf("Expected one undriven wire, found %d", len(undriven))
+    return
+  }
+  if undriven[0].Expression != "x" || formatSpan(undriven[0].Source) != "5:5" {
+    t.Errorf("Undriven wire has the wrong source: %s at %s", undriven[0].Expression, formatSpan(undriven[0].Source))
+  }
+}
+
+func TestSourceMapOfStandardLibrary(t *testing.T) {
+  summary, err := RunString("import adder\nlet s c = halfadder(1 0)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // Gates from the standard library refer to the collection that they are in, and not the program.
+  for _, gate := range summary.Gates {
+    if gate.Type == AND && (gate.Source.File != "stdlib:adder" || !strings.Contains(gate.Expression, "and")) {
+      t.Errorf("And gate has the wrong source: %s at %+v", gate.Expression, gate.Source)
+    }
+  }
+}
+
+func TestSourceMapSkipsMissingWires(t *testing.T) {
+  // A malformed summary shouldn't crash the compiler.
+  summary := &Summary{
+    Gates: []*Gate{&Gate{Id: 1, Type: AND, Inputs: []*Wire{nil, &Wire{Id: 1}}, Outputs: []*Wire{&Wire{Id: 2}}}},
+  }
+  attachSourceMap(summary, NewModuleResolver())
+  if undriven := UndrivenWires(summary); len(undriven) != 1 {
+    t.Errorf("Expected one undriven wire, found %d", len(undriven))
+  }
+}
@@ -2,17 +2,17 @@ package main
 
 var STANDARD_LIBRARY map[string]string = map[string]string {
   "counter": `
-		block counter8(clock reset) {
-			let c1 = tflipflop(clock 1 0 reset)
+		block counter8(clock reset = 0) {
+			let c1 = tflipflop(clock: clock, toggle: 1, reset: reset)
 
 			let toggle_c2 = c1
-			let c2 = tflipflop(clock toggle_c2 0 reset)
+			let c2 = tflipflop(clock: clock, toggle: toggle_c2, reset: reset)
 			
 			let toggle_c4 = (c1 and c2)
-			let c4 = tflipflop(clock toggle_c4 0 reset)
+			let c4 = tflipflop(clock: clock, toggle: toggle_c4, reset: reset)
 
 			let toggle_c8 = ((c1 and c2) and c4)
-			let c8 = tflipflop(clock toggle_c8 0 reset)
+			let c8 = tflipflop(clock: clock, toggle: toggle_c8, reset: reset)
 
 			return c1 c2 c4 c8
 		}
@@ -0,0 +1,313 @@
+package main
+
+import (
+  "encoding/csv"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// Tables define a block by listing its outputs for each combination of its inputs:
+//
+//   table majority(a b c) -> (out) {
+//     011 -> 1
+//     101 -> 1
+//     110 -> 1
+//     111 -> 1
+//   }
+//
+// Rows are written like the rows of a test (see `vectors.go`), except that an input can be `x` to
+// stand for both of its states. An output that is `x` doesn't matter, and every output of a
+// combination that isn't listed is off. The rows can also be read from a csv file with a column for
+// each input and output, like the csv that `lovel truthtable` prints:
+//
+//   table majority(a b c) -> (out) from "majority.csv"
+//
+// When a table is tokenized, each output is minimized into a sum of products, and the table is
+// replaced with a block made of `and`, `or`, and `not` gates that computes it.
+
+// The most inputs that a table can have. Finding every prime implicant of a table takes time that
+// grows exponentially with its inputs, and tables can be compiled by anyone through `lovel serve`,
+// so this is much lower than `MAX_TRUTH_TABLE_INPUTS`.
+const MAX_TABLE_INPUTS = 10
+
+// Matches a parameter or output of a table, which is either a wire or a bus with a fixed width.
+var MATCH_TABLE_WIRE *regexp.Regexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(?:\[([0-9]+)\])?$`)
+
+// A row of a table, and where it's from.
+type tableRow struct {
+  Inputs string
+  Outputs string
+  At string
+}
+
+// Parse the parameters or outputs of a table, like `a b[2]`.
+func parseTableWires(list string) ([]string, error) {
+  names := strings.Fields(list)
+  for _, name := range names {
+    if !MATCH_TABLE_WIRE.MatchString(name) {
+      return nil, errors.New(fmt.Sprintf("%s isn't a wire like `a`, or a bus like `a[4]`", name))
+    }
+  }
+  return names, nil
+}
+
+// The name of each wire within a list of parameters or outputs. A wire within a bus is named after
+// its index, like `a[2]`.
+func tableWireNames(list []string) []string {
+  names := []string{}
+  for _, name := range list {
+    match := MATCH_TABLE_WIRE.FindStringSubmatch(name)
+    if len(match[2]) == 0 {
+      names = append(names, name)
+      continue
+    }
+    width, _ := strconv.Atoi(match[2])
+    for index := 0; index < width; index++ {
+      names = append(names, fmt.Sprintf("%s[%d]", match[1], index))
+    }
+  }
+  return names
+}
+
+// Replace the table at the end of `nodes` with the block that it defines.
+func expandTable(nodes *[]Node) error {
+  if len(*nodes) == 0 {
+    return nil
+  }
+  node := (*nodes)[len(*nodes) - 1]
+  table, ok := node.Data.(*TableDecl)
+  if !ok {
+    // A table within another wrapper isn't at the end of the nodes of its stack frame.
+    return NewCompileError(SYNTAX_ERROR, "Tables can only be defined at the top level of a file. Stop.")
+  }
+
+  inputs, outputs := tableWireNames(table.Inputs), tableWireNames(table.Outputs)
+  if len(inputs) > MAX_TABLE_INPUTS {
+    return NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf(
+      "Table %s has %d inputs, but tables can only have up to %d inputs. Stop.",
+      table.Name,
+      len(inputs),
+      MAX_TABLE_INPUTS,
+    ))
+  }
+  seen := map[string]bool{}
+  for _, name := range append(append([]string{}, inputs...), outputs...) {
+    if seen[name] {
+      return NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf("Table %s uses %s more than once. Stop.", table.Name, name))
+    }
+    seen[name] = true
+  }
+
+  var rows []tableRow
+  if len(table.Path) > 0 {
+    var err error
+    rows, err = readTableCsv(table.Path, node, append(append([]string{}, inputs...), outputs...), len(inputs))
+    if err != nil {
+      return err
+    }
+  } else {
+    for _, vector := range table.Vectors {
+      line, col := vector.Position(node)
+      rows = append(rows, tableRow{Inputs: vector.Inputs, Outputs: vector.Outputs, At: formatPosition(node.File, line, col)})
+    }
+  }
+
+  // The state of each output for each combination of the inputs, which is `0` unless a row says
+  // otherwise. A row can't contradict an earlier row.
+  states := make([][]byte, len(outputs))
+  definedAt := make([][]string, len(outputs))
+  for output := range outputs {
+    states[output] = []byte(strings.Repeat("0", 1 << uint(len(inputs))))
+    definedAt[output] = make([]string, 1 << uint(len(inputs)))
+  }
+  for _, row := range rows {
+    if len(row.Inputs) != len(inputs) || len(row.Outputs) != len(outputs) {
+      return NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf(
+        "The row at %s has %d inputs and %d outputs, but table %s has %d inputs and %d outputs. Stop.",
+        row.At,
+        len(row.Inputs),
+        len(row.Outputs),
+        table.Name,
+        len(inputs),
+        len(outputs),
+      ))
+    }
+
+    for _, combination := range tableRowCombinations(row.Inputs) {
+      for output := range outputs {
+        state := row.Outputs[output]
+        if state == 'x' && len(definedAt[output][combination]) > 0 {
+          continue
+        }
+        if state != 'x' && len(definedAt[output][combination]) > 0 && states[output][combination] != state {
+          return NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf(
+            "The rows at %s and %s give %s different states when the inputs are %s. Stop.",
+            definedAt[output][combination],
+            row.At,
+            outputs[output],
+            fmt.Sprintf("%0*b", len(inputs), combination),
+          ))
+        }
+        states[output][combination] = state
+        if state != 'x' {
+          definedAt[output][combination] = row.At
+        }
+      }
+    }
+  }
+
+  // Write the block, and tokenize it in place of the table.
+  source := fmt.Sprintf("block %s(%s) {\n", table.Name, strings.Join(table.Inputs, " "))
+  for _, output := range table.Outputs {
+    match := MATCH_TABLE_WIRE.FindStringSubmatch(output)
+    expressions := []string{}
+    for _, name := range tableWireNames([]string{output}) {
+      index := indexOf(outputs, name)
+      ones, dontCares := []uint32{}, []uint32{}
+      for combination, state := range states[index] {
+        if state == '1' {
+          ones = append(ones, uint32(combination))
+        } else if state == 'x' {
+          dontCares = append(dontCares, uint32(combination))
+        }
+      }
+      expressions = append(expressions, formatSumOfProducts(inputs, minimize(len(inputs), ones, dontCares)))
+    }
+
+    if len(match[2]) == 0 {
+      source += fmt.Sprintf("  let %s = %s\n", output, expressions[0])
+    } else {
+      source += fmt.Sprintf("  let %s = (%s)\n", output, strings.Join(expressions, ") ("))
+    }
+  }
+  // Each wire of a bus is returned on its own, so that its outputs are named like `s[0]`.
+  source += fmt.Sprintf("  return %s\n}\n", strings.Join(outputs, " "))
+
+  generated, err := tokenize(source, node.File, nil)
+  if err != nil {
+    return NewNodeError(SYNTAX_ERROR, node, fmt.Sprintf("Table %s can't be made into a block: %s", table.Name, err))
+  }
+
+  // The generated nodes don't exist within the source, so they're given the location of the table.
+  for index := range *generated {
+    relocateNode(&(*generated)[index], node)
+  }
+  *nodes = append((*nodes)[:len(*nodes) - 1], *generated...)
+  return nil
+}
+
+// Every combination of inputs that a row stands for, where each `x` stands for both states.
+func tableRowCombinations(inputs string) []int {
+  combinations := []int{0}
+  for _, state := range inputs {
+    next := []int{}
+    for _, combination := range combinations {
+      if state != '1' {
+        next = append(next, combination << 1)
+      }
+      if state != '0' {
+        next = append(next, combination << 1 | 1)
+      }
+    }
+    combinations = next
+  }
+  return combinations
+}
+
+// Read the rows of a table from a csv file, which is relative to the file that contains the table.
+// The first line of the file can name each column, in which case the names must match `columns`.
+// The first `inputs` columns are inputs, and the rest are outputs.
+func readTableCsv(path string, node Node, columns []string, inputs int) ([]tableRow, error) {
+  resolvedPath := path
+  if !filepath.IsAbs(resolvedPath) && len(node.File) > 0 {
+    resolvedPath = filepath.Join(filepath.Dir(node.File), path)
+  }
+
+  if isRunningInServer {
+    return nil, NewNodeError(IMPORT_ERROR, node, fmt.Sprintf("Server cannot read local path '%s'. Stop.", path))
+  }
+  file, err := os.Open(resolvedPath)
+  if err != nil {
+    return nil, NewNodeError(FILE_ERROR, node, fmt.Sprintf("Error reading file %s: %s. Stop.", resolvedPath, err))
+  }
+  defer file.Close()
+
+  reader := csv.NewReader(file)
+  reader.Comment = '#'
+  reader.FieldsPerRecord = -1
+  reader.TrimLeadingSpace = true
+
+  rows := []tableRow{}
+  for first := true; ; first = false {
+    record, err := reader.Read()
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return nil, NewNodeError(FILE_ERROR, node, fmt.Sprintf("Error reading file %s: %s. Stop.", resolvedPath, err))
+    }
+    line, col := reader.FieldPos(0)
+    at := formatPosition(resolvedPath, line, col)
+
+    if first && !MATCH_VECTOR_STATES.MatchString(strings.Join(record, "")) {
+      if strings.Join(record, " ") != strings.Join(columns, " ") {
+        return nil, NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf(
+          "The columns of %s are %s, but the table has the columns %s. Stop.",
+          resolvedPath,
+          strings.Join(record, ", "),
+          strings.Join(columns, ", "),
+        ))
+      }
+      continue
+    }
+
+    if len(record) != len(columns) {
+      return nil, NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf("The row at %s has %d columns, but the table has %d columns. Stop.", at, len(record), len(columns)))
+    }
+    states := ""
+    for _, cell := range record {
+      state := strings.ToLower(strings.TrimSpace(cell))
+      if state != "0" && state != "1" && state != "x" {
+        return nil, NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf("The row at %s has the state %s, but each state must be 0, 1, or x. Stop.", at, cell))
+      }
+      states += state
+    }
+
+    rows = append(rows, tableRow{Inputs: states[:inputs], Outputs: states[inputs:], At: at})
+  }
+  return rows, nil
+}
+
+// Give a node, its children, and its operands the location of `at`.
+func relocateNode(node *Node, at Node) {
+  node.File = at.File
+  node.Line, node.Col, node.Offset = at.Line, at.Col, at.Offset
+  node.EndLine, node.EndCol, node.EndOffset = at.EndLine, at.EndCol, at.EndOffset
+
+  leftHandSide, rightHandSide := node.Operands()
+  for _, operand := range []*Node{leftHandSide, rightHandSide} {
+    if operand != nil {
+      relocateNode(operand, at)
+    }
+  }
+  if node.Children != nil {
+    for index := range *node.Children {
+      relocateNode(&(*node.Children)[index], at)
+    }
+  }
+}
+
+func indexOf(list []string, value string) int {
+  for index, item := range list {
+    if item == value {
+      return index
+    }
+  }
+  return -1
+}
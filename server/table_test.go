@@ -0,0 +1,119 @@
+package main
+
+import (
+  "testing"
+  "reflect"
+  "strings"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+)
+
+func TestMinimize(t *testing.T) {
+  // The majority of three inputs is true when any two inputs are.
+  terms := minimize(3, []uint32{3, 5, 6, 7}, nil)
+  if formatted := formatSumOfProducts([]string{"a", "b", "c"}, terms); formatted != "(b and c) or (a and c) or (a and b)" {
+    t.Errorf("Wrong majority: %s", formatted)
+  }
+
+  // Don't cares are used to make products smaller, but don't have to be covered.
+  terms = minimize(2, []uint32{2}, []uint32{3})
+  if formatted := formatSumOfProducts([]string{"a", "b"}, terms); formatted != "a" {
+    t.Errorf("Wrong product: %s", formatted)
+  }
+
+  for ones, expected := range map[int]string{0: "0", 4: "1", 1: "(not a) and (not b)"} {
+    all := []uint32{}
+    for combination := 0; combination < ones; combination++ {
+      all = append(all, uint32(combination))
+    }
+    if formatted := formatSumOfProducts([]string{"a", "b"}, minimize(2, all, nil)); formatted != expected {
+      t.Errorf("Expected %s, found %s", expected, formatted)
+    }
+  }
+}
+
+func tableOutputs(t *testing.T, source string, name string) (*BlockHarness, *TruthTable) {
+  harness, err := NewCompiler().HarnessString(source, name)
+  if err != nil {
+    t.Fatal(err)
+  }
+  table, err := harness.TruthTable()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return harness, table
+}
+
+func TestTable(t *testing.T) {
+  harness, table := tableOutputs(t, `
+    table majority(a b c) -> (out) {
+      011 -> 1
+      1x1 -> 1 // Two rows in one
+      11x -> 1
+    }
+  `, "majority")
+  if table.CSV() != "a,b,c,out\n0,0,0,0\n0,0,1,0\n0,1,0,0\n0,1,1,1\n1,0,0,0\n1,0,1,1\n1,1,0,1\n1,1,1,1\n" {
+    t.Errorf("Wrong table: %s", table.CSV())
+  }
+
+  // The block is `(b and c) or (a and c) or (a and b)`.
+  for gateType, expected := range map[GateType]int{AND: 3, OR: 2, NOT: 0} {
+    if count := len(findGatesByType(harness.Summary.Gates, gateType)); count != expected {
+      t.Errorf("Expected %d %s gates, found %d", expected, gateType, count)
+    }
+  }
+}
+
+func TestTableWithBuses(t *testing.T) {
+  harness, table := tableOutputs(t, `
+    table decode(n[2]) -> (s[2] z) {
+      0x -> 10 1
+      10 -> 01 0
+      11 -> xx 0
+    }
+  `, "decode")
+  if !reflect.DeepEqual(harness.Outputs, []string{"s[0]", "s[1]", "z"}) {
+    t.Errorf("Wrong outputs: %v", harness.Outputs)
+  }
+  if table.CSV() != "n[0],n[1],s[0],s[1],z\n0,0,1,0,1\n0,1,1,0,1\n1,0,0,1,0\n1,1,0,1,0\n" {
+    t.Errorf("Wrong table: %s", table.CSV())
+  }
+}
+
+func TestTableFromCsv(t *testing.T) {
+  directory, err := ioutil.TempDir("", "lovelace")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+
+  ioutil.WriteFile(filepath.Join(directory, "xor.csv"), []byte("a,b,out\n0,0,0\n0,1,1\n1,0,1\n1,1,0\n"), 0644)
+  path := filepath.Join(directory, "main.bit")
+  ioutil.WriteFile(path, []byte(`table xor2(a b) -> (out) from "xor.csv"`), 0644)
+
+  harness, err := NewCompiler().HarnessFile(path, "xor2")
+  if err != nil {
+    t.Fatal(err)
+  }
+  table, err := harness.TruthTable()
+  if err != nil || table.CSV() != "a,b,out\n0,0,0\n0,1,1\n1,0,1\n1,1,0\n" {
+    t.Errorf("Wrong table: %v %v", table, err)
+  }
+}
+
+func TestTableErrors(t *testing.T) {
+  for source, message := range map[string]string{
+    "table t(a b) -> (o) {\n  1x -> 1\n  11 -> 0\n}": "The rows at 2:3 and 3:3 give o different states when the inputs are 11",
+    "table t(a b) -> (o) {\n  1 -> 1\n}": "The row at 2:3 has 1 inputs and 1 outputs, but table t has 2 inputs and 1 outputs",
+    "table t(a a) -> (o) {\n}": "Table t uses a more than once",
+    "table t(a[11]) -> (o) {\n}": "Table t has 11 inputs, but tables can only have up to 10 inputs",
+    "table t(a) -> () {\n}": "Table t doesn't have any outputs",
+    "block b(a) {\n  table t(a) -> (o) {\n  }\n  return a\n}": "Tables can only be defined at the top level",
+  } {
+    _, err := Tokenizer(source)
+    if err == nil || !strings.Contains(err.Error(), message) {
+      t.Errorf("Expected an error containing %s, found %v", message, err)
+    }
+  }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+  "fmt"
+  "io/ioutil"
+)
+
+// The result of running a `test`.
+type TestResult struct {
+  Name string
+  Block string
+  File string
+  Line int
+  Col int
+
+  // The number of rows that were run, and why each row that didn't pass failed. A test that couldn't
+  // be run at all (ie, because its block doesn't compile) has a single failure.
+  Vectors int
+  Failures []string
+}
+
+func (r TestResult) Passed() bool {
+  return len(r.Failures) == 0
+}
+
+// Run every test within a file.
+func (c *Compiler) RunTestFile(path string) ([]TestResult, error) {
+  source, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, &CompileError{
+      Code: FILE_ERROR,
+      Message: fmt.Sprintf("Error reading file %s: %s. Stop.\n", path, err),
+      File: path,
+    }
+  }
+  return c.RunTests(string(source), path)
+}
+
+// Run every test within lovelace source. Each test invokes its block on its own, drives the inputs
+// of the block with each row in turn, and checks the outputs once the block is stable. Rows are run
+// in order without resetting the block, so blocks that have state can be tested too.
+func (c *Compiler) RunTests(input string, path string) ([]TestResult, error) {
+  nodes, err := NewModuleResolver().Tokenize(input, path)
+  if err != nil {
+    return nil, err
+  }
+
+  results := []TestResult{}
+  for _, node := range *nodes {
+    test, ok := node.Data.(*TestDecl)
+    if !ok {
+      continue
+    }
+
+    result := TestResult{Name: test.Name, Block: test.Block, File: node.File, Line: node.Line, Col: node.Col}
+    harness, err := c.Harness(*nodes, test.Block, node)
+    if err != nil {
+      result.Failures = append(result.Failures, err.Error())
+      results = append(results, result)
+      continue
+    }
+
+    for _, vector := range test.Vectors {
+      result.Vectors += 1
+      line, col := vector.Position(node)
+      at := formatPosition(node.File, line, col)
+
+      if len(vector.Inputs) != len(harness.Inputs) || len(vector.Outputs) != len(harness.Outputs) {
+        result.Failures = append(result.Failures, fmt.Sprintf(
+          "The row at %s has %d inputs and %d outputs, but %s has %d inputs and %d outputs",
+          at,
+          len(vector.Inputs),
+          len(vector.Outputs),
+          test.Block,
+          len(harness.Inputs),
+          len(harness.Outputs),
+        ))
+        continue
+      }
+
+      outputs, err := harness.Evaluate(parseStates(vector.Inputs))
+      if err != nil {
+        result.Failures = append(result.Failures, fmt.Sprintf("The row at %s failed: %s", at, err))
+        continue
+      }
+      if !statesMatch(vector.Outputs, outputs) {
+        result.Failures = append(result.Failures, fmt.Sprintf(
+          "The row at %s expected %s -> %s, but got %s",
+          at,
+          vector.Inputs,
+          vector.Outputs,
+          formatStates(outputs),
+        ))
+      }
+    }
+    results = append(results, result)
+  }
+  return results, nil
+}
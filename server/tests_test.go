@@ -0,0 +1,145 @@
+package main
+
+import (
+  "testing"
+  "reflect"
+  "strings"
+)
+
+func TestParseVectors(t *testing.T) {
+  vectors, err := parseVectors(`test "t" adder4 {`, `
+    // a b -> sum
+    0 1 -> 1
+    01_1 4'd3 -> x1 // A comment
+  `)
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  if !reflect.DeepEqual(vectors, []Vector{
+    Vector{Inputs: "01", Outputs: "1", Line: 2, Col: 5},
+    Vector{Inputs: "0111100", Outputs: "x1", Line: 3, Col: 5},
+  }) {
+    t.Errorf("Fail! %+v", vectors)
+  }
+}
+
+func TestParseVectorsErrors(t *testing.T) {
+  for body, message := range map[string]string{
+    "0 1": "isn't a list of inputs and outputs",
+    "0 -> 1 -> 1": "isn't a list of inputs and outputs",
+    "x -> 1": "can't contain x",
+    "2 -> 1": "2 isn't a list of wire states",
+    "3'd9 -> 1": "doesn't fit in 3 bits",
+  } {
+    _, err := parseVectors("", body)
+    if err == nil || !strings.Contains(err.Error(), message) {
+      t.Errorf("Expected an error containing %s for %s, found %v", message, body, err)
+    }
+  }
+}
+
+func TestRunTests(t *testing.T) {
+  results, err := NewCompiler().RunTests(`
+    import adder
+    block or2(a b) {
+      return a or b
+    }
+
+    test "halfadder" halfadder {
+      0 0 -> 0 0
+      0 1 -> 1 0
+      1 0 -> 1 0
+      1 1 -> 0 1
+    }
+    test "or2 is not xor" or2 {
+      0 1 -> 1
+      1 1 -> 0
+      1 -> 1
+    }
+    test "undefined" nope {
+      1 -> 1
+    }
+  `, "")
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+
+  if len(results) != 3 {
+    t.Errorf("Expected 3 results, found %+v", results)
+    return
+  }
+  if !results[0].Passed() || results[0].Vectors != 4 {
+    t.Errorf("halfadder should pass: %+v", results[0])
+  }
+  if !reflect.DeepEqual(results[1].Failures, []string{
+    "The row at 15:7 expected 11 -> 0, but got 1",
+    "The row at 16:7 has 1 inputs and 1 outputs, but or2 has 2 inputs and 1 outputs",
+  }) {
+    t.Errorf("Wrong failures: %+v", results[1].Failures)
+  }
+  if results[2].Passed() || !strings.Contains(results[2].Failures[0], "No block named nope") {
+    t.Errorf("Wrong failures: %+v", results[2].Failures)
+  }
+}
+
+// Rows are run one after another, so blocks with state can be tested.
+func TestRunTestsWithState(t *testing.T) {
+  results, err := NewCompiler().RunTests(`
+    block flipflop(clock) {
+      let q notq = tflipflop(clock 1)
+      return q
+    }
+    test "flip flop toggles on each rising edge" flipflop {
+      0 -> 0
+      1 -> 1
+      0 -> 1
+      1 -> 0
+    }
+  `, "")
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  if len(results) != 1 || !results[0].Passed() {
+    t.Errorf("Fail! %+v", results)
+  }
+}
+
+// Tests are ignored when a file is compiled.
+func TestTestsAreIgnoredWhenCompiling(t *testing.T) {
+  states := ledStates(t, `
+    block id(a) {
+      return a
+    }
+    test "id" id {
+      1 -> 1
+    }
+    led(id(1))
+  `)
+  if strings.Join(states, " ") != "on" {
+    t.Errorf("Leds don't match! %v", states)
+  }
+}
+
+func TestHarnessWithConstants(t *testing.T) {
+  nodes := MustTokenize(`
+    block last<N>(a[N]) {
+      return a[N-1]
+    }
+  `)
+  harness, err := NewCompiler().Harness(*nodes, "last<3>", Node{})
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  if !reflect.DeepEqual(harness.Inputs, []string{"a[0]", "a[1]", "a[2]"}) || !reflect.DeepEqual(harness.Outputs, []string{"a[2]"}) {
+    t.Errorf("Wrong inputs or outputs: %v %v", harness.Inputs, harness.Outputs)
+  }
+
+  outputs, err := harness.Evaluate([]bool{false, false, true})
+  if err != nil || !reflect.DeepEqual(outputs, []bool{true}) {
+    t.Errorf("Fail! %v %v", outputs, err)
+  }
+}
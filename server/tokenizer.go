@@ -8,8 +8,16 @@ import (
   "strings"
 )
 
-var NO_DATA func([]string) (map[string]interface{}, error) = func(m []string) (map[string]interface{}, error) {
-  return map[string]interface{}{}, nil
+var NO_DATA func([]string) (NodeData, error) = func(m []string) (NodeData, error) {
+  return nil, nil
+}
+
+// The operands of operators are filled in as they're tokenized.
+var BINARY_EXPR_DATA func([]string) (NodeData, error) = func(m []string) (NodeData, error) {
+  return &BinaryExpr{}, nil
+}
+var UNARY_EXPR_DATA func([]string) (NodeData, error) = func(m []string) (NodeData, error) {
+  return &UnaryExpr{}, nil
 }
 
 // A regular expression that matches whitespace at the start and end of a string.
@@ -33,8 +41,8 @@ type Token struct {
   WrapperEndName string
 
   Match *regexp.Regexp
-  GetData func([]string) (map[string]interface{}, error)
-  SideEffect func([]string, *TokenizerFrame) error
+  GetData func([]string) (NodeData, error)
+  SideEffect func([]string, *TokenizerFrame, *ModuleResolver) error
 }
 
 var TOKENS []Token
@@ -44,28 +52,116 @@ func init() {
       Name: "MULTI_COMMENT",
       Type: SINGLE,
       Match: regexp.MustCompile(`(?s)^/\*(.*)\*/`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{
-          // Remove leading and trailing whitespace from comment.
-          "Message": MATCH_WHITESPACE_AT_ENDS.ReplaceAllString(match[1], ``),
-        }, nil;
+      GetData: func(match []string) (NodeData, error) {
+        // Remove leading and trailing whitespace from comment.
+        return &Comment{Message: MATCH_WHITESPACE_AT_ENDS.ReplaceAllString(match[1], ``)}, nil
       },
     },
     Token{
       Name: "SINGLE_COMMENT",
       Type: SINGLE,
       Match: regexp.MustCompile(`^\/\/([^\n]*)`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{
-          // Remove leading and trailing whitespace from comment.
-          "Message": MATCH_WHITESPACE_AT_ENDS.ReplaceAllString(match[1], ``),
-        }, nil
+      GetData: func(match []string) (NodeData, error) {
+        // Remove leading and trailing whitespace from comment.
+        return &Comment{Message: MATCH_WHITESPACE_AT_ENDS.ReplaceAllString(match[1], ``)}, nil
       },
     },
 
-    Token{Name: "OP_AND", Type: BINARY_OPERATOR, Match: regexp.MustCompile("^and"), GetData: NO_DATA},
-    Token{Name: "OP_OR", Type: BINARY_OPERATOR, Match: regexp.MustCompile("^or"), GetData: NO_DATA},
-    Token{Name: "OP_NOT", Type: UNARY_OPERATOR, Match: regexp.MustCompile("^not"), GetData: NO_DATA},
+    Token{Name: "OP_AND", Type: BINARY_OPERATOR, Match: regexp.MustCompile("^and"), GetData: BINARY_EXPR_DATA},
+    Token{Name: "OP_OR", Type: BINARY_OPERATOR, Match: regexp.MustCompile("^or"), GetData: BINARY_EXPR_DATA},
+    // These operators are only matched as whole words, so that identifiers like `north` or `xorg`
+    // aren't split into an operator and an identifier.
+    Token{Name: "OP_XOR", Type: BINARY_OPERATOR, Match: regexp.MustCompile(`^xor\b`), GetData: BINARY_EXPR_DATA},
+    Token{Name: "OP_NAND", Type: BINARY_OPERATOR, Match: regexp.MustCompile(`^nand\b`), GetData: BINARY_EXPR_DATA},
+    Token{Name: "OP_NOR", Type: BINARY_OPERATOR, Match: regexp.MustCompile(`^nor\b`), GetData: BINARY_EXPR_DATA},
+    Token{Name: "OP_XNOR", Type: BINARY_OPERATOR, Match: regexp.MustCompile(`^xnor\b`), GetData: BINARY_EXPR_DATA},
+    Token{Name: "OP_NOT", Type: UNARY_OPERATOR, Match: regexp.MustCompile("^not"), GetData: UNARY_EXPR_DATA},
+
+    // Generate constructs, which are expanded at compile time. See `unrollGenerate`.
+    Token{
+      Name: "GENERATE_FOR",
+
+      Type: WRAPPER_START,
+      WrapperEndName: "BLOCK_END",
+
+      // for i in 0..N {
+      Match: regexp.MustCompile(`^for\s+([A-Za-z_][A-Za-z0-9_]*)\s+in\s+([^\s{]+?)\.\.([^\s{]+)\s*\{`),
+      GetData: func(match []string) (NodeData, error) {
+        return &ForLoop{Variable: match[1], Start: match[2], End: match[3]}, nil
+      },
+    },
+    Token{
+      Name: "GENERATE_IF",
+
+      Type: WRAPPER_START,
+      WrapperEndName: "BLOCK_END",
+
+      // if N == 0 {
+      Match: regexp.MustCompile(`^if\s+([^{\n]+?)\s*\{`),
+      GetData: func(match []string) (NodeData, error) {
+        return &IfBranch{Condition: match[1]}, nil
+      },
+    },
+    Token{
+      Name: "GENERATE_ELSE",
+
+      Type: WRAPPER_START,
+      WrapperEndName: "BLOCK_END",
+
+      Match: regexp.MustCompile(`^else\s*\{`),
+      GetData: NO_DATA,
+    },
+
+    // A test of a block, which is only run by `lovel test`. The rows of the test are parsed by
+    // `parseVectors`.
+    Token{
+      Name: "TEST",
+      Type: SINGLE,
+      Match: regexp.MustCompile(`^test\s+"([^"\n]*)"\s+([A-Za-z_][A-Za-z0-9_.]*(?:<[^>]*>)?)\s*\{([^}]*)\}`),
+      GetData: func(match []string) (NodeData, error) {
+        prefix := match[0][:len(match[0]) - len(match[3]) - 1]
+        vectors, err := parseVectors(prefix, match[3])
+        if err != nil {
+          return nil, errors.New(fmt.Sprintf("%s, in test \"%s\"", err, match[1]))
+        }
+        return &TestDecl{Name: match[1], Block: match[2], Vectors: vectors}, nil
+      },
+    },
+
+    // A block that is defined by its truth table, which is replaced with the block when it's
+    // tokenized. See `table.go`.
+    Token{
+      Name: "TABLE",
+      Type: SINGLE,
+      Match: regexp.MustCompile(`^table\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(([^)]*)\)\s*->\s*\(([^)]*)\)\s*(?:\{([^}]*)\}|from\s+"([^"\n]*)")`),
+      GetData: func(match []string) (NodeData, error) {
+        inputs, err := parseTableWires(match[2])
+        if err != nil {
+          return nil, errors.New(fmt.Sprintf("%s, in table %s", err, match[1]))
+        }
+        outputs, err := parseTableWires(match[3])
+        if err != nil {
+          return nil, errors.New(fmt.Sprintf("%s, in table %s", err, match[1]))
+        }
+        if len(outputs) == 0 {
+          return nil, errors.New(fmt.Sprintf("Table %s doesn't have any outputs", match[1]))
+        }
+
+        data := &TableDecl{Name: match[1], Inputs: inputs, Outputs: outputs, Path: match[5]}
+        if len(match[5]) == 0 {
+          prefix := match[0][:len(match[0]) - len(match[4]) - 1]
+          data.Vectors, err = parseRows(prefix, match[4], true)
+          if err != nil {
+            return nil, errors.New(fmt.Sprintf("%s, in table %s", err, match[1]))
+          }
+        }
+        return data, nil
+      },
+      SideEffect: func(match []string, stackframe *TokenizerFrame, resolver *ModuleResolver) error {
+        if stackframe.Nodes == nil { return nil }
+        return expandTable(stackframe.Nodes)
+      },
+    },
 
     Token{
       Name: "INVOCATION",
@@ -73,9 +169,11 @@ func init() {
       Type: WRAPPER_START,
       WrapperEndName: "GROUP_END",
 
-      Match: regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\(`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{"Name": match[1]}, nil
+      // Constants can be passed to a block before its parameters, like `adder<8>(a b)`, and blocks
+      // imported with a namespace are invoked by their qualified name, like `arith.adder4(a b)`.
+      Match: regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)(?:<([^>]*)>)?\(`),
+      GetData: func(match []string) (NodeData, error) {
+        return &Invocation{Name: match[1], Constants: strings.Join(strings.Fields(match[2]), " ")}, nil
       },
     },
 
@@ -97,55 +195,39 @@ func init() {
       WrapperEndName: "BLOCK_END",
 
       // block identifier(as many identifiers ay needed in here all space seperated) {
-      Match: regexp.MustCompile(`^(?m)block\s*([A-Za-z_][A-Za-z0-9_]*)\s*\(\s*((([A-Za-z_][A-Za-z0-9_]*(?:\[\d+])?)\s*)*([A-Za-z_][A-Za-z0-9_]*(?:\[\d+]))?)\)\s*\{`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        inputQuantity := 0
-        var params []string
-
-        // Were params passed to the block?
-        if len(match[2]) > 0 {
-          // If so, take a look at each one and if it's special then process it.
-          for _, inp := range strings.Split(strings.Trim(match[2], " \n\t"), " ") {
-            if inp[len(inp)-1] == ']' {
-              // This parameter has an expansion at the end!
-
-              // Locate the expansion part of the param
-              startOfExpansion := strings.LastIndex(inp, "[") + 1
-              endOfExpansion := len(inp) - 1
-
-              // Read the expansion number in the expansion part
-              expansionAmount, err := strconv.ParseUint(
-                inp[startOfExpansion:endOfExpansion],
-                10, /* base 10 */
-                32, /* 32 bit number */
-              )
-              if err != nil {
-                panic(fmt.Sprintf("Could not parse '%s' as uint (the regex ensures that this is a uint, so this should never happen!)", inp[startOfExpansion:endOfExpansion]));
-              }
-
-              // Get the part of the parameter before the expansion
-              paramName := inp[:startOfExpansion-1]
-
-              // Perform the expansion.
-              // For example, `b[2]` is converted into `b0 b1`
-              for i := 0; i < int(expansionAmount); i++ {
-                params = append(params, fmt.Sprintf("%s%d", paramName, i))
-              }
-            } else {
-              // There's nothing special about this parameter, just pass it through like normal.
-              params = append(params, inp)
-            }
+      // A block can also accept constants before its parameters, like `block adder<N>(a[N] b[N]) {`,
+      // and parameters can have default values, like `block counter(clock reset = 0) {`
+      Match: regexp.MustCompile(`^(?m)block\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?:<([^>]*)>)?\s*\(\s*((([A-Za-z_][A-Za-z0-9_]*(?:\[[^\]\s]+])?(?:\s*=\s*[0-9][0-9A-Za-z_']*)?)\s*)*([A-Za-z_][A-Za-z0-9_]*(?:\[[^\]\s]+]))?)\)\s*\{`),
+      GetData: func(match []string) (NodeData, error) {
+        paramsWithoutDefaults, defaults, err := splitParamDefaults(match[3])
+        if err != nil {
+          return nil, err
+        }
+
+        // The output quantity is set within `BLOCK_END`.
+        data := &BlockDecl{Name: match[1], Buses: map[string]int{}}
+        if constants := strings.Fields(match[2]); len(constants) > 0 {
+          // The width of a bus parameter can depend on the block's constants, so the parameters of a
+          // block with constants are expanded each time that it's invoked. See `instantiateBlock`.
+          data.Constants = strings.Join(constants, " ")
+          data.Params = paramsWithoutDefaults
+        } else {
+          // Expand each parameter that is a bus into a parameter for each wire within the bus.
+          // For example, `b[2]` is converted into `b0 b1`
+          params, buses, err := expandBlockParams(paramsWithoutDefaults, nil)
+          if err != nil {
+            return nil, errors.New(fmt.Sprintf("%s, in block %s", err, match[1]))
           }
 
-          inputQuantity = len(params)
+          data.Params = strings.Join(params, " ")
+          data.Buses = buses
+          data.InputQuantity = len(params)
         }
 
-        return map[string]interface{}{
-          "Name": match[1],
-          "Params": strings.Join(params, " "),
-          "InputQuantity": inputQuantity,
-          "OutputQuantity": 0, // Will be overridden within `BLOCK_END`
-        }, nil
+        if len(defaults) > 0 {
+          data.Defaults = defaults
+        }
+        return data, nil
       },
     },
     Token{
@@ -153,7 +235,7 @@ func init() {
       Type: WRAPPER_END,
       Match: regexp.MustCompile("^\\}"),
       GetData: NO_DATA,
-      SideEffect: func(match []string, stackframe *TokenizerFrame) error {
+      SideEffect: func(match []string, stackframe *TokenizerFrame, resolver *ModuleResolver) error {
         // Assert that the stackframe isn't nil.
         if stackframe.Nodes == nil { return nil }
 
@@ -163,7 +245,8 @@ func init() {
 
         // Get the most recent node in the stack frame.
         mostRecentNode := nodes[len(nodes) - 1]
-        if mostRecentNode.Token != "BLOCK" { return nil }
+        block, ok := mostRecentNode.Data.(*BlockDecl)
+        if !ok { return nil }
         blockChildren := *(mostRecentNode.Children)
 
         // Within the block that's beng closed, was there a return? And, if so, what index token was
@@ -178,11 +261,11 @@ func init() {
 
         if returnIndex == -1 {
           // No return was found, so no tokens are beign returned.
-          mostRecentNode.Data["OutputQuantity"] = 0
+          block.OutputQuantity = 0
         } else {
           // Now that the output token location is known, calculate how many tokens were after the
           // return, and that's the number of tokens that are being returned.
-          mostRecentNode.Data["OutputQuantity"] = (len(blockChildren) - 1) - returnIndex
+          block.OutputQuantity = (len(blockChildren) - 1) - returnIndex
         }
 
         return nil
@@ -199,51 +282,48 @@ func init() {
       Name: "IMPORT",
       Type: SINGLE,
       Match: regexp.MustCompile(`^import\s+(.+)`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{
-          "Path": match[1],
-        }, nil
+      GetData: func(match []string) (NodeData, error) {
+        return &Import{Path: match[1]}, nil
       },
-      SideEffect: func(match []string, stackframe *TokenizerFrame) error {
+      SideEffect: func(match []string, stackframe *TokenizerFrame, resolver *ModuleResolver) error {
         // Assert that the stackframe isn't nil.
         if stackframe.Nodes == nil { return nil }
 
-        // Verify that the path exists
-        path := match[1]
-        isStdLib := regexp.MustCompile(`^[a-zA-Z_]+$`).MatchString(path)
-        if isRunningInServer && !isStdLib {
-          return errors.New(fmt.Sprintf("Server cannot import local path '%s'", path))
+        // An import can put its blocks within a namespace, like `import adder as arith`.
+        path, namespace := match[1], ""
+        if namespaced := MATCH_NAMESPACED_IMPORT.FindStringSubmatch(match[1]); namespaced != nil {
+          path, namespace = namespaced[1], namespaced[2]
         }
 
-        if isStdLib {
-          // Look up the standard lib function
-          input, ok := STANDARD_LIBRARY[path]
-          if !ok {
-            return errors.New(fmt.Sprintf("No such standard lib collection found: %s", path))
-          }
-
-          // Tokenize the contents of the standard library
-          // TODO: Ideally, this would be a step that happens when the compiler starts and not on
-          // every `import`.
-          stdLibNodes, err := Tokenizer(input)
-          if err != nil {
-            return errors.New(fmt.Sprintf("Error in tokenizng import '%s': %s", path, err))
-          }
+        // Find the tokens that the import refers to.
+        importedNodes, err := resolver.Resolve(path, len(namespace) > 0)
+        if err != nil {
+          return err
+        }
 
-          // Now, add the tokens from the standard library into the main program.
+        // Now, add the imported tokens into the main program.
+
+        // First, remove the import token. It's served its purpose.
+        nodes := (*stackframe).Nodes
+        importNode := (*nodes)[len(*nodes)-1]
+        nodesWithImportTokenRemoved := (*nodes)[:len(*nodes)-1]
+
+        // Namespaced imports are kept together in a module, so that their blocks can be given
+        // qualified names when they're parsed. See `newModule`.
+        if len(namespace) > 0 {
+          module := importNode
+          module.Token = "MODULE"
+          module.Data = &ModuleDecl{Name: namespace}
+          children := importedNodes
+          module.Children = &children
+          importedNodes = []Node{module}
+        }
 
-          // First, remove the import token. It's served its purpose.
-          nodes := (*stackframe).Nodes
-          nodesWithImportTokenRemoved := (*nodes)[:len(*nodes)-1]
+        // Add the tokens that were generated by tokenizing the imported code
+        newNodes := append(nodesWithImportTokenRemoved, importedNodes...)
 
-          // Add the tokens that were generated by tokenizing the library code
-          newNodes := append(nodesWithImportTokenRemoved, (*stdLibNodes)...)
-
-          // Reassign the slice to the new slice that was created
-          *nodes = newNodes
-        } else {
-          return errors.New("Currently, import only allows including standard library functions.")
-        }
+        // Reassign the slice to the new slice that was created
+        *nodes = newNodes
 
         return nil
       },
@@ -252,43 +332,182 @@ func init() {
     Token{
       Name: "ASSIGNMENT",
       Type: SINGLE,
-      Match: regexp.MustCompile(`^let +(([A-Za-z_][A-Za-z0-9_]* +)*[A-Za-z_][A-Za-z0-9_]*) ?= ?`),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{
-          "Names": match[1],
-          "Values": []Node{},
-        }, nil
+      // Each name can declare a bus, like `let a[4] = ...`
+      Match: regexp.MustCompile(`^let +(([A-Za-z_][A-Za-z0-9_]*(?:\[[^\]\s]+])? +)*[A-Za-z_][A-Za-z0-9_]*(?:\[[^\]\s]+])?) ?= ?`),
+      GetData: func(match []string) (NodeData, error) {
+        return &Assignment{Names: match[1]}, nil
       },
     },
 
+    Token{
+      Name: "ARGUMENT_NAME",
+      Type: SINGLE,
+      // The name of the parameter that the next argument is passed to, like `reset:` in
+      // `counter8(clock: clk, reset: 0)`.
+      Match: regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*:`),
+      GetData: func(match []string) (NodeData, error) {
+        return &ArgumentName{Name: match[1]}, nil
+      },
+    },
+    Token{
+      Name: "BUS_INDEX",
+      Type: SINGLE,
+      // Either a single wire within a bus, like `a[2]`, or a slice of a bus, like `a[0:4]`. The
+      // start of a slice is inclusive, and the end is exclusive. Indexes that refer to the constants
+      // of a block, like `a[N-1]`, are left as expressions until the block is invoked.
+      Match: regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\[([^\]:\s]+)(?::([^\]\s]+))?]`),
+      GetData: func(match []string) (NodeData, error) {
+        data := &BusIndex{Name: match[1], StartExpression: match[2], EndExpression: match[2] + "+1"}
+        if len(match[3]) > 0 {
+          data.EndExpression = match[3]
+        }
+        data.resolve(nil)
+
+        if data.IsResolved() && data.End <= data.Start {
+          return nil, errors.New(fmt.Sprintf("Slice %s must end after it starts", match[0]))
+        }
+        return data, nil
+      },
+    },
     Token{
       Name: "IDENTIFIER",
       Type: SINGLE,
       Match: regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*"),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{"Value": match[0]}, nil
+      GetData: func(match []string) (NodeData, error) {
+        return &Identifier{Value: match[0]}, nil
+      },
+    },
+    Token{
+      Name: "LITERAL",
+      Type: SINGLE,
+      // A group of constant wires, written as a width and a value in binary, decimal, or hex, like
+      // `4'b0011`, `4'd3`, or `8'hFF`.
+      Match: MATCH_LITERAL,
+      GetData: func(match []string) (NodeData, error) {
+        bits, err := parseLiteral(match[0], match[1], match[2], match[3])
+        if err != nil {
+          return nil, err
+        }
+        return &Literal{Width: len(bits), Bits: bits}, nil
+      },
+    },
+    Token{
+      Name: "INTEGER",
+      Type: SINGLE,
+      // A lone 0 or 1 is a boolean, so integers are either a single digit larger than one or more
+      // than one digit long.
+      Match: regexp.MustCompile("^([2-9]|[0-9]{2,})"),
+      GetData: func(match []string) (NodeData, error) {
+        value, err := strconv.Atoi(match[1])
+        if err != nil {
+          return nil, errors.New(fmt.Sprintf("Integer %s is too large", match[1]))
+        }
+        return &Integer{Value: value}, nil
       },
     },
     Token{
       Name: "BOOL",
       Type: SINGLE,
       Match: regexp.MustCompile("^(1|0)"),
-      GetData: func(match []string) (map[string]interface{}, error) {
-        return map[string]interface{}{
-          "Value": match[1] == "1",
-        }, nil
+      GetData: func(match []string) (NodeData, error) {
+        return &Bool{Value: match[1] == "1"}, nil
       },
     },
   }
 }
-var RESERVED_WORDS []string = []string{"let", "block", "return"}
+var RESERVED_WORDS []string = []string{"let", "block", "return", "for", "if", "else"}
+
+// The name of each binary operator token, as it appears in error messages.
+var BINARY_OPERATOR_NAMES map[string]string = map[string]string{
+  "OP_AND": "And",
+  "OP_OR": "Or",
+  "OP_XOR": "Xor",
+  "OP_NAND": "Nand",
+  "OP_NOR": "Nor",
+  "OP_XNOR": "Xnor",
+}
+
+// How tightly each binary operator binds to its operands. Operators with a higher precedence are
+// grouped first, so `a or b and c` is the same as `a or (b and c)`. Operators with the same
+// precedence are grouped from left to right. `not` binds more tightly than any binary operator.
+var BINARY_OPERATOR_PRECEDENCE map[string]int = map[string]int{
+  "OP_AND": 3,
+  "OP_NAND": 3,
+  "OP_XOR": 2,
+  "OP_XNOR": 2,
+  "OP_OR": 1,
+  "OP_NOR": 1,
+}
 
 type Node struct {
   Token string
-  Data map[string]interface{}
-  Row int
+  Data NodeData `json:",omitempty"`
+  // The file that the node was tokenized from, or an empty string if the source wasn't in a file.
+  File string `json:",omitempty"`
+
+  // Where the token that created the node starts.
+  Line int
   Col int
-  Children *[]Node
+  Offset int
+
+  // Where the node ends (exclusive). This includes any children (up to and including the token that
+  // closes a wrapper) and the right hand side of an operator.
+  EndLine int
+  EndCol int
+  EndOffset int
+
+  Children *[]Node `json:",omitempty"`
+}
+
+// The location of the source that the node was tokenized from.
+func (n Node) Span() SourceSpan {
+  return SourceSpan{
+    File: n.File,
+    Line: n.Line,
+    Col: n.Col,
+    Offset: n.Offset,
+    EndLine: n.EndLine,
+    EndCol: n.EndCol,
+    EndOffset: n.EndOffset,
+  }
+}
+
+// A location within source code. Lines and columns start at 1, and the offset is the number of
+// bytes from the start of the source.
+type Position struct {
+  Line int
+  Col int
+  Offset int
+}
+
+// Move the position past `text`.
+func (p Position) Advance(text string) Position {
+  for i := 0; i < len(text); i++ {
+    if text[i] == '\n' {
+      p.Line += 1
+      p.Col = 1
+    } else {
+      p.Col += 1
+    }
+    p.Offset += 1
+  }
+  return p
+}
+
+// Create a node for a token in `path` that starts at `start` and ends at `end`.
+func newNode(token string, path string, start Position, end Position, data NodeData, children *[]Node) Node {
+  return Node{
+    Token: token,
+    Data: data,
+    File: path,
+    Line: start.Line,
+    Col: start.Col,
+    Offset: start.Offset,
+    EndLine: end.Line,
+    EndCol: end.Col,
+    EndOffset: end.Offset,
+    Children: children,
+  }
 }
 
 type TokenizerFrame struct {
@@ -300,24 +519,39 @@ type TokenizerFrame struct {
 // of why this is helpful is to ensure that identifiers aren't reserved words - since identifiers
 // are enveloped inside of other tokens, it's helpful to check the content of the identifiers before
 // this happens.
-func PreSideEffectValidator(nodes []Node) error {
+func PreSideEffectValidator(nodes []Node) *CompileError {
   for i := 0; i < len(nodes); i++ {
     // Check to make sure identifiers aren't reserved words.
-    if nodes[i].Token == "IDENTIFIER" {
+    if identifier, ok := nodes[i].Data.(*Identifier); ok {
       // Ensure that the identifier isn't a reserved word.
       for _, reserved := range RESERVED_WORDS {
-        if nodes[i].Data["Value"] == reserved {
-          return errors.New(fmt.Sprintf("Identifier %s is a reserved word", reserved))
+        if identifier.Value == reserved {
+          return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("Identifier %s is a reserved word", reserved))
+        }
+      }
+    }
+
+    // Ensure that a bus that is indexed isn't a reserved word.
+    if index, ok := nodes[i].Data.(*BusIndex); ok {
+      for _, reserved := range RESERVED_WORDS {
+        if index.Name == reserved {
+          return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("Identifier %s is a reserved word", reserved))
         }
       }
     }
 
     // Ensure that the identifier in an assignment isn't a reserved word.
-    if nodes[i].Token == "ASSIGNMENT" {
+    if assignment, ok := nodes[i].Data.(*Assignment); ok {
       for _, reserved := range RESERVED_WORDS {
-        for _, name := range strings.Split(nodes[i].Data["Names"].(string), " ") {
+        for _, name := range strings.Split(assignment.Names, " ") {
+          if busName, _, ok := parseBusDeclaration(name); ok {
+            name = busName
+          }
           if name == reserved {
-            return errors.New(fmt.Sprintf("Identifier %s is a reserved word, and cannot be assigned to", reserved))
+            return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf(
+              "Identifier %s is a reserved word, and cannot be assigned to",
+              reserved,
+            ))
           }
         }
       }
@@ -327,7 +561,7 @@ func PreSideEffectValidator(nodes []Node) error {
     if nodes[i].Token == "BLOCK_RETURN" && len(nodes) > i {
       for _, node := range nodes[i+1:] {
         if !TokenNameIsExtendedExpression(node.Token) {
-          return errors.New(fmt.Sprintf("Non-expression token %s found after return", node.Token))
+          return NewNodeError(VALIDATION_ERROR, node, fmt.Sprintf("Non-expression token %s found after return", node.Token))
         }
       }
     }
@@ -336,8 +570,8 @@ func PreSideEffectValidator(nodes []Node) error {
   return nil
 }
 
-func Validator(nodes []Node) error {
-  DUMMY_NODE := Node{Token: "", Data: map[string]interface{}{}, Row: -1, Col: -1}
+func Validator(nodes []Node) *CompileError {
+  DUMMY_NODE := Node{Token: "", Line: -1, Col: -1}
 
   for i := 0; i < len(nodes); i++ {
     // Create an array of nodes before (where the index is the number of tokens previous to the
@@ -364,49 +598,49 @@ func Validator(nodes []Node) error {
 
     // START ASSERTIONS
     // ----------
-    if nodes[i].Token == "OP_AND" {
-      if leftHandSide, ok := nodes[i].Data["LeftHandSide"].(Node); ok {
-        if !TokenNameIsExpression(leftHandSide.Token) {
-          return errors.New("And operator missing a boolean/group on the left hand side")
+    // The operands of an operator can be other operators, which are validated too.
+    leftHandSide, rightHandSide := nodes[i].Operands()
+    if name, ok := BINARY_OPERATOR_NAMES[nodes[i].Token]; ok {
+      if leftHandSide != nil {
+        if !TokenNameIsExtendedExpression(leftHandSide.Token) {
+          return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("%s operator missing a boolean/group on the left hand side", name))
+        }
+        if err := Validator([]Node{*leftHandSide}); err != nil {
+          return err
         }
       } else {
-        return errors.New("And operator left hand side is not a node")
+        return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("%s operator left hand side is not a node", name))
       }
 
-      if rightHandSide, ok := nodes[i].Data["RightHandSide"].(Node); ok {
-        if !TokenNameIsExpression(rightHandSide.Token) {
-          return errors.New("And operator missing a boolean/group on the right hand side")
+      if rightHandSide != nil {
+        if !TokenNameIsExtendedExpression(rightHandSide.Token) {
+          return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("%s operator missing a boolean/group on the right hand side", name))
+        }
+        if err := Validator([]Node{*rightHandSide}); err != nil {
+          return err
         }
       } else {
-        return errors.New("And operator right hand side is not a node")
+        return NewNodeError(VALIDATION_ERROR, nodes[i], fmt.Sprintf("%s operator right hand side is not a node", name))
       }
     }
 
-    if nodes[i].Token == "OP_OR" {
-      if leftHandSide, ok := nodes[i].Data["LeftHandSide"].(Node); ok {
-        if !TokenNameIsExpression(leftHandSide.Token) {
-          return errors.New("Or operator missing a boolean/group on the left hand side")
+    if nodes[i].Token == "OP_NOT" {
+      if rightHandSide != nil {
+        if !TokenNameIsExtendedExpression(rightHandSide.Token) {
+          return NewNodeError(VALIDATION_ERROR, nodes[i], "Not operator missing a boolean/group on the right hand side")
         }
-      } else {
-        return errors.New("Or operator left hand side is not a node")
-      }
-
-      if rightHandSide, ok := nodes[i].Data["RightHandSide"].(Node); ok {
-        if !TokenNameIsExpression(rightHandSide.Token) {
-          return errors.New("Or operator missing a boolean/group on the right hand side")
+        if err := Validator([]Node{*rightHandSide}); err != nil {
+          return err
         }
       } else {
-        return errors.New("Or operator right hand side is not a node")
+        return NewNodeError(VALIDATION_ERROR, nodes[i], "Not operator right hand side is not a node")
       }
     }
 
-    if nodes[i].Token == "OP_NOT" {
-      if rightHandSide, ok := nodes[i].Data["RightHandSide"].(Node); ok {
-        if !TokenNameIsExpression(rightHandSide.Token) {
-          return errors.New("Not operator missing a boolean/group on the right hand side")
-        }
-      } else {
-        return errors.New("Or operator right hand side is not a node")
+    // Operators within a wrapper (ie, a group, or the arguments of an invocation) are validated too.
+    if nodes[i].Children != nil {
+      if err := Validator(*nodes[i].Children); err != nil {
+        return err
       }
     }
   }
@@ -417,16 +651,83 @@ func Validator(nodes []Node) error {
 // An expression is a token that can appear in either the right hand side or left hand side of an
 // operator.
 func TokenNameIsExpression(name string) bool {
-  return name == "BOOL" || name == "IDENTIFIER" || name == "GROUP" || name == "INVOCATION"
+  return name == "BOOL" || name == "LITERAL" || name == "IDENTIFIER" || name == "BUS_INDEX" || name == "GROUP" || name == "INVOCATION"
 }
 
 // An extended expression is an expression, plus some tokens that would usually be ambiguous next to
 // an operator.
 func TokenNameIsExtendedExpression(name string) bool {
-  return TokenNameIsExpression(name) || name == "OP_AND" || name == "OP_OR" || name == "OP_NOT"
+  _, isBinaryOperator := BINARY_OPERATOR_NAMES[name]
+  return TokenNameIsExpression(name) || isBinaryOperator || name == "OP_NOT"
+}
+
+// A complete expression is an expression, or an operator that has found all of its operands.
+func NodeIsCompleteExpression(node Node) bool {
+  if TokenNameIsExpression(node.Token) {
+    return true
+  }
+  if !TokenNameIsExtendedExpression(node.Token) {
+    return false
+  }
+
+  // The left hand side of a binary operator is always complete, so only the right hand side needs to
+  // be checked.
+  _, rightHandSide := node.Operands()
+  return rightHandSide != nil && NodeIsCompleteExpression(*rightHandSide)
+}
+
+// Is an operand missing somewhere along the right hand side of the node? ie, `a or b and` is missing
+// the right hand side of the `and`, which is the right hand side of the `or`.
+func nodeIsMissingOperand(node Node) bool {
+  _, isBinary := node.Data.(*BinaryExpr)
+  _, isUnary := node.Data.(*UnaryExpr)
+  if !isBinary && !isUnary {
+    return false
+  }
+  if _, rightHandSide := node.Operands(); rightHandSide != nil {
+    return nodeIsMissingOperand(*rightHandSide)
+  }
+  return true
+}
+
+// Put `operand` in the place of the missing operand along the right hand side of `node`. Each
+// operator along the way now ends where `operand` ends.
+func fillMissingOperand(node Node, operand Node) Node {
+  if _, rightHandSide := node.Operands(); rightHandSide != nil {
+    operand = fillMissingOperand(*rightHandSide, operand)
+  }
+
+  node.setRightHandSide(&operand)
+  node.EndLine, node.EndCol, node.EndOffset = operand.EndLine, operand.EndCol, operand.EndOffset
+  return node
+}
+
+// Add a binary operator after the complete expression `leftHandSide`. If `leftHandSide` is an
+// operator that binds less tightly than `operator`, then `operator` takes the right hand side of
+// that operator as its left hand side instead, and becomes that operator's right hand side.
+// For example, adding `and` after `a or b` results in `a or (b and ...)`.
+func insertBinaryOperator(leftHandSide Node, operator Node) Node {
+  precedence, ok := BINARY_OPERATOR_PRECEDENCE[leftHandSide.Token]
+  if ok && precedence < BINARY_OPERATOR_PRECEDENCE[operator.Token] {
+    data := leftHandSide.Data.(*BinaryExpr)
+    inserted := insertBinaryOperator(*data.RightHandSide, operator)
+    data.RightHandSide = &inserted
+    return leftHandSide
+  }
+
+  operator.Data.(*BinaryExpr).LeftHandSide = &leftHandSide
+  return operator
 }
 
+// Tokenize source that didn't come from a file. Any local imports are resolved relative to the
+// working directory.
 func Tokenizer(input string) (*[]Node, error) {
+  return NewModuleResolver().Tokenize(input, "")
+}
+
+// Tokenize source that was read from `path` (which is empty if the source didn't come from a file),
+// resolving imports with `resolver`.
+func tokenize(input string, path string, resolver *ModuleResolver) (*[]Node, error) {
   code := []byte(input)
 
   root := &[]Node{}
@@ -439,21 +740,18 @@ func Tokenizer(input string) (*[]Node, error) {
     },
   }
 
-  // Initial values for current column and row.
-  currentRow := 1
-  currentCol := 1
+  // The position of the start of `code` within the source.
+  current := Position{Line: 1, Col: 1, Offset: 0}
 
   Outer:
   for len(code) > 0 {
     // Trim whitespace from the start of the code
     codeLength := len(code)
     for i := 0; i < codeLength; i++ {
-      if code[0] == ' ' || code[0] == '\t' {
-        currentRow += 1
-        code = code[1:]
-      } else if code[0] == '\n' {
-        currentCol += 1
-        currentRow = 1
+      // Arguments to an invocation can also be separated by commas.
+      isSeparator := code[0] == ',' && stacks[len(stacks) - 1].Type == "INVOCATION"
+      if code[0] == ' ' || code[0] == '\t' || code[0] == '\n' || isSeparator {
+        current = current.Advance(string(code[:1]))
         code = code[1:]
       } else {
         break
@@ -476,38 +774,29 @@ func Tokenizer(input string) (*[]Node, error) {
       // fmt.Println("TRY TOKEN", token)
       if result := token.Match.FindStringSubmatch(string(code)); result != nil {
         // fmt.Println("MATCHED TOKEN", token)
+        // The position just after the token that matched.
+        end := current.Advance(result[0])
+
         // The token we looped over matched!
         if token.Type == SINGLE || token.Type == UNARY_OPERATOR {
           data, err := token.GetData(result)
           if err != nil {
-            return nil, err
-          }
-
-          // Add a right hand side value for every unary operator.
-          if token.Type == UNARY_OPERATOR {
-            data["RightHandSide"] = nil
+            return nil, tokenDataError(err, path, current)
           }
 
           // Single tokens are standalone - append token to the pointer that `children` points to.
-          *children = append(*children, Node{
-            Token: token.Name,
-            Row: currentRow,
-            Col: currentCol,
-            Data: data,
-            Children: nil,
-          })
+          *children = append(*children, newNode(token.Name, path, current, end, data, nil))
         } else if token.Type == BINARY_OPERATOR {
           // A binary operator takes one argument before it, and one argument after it.
 
-          // Verify there is an expression token before the operator.
+          // Verify there is a complete expression before the operator.
           if !(
             len(*children) > 0 &&
-            TokenNameIsExpression((*children)[len(*children) - 1].Token)) {
-            return nil, errors.New(fmt.Sprintf(
-              "Error: Attempted to parse a binary operator (%s), but there wasn't a valid expression before the operator on line %d:%d. Stop.",
+            NodeIsCompleteExpression((*children)[len(*children) - 1])) {
+            return nil, NewPositionError(SYNTAX_ERROR, path, current.Line, current.Col, fmt.Sprintf(
+              "Error: Attempted to parse a binary operator (%s), but there wasn't a valid expression before the operator on line %s. Stop.",
               result,
-              currentRow,
-              currentCol,
+              formatPosition(path, current.Line, current.Col),
             ))
           }
 
@@ -518,32 +807,19 @@ func Tokenizer(input string) (*[]Node, error) {
 
           data, err := token.GetData(result)
           if err != nil {
-            return nil, err
+            return nil, tokenDataError(err, path, current)
           }
-          data["LeftHandSide"] = leftHandSide
-          data["RightHandSide"] = nil
-
-          *children = append(*children, Node{
-            Token: token.Name,
-            Row: currentRow,
-            Col: currentCol,
-            Data: data,
-            Children: nil,
-          })
+
+          operator := newNode(token.Name, path, current, end, data, nil)
+          *children = append(*children, insertBinaryOperator(leftHandSide, operator))
         } else if token.Type == WRAPPER_START {
           data, err := token.GetData(result)
           if err != nil {
-            return nil, err
+            return nil, tokenDataError(err, path, current)
           }
 
           // Create the wrapper start token.
-          value := append(*children, Node{
-            Token: token.Name,
-            Row: currentRow,
-            Col: currentCol,
-            Data: data,
-            Children: &[]Node{},
-          })
+          value := append(*children, newNode(token.Name, path, current, end, data, &[]Node{}))
 
           // Add the new stack frame to the end of the slice that stores all stack frames.
           stacks = append(stacks, TokenizerFrame{
@@ -558,10 +834,9 @@ func Tokenizer(input string) (*[]Node, error) {
 
           // Ensure that a token of this type makes sense in this context.
           if len(stacks) < 2 {
-            return nil, errors.New(fmt.Sprintf(
-              "Error: Attempted to close a wrapper that was never opened on %d:%d. Stop.",
-              currentRow,
-              currentCol,
+            return nil, NewPositionError(SYNTAX_ERROR, path, current.Line, current.Col, fmt.Sprintf(
+              "Error: Attempted to close a wrapper that was never opened on %s. Stop.",
+              formatPosition(path, current.Line, current.Col),
             ))
           }
 
@@ -581,20 +856,18 @@ func Tokenizer(input string) (*[]Node, error) {
           }
 
           if lastToken == nil {
-            return nil, errors.New(fmt.Sprintf(
-              "Error: No such token found on %d:%d - %s. Stop.",
-              currentRow,
-              currentCol,
+            return nil, NewPositionError(INTERNAL_ERROR, path, current.Line, current.Col, fmt.Sprintf(
+              "Error: No such token found on %s - %s. Stop.",
+              formatPosition(path, current.Line, current.Col),
               lastTokenizerFrameNodes[0].Token,
             ))
           }
 
           typeShouldBe := lastToken.WrapperEndName
           if token.Name != typeShouldBe {
-            return nil, errors.New(fmt.Sprintf(
-              "Error: Attempted to close wrapper at %d:%d with a %s token, and not a %s token. Stop.",
-              currentRow,
-              currentCol,
+            return nil, NewPositionError(SYNTAX_ERROR, path, current.Line, current.Col, fmt.Sprintf(
+              "Error: Attempted to close wrapper at %s with a %s token, and not a %s token. Stop.",
+              formatPosition(path, current.Line, current.Col),
               token.Name,
               typeShouldBe,
             ))
@@ -604,6 +877,10 @@ func Tokenizer(input string) (*[]Node, error) {
           // node in the last stack frame)
           *lastNode.Children = *children
 
+          // The wrapper ends after the token that closed it.
+          opener := &lastTokenizerFrameNodes[len(lastTokenizerFrameNodes) - 1]
+          opener.EndLine, opener.EndCol, opener.EndOffset = end.Line, end.Col, end.Offset
+
           // Reassign children pointer back to its old value.
           *children = *(stacks[len(stacks) - 1].Nodes)
 
@@ -613,50 +890,53 @@ func Tokenizer(input string) (*[]Node, error) {
 
         // Run the pre-side-effect validation checks.
         if validator := PreSideEffectValidator(*children); validator != nil {
-          return nil, errors.New(fmt.Sprintf(
-            "Error: Validation Failed on %d:%d - %s. Stop.",
-            currentRow,
-            currentCol,
+          return nil, WrapCompileError(validator, VALIDATION_ERROR, fmt.Sprintf(
+            "Error: Validation Failed on %s - %s. Stop.",
+            formatPosition(validator.File, validator.StartLine, validator.StartCol),
             validator,
           ))
         }
 
         // Run any custom side effects
         if token.SideEffect != nil {
-          err := token.SideEffect(result, &stacks[len(stacks)-1])
+          err := token.SideEffect(result, &stacks[len(stacks)-1], resolver)
           if err != nil {
-            return nil, err
+            // Errors that don't already point somewhere in the source (ie, an import that couldn't
+            // be found) are reported at the token that caused them.
+            if compileErr, ok := err.(*CompileError); ok && compileErr.StartLine > 0 {
+              return nil, compileErr
+            }
+            located := WrapCompileError(err, IMPORT_ERROR, err.Error())
+            located.File = path
+            located.StartLine, located.StartCol = current.Line, current.Col
+            located.EndLine, located.EndCol = end.Line, end.Col
+            return nil, located
           }
         }
 
-        // If the token we just added to children is an expression, and the previous token is a
-        // unary or binary operator, add the token we just added in the right hand side of the
-        // previous token.
-        if len(*children) >= 2 && TokenNameIsExpression((*children)[len(*children)-1].Token) {
-          if rhs, ok := (*children)[len(*children) - 2].Data["RightHandSide"]; ok && rhs == nil {
+        // If the token we just added to children is an expression (or a `not`, which is the start of
+        // an expression), and the previous token is an operator that is missing its right hand side,
+        // add the token we just added as the missing right hand side.
+        if len(*children) >= 2 {
+          lastToken := (*children)[len(*children)-1].Token
+          if TokenNameIsExpression(lastToken) || lastToken == "OP_NOT" {
+            if nodeIsMissingOperand((*children)[len(*children) - 2]) {
 
-            // Get right hand side - the last toke in the list
-            childrenValue := *children
-            rightHandSide := childrenValue[len(*children) - 1]
+              // Get right hand side - the last toke in the list
+              childrenValue := *children
+              rightHandSide := childrenValue[len(*children) - 1]
 
-            // Get the operator - the second to last token in the list
-            operator := childrenValue[len(childrenValue) - 2]
+              // Get the operator - the second to last token in the list
+              operator := childrenValue[len(childrenValue) - 2]
 
-            *children = childrenValue[:len(childrenValue) - 2]
-
-            operator.Data["RightHandSide"] = rightHandSide
-            *children = append(*children, operator)
+              *children = childrenValue[:len(childrenValue) - 2]
+              *children = append(*children, fillMissingOperand(operator, rightHandSide))
+            }
           }
         }
 
-        // Add the correct amount of offset to the current row and column to account for this token.
-        for i := 0; i < len(result[0]); i++ {
-          currentRow += 1
-          if result[0][i] == '\n' {
-            currentCol += 1
-            currentRow = 0
-          }
-        }
+        // Move past the token.
+        current = end
 
         // Remove the token from the start of the input string we are looping over.
         code = code[len(result[0]):]
@@ -673,18 +953,16 @@ func Tokenizer(input string) (*[]Node, error) {
     if len(displayCode) > 30 {
       displayCode = displayCode[:30]
     }
-    return nil, errors.New(fmt.Sprintf(
-      "Error: No such token found at %d:%d - `%s`. Stop.",
-      currentRow,
-      currentCol,
+    return nil, NewPositionError(SYNTAX_ERROR, path, current.Line, current.Col, fmt.Sprintf(
+      "Error: No such token found at %s - `%s`. Stop.",
+      formatPosition(path, current.Line, current.Col),
       displayCode,
     ))
-    break
   }
 
   // Ensure that the stack is only 1 item long (the root element) before returning.
   if len(stacks) > 1 {
-    return nil, errors.New(fmt.Sprintf(
+    return nil, NewPositionError(SYNTAX_ERROR, path, current.Line, current.Col, fmt.Sprintf(
       "Error: Stack is not empty (%d extra) at end of program (are there more open parenthesis than closing ones?). Stop.",
       len(stacks) - 1,
     ))
@@ -692,10 +970,9 @@ func Tokenizer(input string) (*[]Node, error) {
 
   // Also, before returning, validate the final ast.
   if validator := Validator(*children); validator != nil {
-    return nil, errors.New(fmt.Sprintf(
-      "Error: Validation Failed on %d:%d - %s. Stop.",
-      currentRow,
-      currentCol,
+    return nil, WrapCompileError(validator, VALIDATION_ERROR, fmt.Sprintf(
+      "Error: Validation Failed on %s - %s. Stop.",
+      formatPosition(validator.File, validator.StartLine, validator.StartCol),
       validator,
     ))
   }
@@ -703,6 +980,16 @@ func Tokenizer(input string) (*[]Node, error) {
   return root, nil
 }
 
+// Report an error from reading the data of a token (ie, a literal that doesn't fit in its width) at
+// the token.
+func tokenDataError(err error, path string, at Position) *CompileError {
+  return NewPositionError(SYNTAX_ERROR, path, at.Line, at.Col, fmt.Sprintf(
+    "Error: %s, at %s. Stop.",
+    err,
+    formatPosition(path, at.Line, at.Col),
+  ))
+}
+
 // Similar to `regexp.MustCompile`, this function accepts input that must successfullt tokenize, and
 // if it doesn't, it panics.
 func MustTokenize(input string) *[]Node {
@@ -730,11 +1017,12 @@ func PrintAst(tokens *[]Node, indent int, prefix string) {
       PrintAst(token.Children, indent + 1, "")
     }
 
-    if value, ok := token.Data["LeftHandSide"].(Node); ok {
-      PrintAst(&[]Node{value}, indent + 1, "LHS")
+    leftHandSide, rightHandSide := token.Operands()
+    if leftHandSide != nil {
+      PrintAst(&[]Node{*leftHandSide}, indent + 1, "LHS")
     }
-    if value, ok := token.Data["RightHandSide"].(Node); ok {
-      PrintAst(&[]Node{value}, indent + 1, "RHS")
+    if rightHandSide != nil {
+      PrintAst(&[]Node{*rightHandSide}, indent + 1, "RHS")
     }
   }
 }
@@ -4,17 +4,47 @@ import (
   "testing"
   "fmt"
   "reflect"
+  "encoding/json"
 )
 
-var NONE map[string]interface{} = map[string]interface{}{}
+// Remove the offset and end of every node, so that tests can compare only the line and column
+// that each node starts on. Spans are tested separately in `TestSpans`.
+func stripSpans(nodes []Node) []Node {
+  stripped := []Node{}
+  for _, node := range nodes {
+    node.Offset, node.EndLine, node.EndCol, node.EndOffset = 0, 0, 0, 0
+
+    if node.Children != nil {
+      children := stripSpans(*node.Children)
+      node.Children = &children
+    }
+    switch data := node.Data.(type) {
+    case *BinaryExpr:
+      node.Data = &BinaryExpr{LeftHandSide: stripOperandSpans(data.LeftHandSide), RightHandSide: stripOperandSpans(data.RightHandSide)}
+    case *UnaryExpr:
+      node.Data = &UnaryExpr{RightHandSide: stripOperandSpans(data.RightHandSide)}
+    }
+
+    stripped = append(stripped, node)
+  }
+  return stripped
+}
+
+func stripOperandSpans(operand *Node) *Node {
+  if operand == nil {
+    return nil
+  }
+  stripped := stripSpans([]Node{*operand})[0]
+  return &stripped
+}
 
 func TestAnd(t *testing.T) {
   result, err := Tokenizer("1 and 0")
   if err != nil { t.Error(fmt.Sprintf("Error: %s", err.Error())) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_AND", Row: 3, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "BOOL", Row: 1, Col: 1, Data: map[string]interface{}{"Value": true}},
-      "RightHandSide": Node{Token: "BOOL", Row: 7, Col: 1, Data: map[string]interface{}{"Value": false}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 1, Data: &Bool{Value: true}},
+      RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 7, Data: &Bool{Value: false}},
     }},
   }) {
     t.Error("Fail!")
@@ -24,10 +54,10 @@ func TestAnd(t *testing.T) {
 func TestOr(t *testing.T) {
   result, err := Tokenizer("0 or 1")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_OR", Row: 3, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "BOOL", Row: 1, Col: 1, Data: map[string]interface{}{"Value": false}},
-      "RightHandSide": Node{Token: "BOOL", Row: 6, Col: 1, Data: map[string]interface{}{"Value": true}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_OR", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 1, Data: &Bool{Value: false}},
+      RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 6, Data: &Bool{Value: true}},
     }},
   }) {
     t.Error("Fail!")
@@ -37,23 +67,49 @@ func TestOr(t *testing.T) {
 func TestNot(t *testing.T) {
   result, err := Tokenizer("not 1")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_NOT", Row: 1, Col: 1, Data: map[string]interface{}{
-      "RightHandSide": Node{Token: "BOOL", Row: 5, Col: 1, Data: map[string]interface{}{"Value": true}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_NOT", Line: 1, Col: 1, Data: &UnaryExpr{
+      RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 5, Data: &Bool{Value: true}},
     }},
   }) {
     t.Error("Fail!")
   }
 }
 
+func TestXorNandNorXnor(t *testing.T) {
+  for token, operator := range map[string]string{"OP_XOR": "xor", "OP_NAND": "nand", "OP_NOR": "nor", "OP_XNOR": "xnor"} {
+    result, err := Tokenizer(fmt.Sprintf("a %s b", operator))
+    if err != nil { t.Error(fmt.Sprintf("Error: %s", err.Error())) }
+    if !reflect.DeepEqual(stripSpans(*result), []Node{
+      Node{Token: token, Line: 1, Col: 3, Data: &BinaryExpr{
+        LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 4 + len(operator), Data: &Identifier{Value: "b"}},
+      }},
+    }) {
+      t.Error(fmt.Sprintf("Fail on %s!", operator))
+    }
+  }
+}
+
+// Identifiers that start with an operator's name are still identifiers.
+func TestIdentifiersStartingWithOperatorNames(t *testing.T) {
+  result, err := Tokenizer("north")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "north"}},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
 func TestWhitespaceAtEnd(t *testing.T) {
   result, err := Tokenizer(`1 and 0
   `)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_AND", Row: 3, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "BOOL", Row: 1, Col: 1, Data: map[string]interface{}{"Value": true}},
-      "RightHandSide": Node{Token: "BOOL", Row: 7, Col: 1, Data: map[string]interface{}{"Value": false}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 1, Data: &Bool{Value: true}},
+      RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 7, Data: &Bool{Value: false}},
     }},
   }) {
     t.Error("Fail!")
@@ -67,7 +123,7 @@ func TestAndValidatorWithBooleans(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Attempted to parse a binary operator ([and]), but there wasn't a valid expression before the operator on line 7:1. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Attempted to parse a binary operator ([and]), but there wasn't a valid expression before the operator on line 1:7. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // 1 or or => error
@@ -77,7 +133,7 @@ func TestOrValidatorWithBooleans(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Attempted to parse a binary operator ([or]), but there wasn't a valid expression before the operator on line 6:1. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Attempted to parse a binary operator ([or]), but there wasn't a valid expression before the operator on line 1:6. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // 1 or => error
@@ -87,7 +143,7 @@ func TestOrValidatorWithNoRightHandSide(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 5:1 - Or operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:3 - Or operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // 1 and => error
@@ -97,25 +153,35 @@ func TestAndValidatorWithNoRightHandSide(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 6:1 - And operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:3 - And operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// 1 xor => error
+func TestXorValidatorWithNoRightHandSide(t *testing.T) {
+  _, err := Tokenizer("1 xor")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:3 - Xor operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // (1 or 0) and (0 or 1)
 func TestGroups(t *testing.T) {
   result, err := Tokenizer("(1 or 0) and (0 or 1)")
   if err != nil { t.Error("Error: "+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_AND", Row: 10, Col: 1, Data: map[string]interface{}{
-      "RightHandSide": Node{Token: "GROUP", Row: 14, Col: 1, Data: NONE, Children: &[]Node{
-        Node{Token: "OP_OR", Row: 17, Col: 1, Data: map[string]interface{}{
-          "LeftHandSide": Node{Token: "BOOL", Row: 15, Col: 1, Data: map[string]interface{}{"Value": false}},
-          "RightHandSide": Node{Token: "BOOL", Row: 20, Col: 1, Data: map[string]interface{}{"Value": true}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 10, Data: &BinaryExpr{
+      RightHandSide: &Node{Token: "GROUP", Line: 1, Col: 14, Children: &[]Node{
+        Node{Token: "OP_OR", Line: 1, Col: 17, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 15, Data: &Bool{Value: false}},
+          RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 20, Data: &Bool{Value: true}},
         }},
       }},
-      "LeftHandSide": Node{Token: "GROUP", Row: 1, Col: 1, Data: NONE, Children: &[]Node{
-        Node{Token: "OP_OR", Row: 4, Col: 1, Data: map[string]interface{}{
-          "LeftHandSide": Node{Token: "BOOL", Row: 2, Col: 1, Data: map[string]interface{}{"Value": true}},
-          "RightHandSide": Node{Token: "BOOL", Row: 7, Col: 1, Data: map[string]interface{}{"Value": false}},
+      LeftHandSide: &Node{Token: "GROUP", Line: 1, Col: 1, Children: &[]Node{
+        Node{Token: "OP_OR", Line: 1, Col: 4, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 2, Data: &Bool{Value: true}},
+          RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 7, Data: &Bool{Value: false}},
         }},
       }},
     }},
@@ -128,31 +194,31 @@ func TestGroups(t *testing.T) {
 func TestNestedGroups(t *testing.T) {
   result, err := Tokenizer("(1 or ((0 or 0) and 1)) and (0 or (1 and 0))")
   if err != nil { t.Error("Error: "+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_AND", Row: 25, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "GROUP", Row: 1, Col: 1, Data: NONE, Children: &[]Node{
-        Node{Token: "OP_OR", Row: 4, Col: 1, Data: map[string]interface{}{
-          "LeftHandSide": Node{Token: "BOOL", Row: 2, Col: 1, Data: map[string]interface{}{"Value": true}},
-          "RightHandSide": Node{Token: "GROUP", Row: 7, Col: 1, Data: NONE, Children: &[]Node{
-            Node{Token: "OP_AND", Row: 17, Col: 1, Data: map[string]interface{}{
-              "LeftHandSide": Node{Token: "GROUP", Row: 8, Col: 1, Data: NONE, Children: &[]Node{
-                Node{Token: "OP_OR", Row: 11, Col: 1, Data: map[string]interface{}{
-                  "LeftHandSide": Node{Token: "BOOL", Row: 9, Col: 1, Data: map[string]interface{}{"Value": false}},
-                  "RightHandSide": Node{Token: "BOOL", Row: 14, Col: 1, Data: map[string]interface{}{"Value": false}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 25, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "GROUP", Line: 1, Col: 1, Children: &[]Node{
+        Node{Token: "OP_OR", Line: 1, Col: 4, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 2, Data: &Bool{Value: true}},
+          RightHandSide: &Node{Token: "GROUP", Line: 1, Col: 7, Children: &[]Node{
+            Node{Token: "OP_AND", Line: 1, Col: 17, Data: &BinaryExpr{
+              LeftHandSide: &Node{Token: "GROUP", Line: 1, Col: 8, Children: &[]Node{
+                Node{Token: "OP_OR", Line: 1, Col: 11, Data: &BinaryExpr{
+                  LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 9, Data: &Bool{Value: false}},
+                  RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 14, Data: &Bool{Value: false}},
                 }},
               }},
-              "RightHandSide": Node{Token: "BOOL", Row: 21, Col: 1, Data: map[string]interface{}{"Value": true}},
+              RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 21, Data: &Bool{Value: true}},
             }},
           }},
         }},
       }},
-      "RightHandSide": Node{Token: "GROUP", Row: 29, Col: 1, Data: NONE, Children: &[]Node{
-        Node{Token: "OP_OR", Row: 32, Col: 1, Data: map[string]interface{}{
-          "LeftHandSide": Node{Token: "BOOL", Row: 30, Col: 1, Data: map[string]interface{}{"Value": false}},
-          "RightHandSide": Node{Token: "GROUP", Row: 35, Col: 1, Data: NONE, Children: &[]Node{
-            Node{Token: "OP_AND", Row: 38, Col: 1, Data: map[string]interface{}{
-              "LeftHandSide": Node{Token: "BOOL", Row: 36, Col: 1, Data: map[string]interface{}{"Value": true}},
-              "RightHandSide": Node{Token: "BOOL", Row: 42, Col: 1, Data: map[string]interface{}{"Value": false}},
+      RightHandSide: &Node{Token: "GROUP", Line: 1, Col: 29, Children: &[]Node{
+        Node{Token: "OP_OR", Line: 1, Col: 32, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 30, Data: &Bool{Value: false}},
+          RightHandSide: &Node{Token: "GROUP", Line: 1, Col: 35, Children: &[]Node{
+            Node{Token: "OP_AND", Line: 1, Col: 38, Data: &BinaryExpr{
+              LeftHandSide: &Node{Token: "BOOL", Line: 1, Col: 36, Data: &Bool{Value: true}},
+              RightHandSide: &Node{Token: "BOOL", Line: 1, Col: 42, Data: &Bool{Value: false}},
             }},
           }},
         }},
@@ -170,7 +236,7 @@ func TestGroupsWithTooManyClosingParens(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Attempted to close a wrapper that was never opened on 9:1. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Attempted to close a wrapper that was never opened on 1:9. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // (1 or 0) and (0
@@ -189,10 +255,10 @@ func TestGroupsWithTooManyOpenParens(t *testing.T) {
 func TestIdentifiersOr(t *testing.T) {
   result, err := Tokenizer("a or b")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "OP_OR", Row: 3, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "IDENTIFIER", Row: 1, Col: 1, Data: map[string]interface{}{"Value": "a"}},
-      "RightHandSide": Node{Token: "IDENTIFIER", Row: 6, Col: 1, Data: map[string]interface{}{"Value": "b"}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_OR", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 6, Data: &Identifier{Value: "b"}},
     }},
   }) {
     t.Error("Fail!")
@@ -206,7 +272,7 @@ func TestIdentifiersCannotBeAReservedWord(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 6:1 - Identifier let is a reserved word. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:6 - Identifier let is a reserved word. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // ASSIGNMENT
@@ -215,9 +281,9 @@ func TestIdentifiersCannotBeAReservedWord(t *testing.T) {
 func TestAssignment(t *testing.T) {
   result, err := Tokenizer("let a = 1")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "ASSIGNMENT", Row: 1, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-    Node{Token: "BOOL", Row: 9, Col: 1, Data: map[string]interface{}{"Value": true}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a"}},
+    Node{Token: "BOOL", Line: 1, Col: 9, Data: &Bool{Value: true}},
   }) {
     t.Error("Fail!")
   }
@@ -227,16 +293,16 @@ func TestAssignment(t *testing.T) {
 func TestAssignmentWithMultipleValues(t *testing.T) {
   result, err := Tokenizer("let a b = adder(1 0)")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "ASSIGNMENT", Row: 1, Col: 1, Data: map[string]interface{}{"Names": "a b", "Values": []Node{}}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a b"}},
     Node{
       Token: "INVOCATION",
-      Row: 11,
-      Col: 1,
-      Data: map[string]interface{}{"Name": "adder"},
+      Line: 1,
+      Col: 11,
+      Data: &Invocation{Name: "adder"},
       Children: &[]Node{
-        Node{Token: "BOOL", Row: 17, Col: 1, Data: map[string]interface{}{"Value": true}},
-        Node{Token: "BOOL", Row: 19, Col: 1, Data: map[string]interface{}{"Value": false}},
+        Node{Token: "BOOL", Line: 1, Col: 17, Data: &Bool{Value: true}},
+        Node{Token: "BOOL", Line: 1, Col: 19, Data: &Bool{Value: false}},
       },
     },
   }) {
@@ -248,15 +314,15 @@ func TestAssignmentWithMultipleValues(t *testing.T) {
 func TestAssignmentWithUngroupedMultipleValues(t *testing.T) {
   result, err := Tokenizer("let a b = c and d e and f")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "ASSIGNMENT", Row: 1, Col: 1, Data: map[string]interface{}{"Names": "a b", "Values": []Node{}}},
-    Node{Token: "OP_AND", Row: 13, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "IDENTIFIER", Row: 11, Col: 1, Data: map[string]interface{}{"Value": "c"}},
-      "RightHandSide": Node{Token: "IDENTIFIER", Row: 17, Col: 1, Data: map[string]interface{}{"Value": "d"}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a b"}},
+    Node{Token: "OP_AND", Line: 1, Col: 13, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 11, Data: &Identifier{Value: "c"}},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 17, Data: &Identifier{Value: "d"}},
     }},
-    Node{Token: "OP_AND", Row: 21, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "IDENTIFIER", Row: 19, Col: 1, Data: map[string]interface{}{"Value": "e"}},
-      "RightHandSide": Node{Token: "IDENTIFIER", Row: 25, Col: 1, Data: map[string]interface{}{"Value": "f"}},
+    Node{Token: "OP_AND", Line: 1, Col: 21, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 19, Data: &Identifier{Value: "e"}},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 25, Data: &Identifier{Value: "f"}},
     }},
   }) {
     t.Error("Fail!")
@@ -277,11 +343,11 @@ func TestAssignmentIdentifiersCannotBeAReservedWord(t *testing.T) {
 func TestAssignmentWithUnwrappedAndOperator(t *testing.T) {
   result, err := Tokenizer("let a = b and c")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "ASSIGNMENT", Row: 1, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-    Node{Token: "OP_AND", Row: 11, Col: 1, Data: map[string]interface{}{
-      "LeftHandSide": Node{Token: "IDENTIFIER", Row: 9, Col: 1, Data: map[string]interface{}{"Value": "b"}},
-      "RightHandSide": Node{Token: "IDENTIFIER", Row: 15, Col: 1, Data: map[string]interface{}{"Value": "c"}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a"}},
+    Node{Token: "OP_AND", Line: 1, Col: 11, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 9, Data: &Identifier{Value: "b"}},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 15, Data: &Identifier{Value: "c"}},
     }},
   }) {
     t.Error("Fail!")
@@ -292,10 +358,10 @@ func TestAssignmentWithUnwrappedAndOperator(t *testing.T) {
 func TestAssignmentWithUnwrappedNotOperator(t *testing.T) {
   result, err := Tokenizer("let a = not b")
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
-    Node{Token: "ASSIGNMENT", Row: 1, Col: 1, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-    Node{Token: "OP_NOT", Row: 9, Col: 1, Data: map[string]interface{}{
-      "RightHandSide": Node{Token: "IDENTIFIER", Row: 13, Col: 1, Data: map[string]interface{}{"Value": "b"}},
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a"}},
+    Node{Token: "OP_NOT", Line: 1, Col: 9, Data: &UnaryExpr{
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 13, Data: &Identifier{Value: "b"}},
     }},
   }) {
     t.Error("Fail!")
@@ -303,14 +369,203 @@ func TestAssignmentWithUnwrappedNotOperator(t *testing.T) {
 }
 
 // let a = not b and c
-// This is ambiguous - should it be not(a and b) or (not a) and b? - and should fail.
-func TestAssignmentWithUnwrappedAndOperatorAndNotOperatorShouldFail(t *testing.T) {
-  _, err := Tokenizer("let a = not b and c")
+// `not` binds more tightly than `and`, so this is (not b) and c.
+func TestAssignmentWithUnwrappedAndOperatorAndNotOperator(t *testing.T) {
+  result, err := Tokenizer("let a = not b and c")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a"}},
+    Node{Token: "OP_AND", Line: 1, Col: 15, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "OP_NOT", Line: 1, Col: 9, Data: &UnaryExpr{
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 13, Data: &Identifier{Value: "b"}},
+      }},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 19, Data: &Identifier{Value: "c"}},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// PRECEDENCE
+
+// a and b and c
+// Operators with the same precedence are grouped from left to right, so this is (a and b) and c.
+func TestChainedOperatorsAreLeftAssociative(t *testing.T) {
+  result, err := Tokenizer("a and b and c")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_AND", Line: 1, Col: 9, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+        LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 7, Data: &Identifier{Value: "b"}},
+      }},
+      RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 13, Data: &Identifier{Value: "c"}},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// a or b and c
+// `and` binds more tightly than `or`, so this is a or (b and c).
+func TestAndBindsMoreTightlyThanOr(t *testing.T) {
+  result, err := Tokenizer("a or b and c")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_OR", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+      RightHandSide: &Node{Token: "OP_AND", Line: 1, Col: 8, Data: &BinaryExpr{
+        LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 6, Data: &Identifier{Value: "b"}},
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 12, Data: &Identifier{Value: "c"}},
+      }},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// a and b and c or not d
+// This is ((a and b) and c) or (not d).
+func TestOperatorPrecedence(t *testing.T) {
+  result, err := Tokenizer("a and b and c or not d")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_OR", Line: 1, Col: 15, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "OP_AND", Line: 1, Col: 9, Data: &BinaryExpr{
+        LeftHandSide: &Node{Token: "OP_AND", Line: 1, Col: 3, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+          RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 7, Data: &Identifier{Value: "b"}},
+        }},
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 13, Data: &Identifier{Value: "c"}},
+      }},
+      RightHandSide: &Node{Token: "OP_NOT", Line: 1, Col: 18, Data: &UnaryExpr{
+        RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 22, Data: &Identifier{Value: "d"}},
+      }},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// a or b xor c and d
+// This is a or (b xor (c and d)).
+func TestXorPrecedence(t *testing.T) {
+  result, err := Tokenizer("a or b xor c and d")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "OP_OR", Line: 1, Col: 3, Data: &BinaryExpr{
+      LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 1, Data: &Identifier{Value: "a"}},
+      RightHandSide: &Node{Token: "OP_XOR", Line: 1, Col: 8, Data: &BinaryExpr{
+        LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 6, Data: &Identifier{Value: "b"}},
+        RightHandSide: &Node{Token: "OP_AND", Line: 1, Col: 14, Data: &BinaryExpr{
+          LeftHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 12, Data: &Identifier{Value: "c"}},
+          RightHandSide: &Node{Token: "IDENTIFIER", Line: 1, Col: 18, Data: &Identifier{Value: "d"}},
+        }},
+      }},
+    }},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// Groups are still an expression on their own, so operators within them aren't regrouped.
+func TestPrecedenceWithGroups(t *testing.T) {
+  result, err := Tokenizer("(a or b) and c")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if len(*result) != 1 || (*result)[0].Token != "OP_AND" {
+    t.Error("Fail!")
+    return
+  }
+  if lhs, _ := (*result)[0].Operands(); lhs.Token != "GROUP" {
+    t.Errorf("Left hand side should be a group, is %s", lhs.Token)
+  }
+}
+
+// Each operator ends at the end of its right hand side, even when the right hand side was found
+// after other operators.
+func TestPrecedenceSpans(t *testing.T) {
+  result, err := Tokenizer("a or b and c")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  or := (*result)[0]
+  _, and := or.Operands()
+  if or.EndOffset != 12 || and.Offset != 7 || and.EndOffset != 12 {
+    t.Errorf("Wrong spans: or ends at %d, and spans %d-%d", or.EndOffset, and.Offset, and.EndOffset)
+  }
+}
+
+// a or b and => error
+func TestChainedOperatorWithNoRightHandSide(t *testing.T) {
+  _, err := Tokenizer("a or b and")
   if err == nil {
-    t.Error("Error was not returned!")
+    t.Error("err was nil!")
     return
   }
-  if err.Error() != "Error: Attempted to parse a binary operator ([and]), but there wasn't a valid expression before the operator on line 15:1. Stop." { t.Error("Incorrect error returned!") }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:8 - And operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// led(a and) => error
+func TestOperatorWithNoRightHandSideInInvocation(t *testing.T) {
+  _, err := Tokenizer("led(a and)")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:7 - And operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// led(not) => error
+func TestNotWithNoRightHandSideInInvocation(t *testing.T) {
+  _, err := Tokenizer("led(not)")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:5 - Not operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// let x = a or => error
+func TestAssignmentWithNoRightHandSide(t *testing.T) {
+  _, err := Tokenizer("let x = a or")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:11 - Or operator right hand side is not a node. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// BUSES
+
+// let a[4] = b c[0:3]
+func TestBuses(t *testing.T) {
+  result, err := Tokenizer("let a[4] = b[2] c[0:3]")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "ASSIGNMENT", Line: 1, Col: 1, Data: &Assignment{Names: "a[4]"}},
+    Node{Token: "BUS_INDEX", Line: 1, Col: 12, Data: &BusIndex{Name: "b", Start: 2, End: 3}},
+    Node{Token: "BUS_INDEX", Line: 1, Col: 17, Data: &BusIndex{Name: "c", Start: 0, End: 3}},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// a[2:1] => error
+func TestBusSliceThatEndsBeforeItStarts(t *testing.T) {
+  _, err := Tokenizer("a[2:1]")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Slice a[2:1] must end after it starts, at 1:1. Stop.") { t.Error("Error: "+err.Error()) }
+}
+
+// let[2] = 1 0 => error
+func TestBusCannotBeAReservedWord(t *testing.T) {
+  _, err := Tokenizer("led(block[0])")
+  if err == nil {
+    t.Error("err was nil!")
+    return
+  }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 1:5 - Identifier block is a reserved word. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 // BLOCKS
@@ -319,15 +574,15 @@ func TestBlock(t *testing.T) {
     let a = 1
   }`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "BLOCK",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "a", "Params": "b c d", "OutputQuantity": 0, "InputQuantity": 3},
+      Data: &BlockDecl{Name: "a", Params: "b c d", Buses: map[string]int{}, OutputQuantity: 0, InputQuantity: 3},
       Children: &[]Node{
-        Node{Token: "ASSIGNMENT", Row: 5, Col: 2, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-        Node{Token: "BOOL", Row: 13, Col: 2, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "ASSIGNMENT", Line: 2, Col: 5, Data: &Assignment{Names: "a"}},
+        Node{Token: "BOOL", Line: 2, Col: 13, Data: &Bool{Value: true}},
       },
     },
   }) {
@@ -340,15 +595,15 @@ func TestBlockWithoutInputParameters(t *testing.T) {
     let a = 1
   }`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "BLOCK",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "a", "Params": "", "OutputQuantity": 0, "InputQuantity": 0},
+      Data: &BlockDecl{Name: "a", Params: "", Buses: map[string]int{}, OutputQuantity: 0, InputQuantity: 0},
       Children: &[]Node{
-        Node{Token: "ASSIGNMENT", Row: 5, Col: 2, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-        Node{Token: "BOOL", Row: 13, Col: 2, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "ASSIGNMENT", Line: 2, Col: 5, Data: &Assignment{Names: "a"}},
+        Node{Token: "BOOL", Line: 2, Col: 13, Data: &Bool{Value: true}},
       },
     },
   }) {
@@ -362,28 +617,28 @@ func TestBlockWithReturn(t *testing.T) {
     return (e and (c or d))
   }`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "BLOCK",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "a", "Params": "b c d", "OutputQuantity": 1, "InputQuantity": 3},
+      Data: &BlockDecl{Name: "a", Params: "b c d", Buses: map[string]int{}, OutputQuantity: 1, InputQuantity: 3},
       Children: &[]Node{
-        Node{Token: "ASSIGNMENT", Row: 5, Col: 2, Data: map[string]interface{}{"Names": "e", "Values": []Node{}}},
-        Node{Token: "GROUP", Row: 13, Col: 2, Data: NONE, Children: &[]Node{
-          Node{Token: "OP_AND", Row: 16, Col: 2, Data: map[string]interface{}{
-            "LeftHandSide": Node{Token: "IDENTIFIER", Row: 14, Col: 2, Data: map[string]interface{}{"Value": "b"}},
-            "RightHandSide": Node{Token: "IDENTIFIER", Row: 20, Col: 2, Data: map[string]interface{}{"Value": "c"}},
+        Node{Token: "ASSIGNMENT", Line: 2, Col: 5, Data: &Assignment{Names: "e"}},
+        Node{Token: "GROUP", Line: 2, Col: 13, Children: &[]Node{
+          Node{Token: "OP_AND", Line: 2, Col: 16, Data: &BinaryExpr{
+            LeftHandSide: &Node{Token: "IDENTIFIER", Line: 2, Col: 14, Data: &Identifier{Value: "b"}},
+            RightHandSide: &Node{Token: "IDENTIFIER", Line: 2, Col: 20, Data: &Identifier{Value: "c"}},
           }},
         }},
-        Node{Token: "BLOCK_RETURN", Row: 5, Col: 3, Data: NONE},
-        Node{Token: "GROUP", Row: 12, Col: 3, Data: NONE, Children: &[]Node{
-          Node{Token: "OP_AND", Row: 15, Col: 3, Data: map[string]interface{}{
-            "LeftHandSide": Node{Token: "IDENTIFIER", Row: 13, Col: 3, Data: map[string]interface{}{"Value": "e"}},
-            "RightHandSide": Node{Token: "GROUP", Row: 19, Col: 3, Data: NONE, Children: &[]Node{
-              Node{Token: "OP_OR", Row: 22, Col: 3, Data: map[string]interface{}{
-                "LeftHandSide": Node{Token: "IDENTIFIER", Row: 20, Col: 3, Data: map[string]interface{}{"Value": "c"}},
-                "RightHandSide": Node{Token: "IDENTIFIER", Row: 25, Col: 3, Data: map[string]interface{}{"Value": "d"}},
+        Node{Token: "BLOCK_RETURN", Line: 3, Col: 5},
+        Node{Token: "GROUP", Line: 3, Col: 12, Children: &[]Node{
+          Node{Token: "OP_AND", Line: 3, Col: 15, Data: &BinaryExpr{
+            LeftHandSide: &Node{Token: "IDENTIFIER", Line: 3, Col: 13, Data: &Identifier{Value: "e"}},
+            RightHandSide: &Node{Token: "GROUP", Line: 3, Col: 19, Children: &[]Node{
+              Node{Token: "OP_OR", Line: 3, Col: 22, Data: &BinaryExpr{
+                LeftHandSide: &Node{Token: "IDENTIFIER", Line: 3, Col: 20, Data: &Identifier{Value: "c"}},
+                RightHandSide: &Node{Token: "IDENTIFIER", Line: 3, Col: 25, Data: &Identifier{Value: "d"}},
               }},
             }},
           }},
@@ -402,16 +657,16 @@ func TestBlockReturningMultipleValues(t *testing.T) {
       a
   }`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "BLOCK",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "a", "Params": "b c d", "OutputQuantity": 2, "InputQuantity": 3},
+      Data: &BlockDecl{Name: "a", Params: "b c d", Buses: map[string]int{}, OutputQuantity: 2, InputQuantity: 3},
       Children: &[]Node{
-        Node{Token: "BLOCK_RETURN", Row: 5, Col: 2, Data: NONE},
-        Node{Token: "BOOL", Row: 7, Col: 3, Data: map[string]interface{}{"Value": true}},
-        Node{Token: "IDENTIFIER", Row: 7, Col: 4, Data: map[string]interface{}{"Value": "a"}},
+        Node{Token: "BLOCK_RETURN", Line: 2, Col: 5},
+        Node{Token: "BOOL", Line: 3, Col: 7, Data: &Bool{Value: true}},
+        Node{Token: "IDENTIFIER", Line: 4, Col: 7, Data: &Identifier{Value: "a"}},
       },
     },
   }) {
@@ -428,7 +683,7 @@ func TestBlockReturnCannotHaveNonExpressionTokens(t *testing.T) {
     t.Error("err was nil!")
     return
   }
-  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 5:3 - Non-expression token ASSIGNMENT found after return. Stop.") { t.Error("Error: "+err.Error()) }
+  if !reflect.DeepEqual(err.Error(), "Error: Validation Failed on 3:5 - Non-expression token ASSIGNMENT found after return. Stop.") { t.Error("Error: "+err.Error()) }
 }
 
 func TestBlockWithParameterExpansion(t *testing.T) {
@@ -436,15 +691,15 @@ func TestBlockWithParameterExpansion(t *testing.T) {
     let a = 1
   }`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "BLOCK",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "a", "Params": "b0 b1", "OutputQuantity": 0, "InputQuantity": 2},
+      Data: &BlockDecl{Name: "a", Params: "b0 b1", Buses: map[string]int{"b": 2}, OutputQuantity: 0, InputQuantity: 2},
       Children: &[]Node{
-        Node{Token: "ASSIGNMENT", Row: 5, Col: 2, Data: map[string]interface{}{"Names": "a", "Values": []Node{}}},
-        Node{Token: "BOOL", Row: 13, Col: 2, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "ASSIGNMENT", Line: 2, Col: 5, Data: &Assignment{Names: "a"}},
+        Node{Token: "BOOL", Line: 2, Col: 13, Data: &Bool{Value: true}},
       },
     },
   }) {
@@ -456,16 +711,16 @@ func TestBlockWithParameterExpansion(t *testing.T) {
 func TestInvocation(t *testing.T) {
   result, err := Tokenizer(`foo(a b 1)`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "INVOCATION",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
-        Node{Token: "IDENTIFIER", Row: 5, Col: 1, Data: map[string]interface{}{"Value": "a"}},
-        Node{Token: "IDENTIFIER", Row: 7, Col: 1, Data: map[string]interface{}{"Value": "b"}},
-        Node{Token: "BOOL", Row: 9, Col: 1, Data: map[string]interface{}{"Value": true}},
+        Node{Token: "IDENTIFIER", Line: 1, Col: 5, Data: &Identifier{Value: "a"}},
+        Node{Token: "IDENTIFIER", Line: 1, Col: 7, Data: &Identifier{Value: "b"}},
+        Node{Token: "BOOL", Line: 1, Col: 9, Data: &Bool{Value: true}},
       },
     },
   }) {
@@ -475,12 +730,12 @@ func TestInvocation(t *testing.T) {
 func TestInvocationNoParams(t *testing.T) {
   result, err := Tokenizer(`foo()`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "INVOCATION",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{},
     },
   }) {
@@ -490,21 +745,21 @@ func TestInvocationNoParams(t *testing.T) {
 func TestInvocationWithinInvocation(t *testing.T) {
   result, err := Tokenizer(`foo(bar(a 1))`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "INVOCATION",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
         Node{
           Token: "INVOCATION",
-          Row: 5,
-          Col: 1,
-          Data: map[string]interface{}{"Name": "bar"},
+          Line: 1,
+          Col: 5,
+          Data: &Invocation{Name: "bar"},
           Children: &[]Node{
-            Node{Token: "IDENTIFIER", Row: 9, Col: 1, Data: map[string]interface{}{"Value": "a"}},
-            Node{Token: "BOOL", Row: 11, Col: 1, Data: map[string]interface{}{"Value": true}},
+            Node{Token: "IDENTIFIER", Line: 1, Col: 9, Data: &Identifier{Value: "a"}},
+            Node{Token: "BOOL", Line: 1, Col: 11, Data: &Bool{Value: true}},
           },
         },
       },
@@ -516,24 +771,24 @@ func TestInvocationWithinInvocation(t *testing.T) {
 func TestInvocationWithinInvocationWithArgsAfterward(t *testing.T) {
   result, err := Tokenizer(`foo(bar(a 1) 0)`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "INVOCATION",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Name": "foo"},
+      Data: &Invocation{Name: "foo"},
       Children: &[]Node{
         Node{
           Token: "INVOCATION",
-          Row: 5,
-          Col: 1,
-          Data: map[string]interface{}{"Name": "bar"},
+          Line: 1,
+          Col: 5,
+          Data: &Invocation{Name: "bar"},
           Children: &[]Node{
-            Node{Token: "IDENTIFIER", Row: 9, Col: 1, Data: map[string]interface{}{"Value": "a"}},
-            Node{Token: "BOOL", Row: 11, Col: 1, Data: map[string]interface{}{"Value": true}},
+            Node{Token: "IDENTIFIER", Line: 1, Col: 9, Data: &Identifier{Value: "a"}},
+            Node{Token: "BOOL", Line: 1, Col: 11, Data: &Bool{Value: true}},
           },
         },
-        Node{Token: "BOOL", Row: 14, Col: 1, Data: map[string]interface{}{"Value": false}},
+        Node{Token: "BOOL", Line: 1, Col: 14, Data: &Bool{Value: false}},
       },
     },
   }) {
@@ -545,12 +800,12 @@ func TestInvocationWithinInvocationWithArgsAfterward(t *testing.T) {
 func TestSingleLineComment(t *testing.T) {
   result, err := Tokenizer(`// I am a comment`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "SINGLE_COMMENT",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Message": "I am a comment"},
+      Data: &Comment{Message: "I am a comment"},
     },
   }) {
     t.Error("Fail!")
@@ -561,12 +816,12 @@ func TestMultiLineComment(t *testing.T) {
   result, err := Tokenizer(`/* I am a multiline
 comment */`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "MULTI_COMMENT",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Message": "I am a multiline\ncomment"},
+      Data: &Comment{Message: "I am a multiline\ncomment"},
     },
   }) {
     t.Error("Fail!")
@@ -576,14 +831,147 @@ comment */`)
 func TestMultiLineCommentSingleLine(t *testing.T) {
   result, err := Tokenizer(`/* I am a multiline comment but only on one line*/`)
   if err != nil { t.Error("Error:"+err.Error()) }
-  if !reflect.DeepEqual(*result, []Node{
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
     Node{
       Token: "MULTI_COMMENT",
-      Row: 1,
+      Line: 1,
       Col: 1,
-      Data: map[string]interface{}{"Message": "I am a multiline comment but only on one line"},
+      Data: &Comment{Message: "I am a multiline comment but only on one line"},
     },
   }) {
     t.Error("Fail!")
   }
 }
+
+func TestIntegers(t *testing.T) {
+  result, err := Tokenizer(`wave(a 12 1)`)
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{
+      Token: "INVOCATION",
+      Line: 1,
+      Col: 1,
+      Data: &Invocation{Name: "wave"},
+      Children: &[]Node{
+        Node{Token: "IDENTIFIER", Line: 1, Col: 6, Data: &Identifier{Value: "a"}},
+        Node{Token: "INTEGER", Line: 1, Col: 8, Data: &Integer{Value: 12}},
+        Node{Token: "BOOL", Line: 1, Col: 11, Data: &Bool{Value: true}},
+      },
+    },
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// Every node knows where it starts and ends, including nodes that come after tokens that span
+// multiple lines.
+func TestSpans(t *testing.T) {
+  result, err := Tokenizer("/* x\ny */ foo(1\n  and 0)")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(*result, []Node{
+    Node{
+      Token: "MULTI_COMMENT",
+      Line: 1, Col: 1, Offset: 0,
+      EndLine: 2, EndCol: 5, EndOffset: 9,
+      Data: &Comment{Message: "x\ny"},
+    },
+    Node{
+      Token: "INVOCATION",
+      Line: 2, Col: 6, Offset: 10,
+      EndLine: 3, EndCol: 9, EndOffset: 24,
+      Data: &Invocation{Name: "foo"},
+      Children: &[]Node{
+        Node{
+          Token: "OP_AND",
+          Line: 3, Col: 3, Offset: 18,
+          EndLine: 3, EndCol: 8, EndOffset: 23,
+          Data: &BinaryExpr{
+            LeftHandSide: &Node{
+              Token: "BOOL",
+              Line: 2, Col: 10, Offset: 14,
+              EndLine: 2, EndCol: 11, EndOffset: 15,
+              Data: &Bool{Value: true},
+            },
+            RightHandSide: &Node{
+              Token: "BOOL",
+              Line: 3, Col: 7, Offset: 22,
+              EndLine: 3, EndCol: 8, EndOffset: 23,
+              Data: &Bool{Value: false},
+            },
+          },
+        },
+      },
+    },
+  }) {
+    t.Errorf("Fail! %+v", *result)
+  }
+}
+
+// LITERALS
+
+// 4'b0011 4'd3 8'hF0 => bits, least significant first
+func TestLiterals(t *testing.T) {
+  result, err := Tokenizer("4'b0011 4'd3 8'hF0")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "LITERAL", Line: 1, Col: 1, Data: &Literal{Width: 4, Bits: []bool{true, true, false, false}}},
+    Node{Token: "LITERAL", Line: 1, Col: 9, Data: &Literal{Width: 4, Bits: []bool{true, true, false, false}}},
+    Node{Token: "LITERAL", Line: 1, Col: 14, Data: &Literal{Width: 8, Bits: []bool{false, false, false, false, true, true, true, true}}},
+  }) {
+    t.Error("Fail!")
+  }
+}
+
+// 2'd7 => error
+func TestLiteralErrors(t *testing.T) {
+  for source, expected := range map[string]string{
+    "2'd7": "Error: Literal 2'd7 doesn't fit in 2 bits, at 1:1. Stop.",
+    "4'b0201": "Error: Literal 4'b0201 contains digits that aren't valid in its base, at 1:1. Stop.",
+    "0'b0": "Error: Literal 0'b0 must be at least one bit wide, at 1:1. Stop.",
+    "led(1)\nlet a = 4'hFF": "Error: Literal 4'hFF doesn't fit in 4 bits, at 2:9. Stop.",
+    "100000000'b0": "Error: Literal 100000000'b0 is wider than 4096 bits, at 1:1. Stop.",
+  } {
+    _, err := Tokenizer(source)
+    if err == nil {
+      t.Errorf("err was nil for %s!", source)
+      continue
+    }
+    if !reflect.DeepEqual(err.Error(), expected) { t.Error("Error: "+err.Error()) }
+  }
+}
+
+// block counter(clock reset = 0) {} counter(clock: a, reset: 1)
+func TestNamedArgumentsAndDefaults(t *testing.T) {
+  result, err := Tokenizer("block counter(clock reset = 0) {}\ncounter(clock: a, reset: 1)")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  if !reflect.DeepEqual(stripSpans(*result), []Node{
+    Node{Token: "BLOCK", Line: 1, Col: 1, Data: &BlockDecl{
+      Name: "counter",
+      Params: "clock reset",
+      Buses: map[string]int{},
+      Defaults: map[string][]bool{"reset": []bool{false}},
+      InputQuantity: 2,
+      OutputQuantity: 0,
+    }, Children: &[]Node{}},
+    Node{Token: "INVOCATION", Line: 2, Col: 1, Data: &Invocation{Name: "counter"}, Children: &[]Node{
+      Node{Token: "ARGUMENT_NAME", Line: 2, Col: 9, Data: &ArgumentName{Name: "clock"}},
+      Node{Token: "IDENTIFIER", Line: 2, Col: 16, Data: &Identifier{Value: "a"}},
+      Node{Token: "ARGUMENT_NAME", Line: 2, Col: 19, Data: &ArgumentName{Name: "reset"}},
+      Node{Token: "BOOL", Line: 2, Col: 26, Data: &Bool{Value: true}},
+    }},
+  }) {
+    t.Error(fmt.Sprintf("Fail! %+v", stripSpans(*result)))
+  }
+}
+
+// The json that `lovel tokenize --json` prints is read by other tools, so its shape shouldn't change.
+func TestJsonEncoding(t *testing.T) {
+  result, err := Tokenizer("not a[1]")
+  if err != nil { t.Error("Error:"+err.Error()) }
+  serialized, err := json.Marshal(result)
+  if err != nil { t.Error("Error:"+err.Error()) }
+  expected := `[{"Token":"OP_NOT","Data":{"RightHandSide":{"Token":"BUS_INDEX","Data":{"Name":"a","Start":1,"End":2},"Line":1,"Col":5,"Offset":4,"EndLine":1,"EndCol":9,"EndOffset":8}},"Line":1,"Col":1,"Offset":0,"EndLine":1,"EndCol":9,"EndOffset":8}]`
+  if string(serialized) != expected {
+    t.Errorf("Fail! %s", serialized)
+  }
+}
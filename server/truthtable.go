@@ -0,0 +1,108 @@
+package main
+
+import (
+  "bytes"
+  "encoding/csv"
+  "errors"
+  "fmt"
+  "strings"
+)
+
+// The most inputs that a block can have for its truth table to be printed. Each input doubles the
+// number of rows, so 16 inputs is already 65536 rows.
+const MAX_TRUTH_TABLE_INPUTS = 16
+
+// The outputs of a block for every combination of its inputs.
+type TruthTable struct {
+  Inputs []string
+  Outputs []string
+  Rows []TruthTableRow
+}
+
+type TruthTableRow struct {
+  Inputs []bool
+  Outputs []bool
+}
+
+// Run the block with every combination of its inputs. Rows are in counting order, where the first
+// input changes the least often, like the truth tables in the docs. Blocks with state (ie, flip
+// flops) keep it from one row to the next.
+func (h *BlockHarness) TruthTable() (*TruthTable, error) {
+  if len(h.Inputs) > MAX_TRUTH_TABLE_INPUTS {
+    return nil, errors.New(fmt.Sprintf(
+      "%s has %d inputs, so its truth table would have %d rows. Truth tables can only be made for blocks with up to %d inputs. Stop.",
+      h.Name,
+      len(h.Inputs),
+      uint64(1) << uint(len(h.Inputs)),
+      MAX_TRUTH_TABLE_INPUTS,
+    ))
+  }
+
+  table := &TruthTable{Inputs: h.Inputs, Outputs: h.Outputs}
+  for combination := 0; combination < 1 << uint(len(h.Inputs)); combination++ {
+    inputs := make([]bool, len(h.Inputs))
+    for index := range inputs {
+      inputs[index] = combination & (1 << uint(len(inputs) - 1 - index)) != 0
+    }
+
+    outputs, err := h.Evaluate(inputs)
+    if err != nil {
+      return nil, errors.New(fmt.Sprintf("%s, when its inputs are %s. Stop.", err, formatStates(inputs)))
+    }
+    table.Rows = append(table.Rows, TruthTableRow{Inputs: inputs, Outputs: outputs})
+  }
+  return table, nil
+}
+
+// Format the table in markdown, in the same style as the truth tables in the docs.
+func (t *TruthTable) Markdown() string {
+  columns := append(append([]string{}, t.Inputs...), t.Outputs...)
+
+  var out bytes.Buffer
+  out.WriteString("|")
+  for _, column := range columns {
+    out.WriteString(fmt.Sprintf(" %s |", column))
+  }
+  out.WriteString("\n|")
+  for _, column := range columns {
+    out.WriteString(strings.Repeat("-", len(column) + 2) + "|")
+  }
+  out.WriteString("\n")
+
+  for _, row := range t.Rows {
+    out.WriteString("|")
+    for _, state := range append(append([]bool{}, row.Inputs...), row.Outputs...) {
+      out.WriteString(fmt.Sprintf(" `%s` |", formatStates([]bool{state})))
+    }
+    out.WriteString("\n")
+  }
+  return out.String()
+}
+
+// Format the table as comma seperated values, with a header row of the name of each column.
+func (t *TruthTable) CSV() string {
+  var out bytes.Buffer
+  writer := csv.NewWriter(&out)
+  writer.Write(append(append([]string{}, t.Inputs...), t.Outputs...))
+  for _, row := range t.Rows {
+    record := []string{}
+    for _, state := range append(append([]bool{}, row.Inputs...), row.Outputs...) {
+      record = append(record, formatStates([]bool{state}))
+    }
+    writer.Write(record)
+  }
+  writer.Flush()
+  return out.String()
+}
+
+// Format the table as markdown or csv.
+func (t *TruthTable) Format(format string) (string, error) {
+  switch format {
+  case "markdown", "md":
+    return t.Markdown(), nil
+  case "csv":
+    return t.CSV(), nil
+  default:
+    return "", errors.New(fmt.Sprintf("No such truth table format %s, expected markdown or csv. Stop.", format))
+  }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+  "testing"
+  "strings"
+)
+
+func TestTruthTable(t *testing.T) {
+  harness, err := NewCompiler().HarnessString("import adder", "halfadder")
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  table, err := harness.TruthTable()
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+
+  markdown := strings.Join([]string{
+    "| a | b | sum | carry |",
+    "|---|---|-----|-------|",
+    "| `0` | `0` | `0` | `0` |",
+    "| `0` | `1` | `1` | `0` |",
+    "| `1` | `0` | `1` | `0` |",
+    "| `1` | `1` | `0` | `1` |",
+    "",
+  }, "\n")
+  if table.Markdown() != markdown {
+    t.Errorf("Markdown doesn't match! %s", table.Markdown())
+  }
+
+  csv := "a,b,sum,carry\n0,0,0,0\n0,1,1,0\n1,0,1,0\n1,1,0,1\n"
+  if table.CSV() != csv {
+    t.Errorf("CSV doesn't match! %s", table.CSV())
+  }
+
+  if _, err := table.Format("html"); err == nil {
+    t.Error("Expected an error for an unknown format")
+  }
+}
+
+// Outputs that aren't returned as variables are numbered.
+func TestTruthTableOutputNames(t *testing.T) {
+  harness, err := NewCompiler().HarnessString("block nand2(a b) {\n  return not (a and b)\n}", "nand2")
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  table, err := harness.TruthTable()
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  if table.CSV() != "a,b,out0\n0,0,1\n0,1,1\n1,0,1\n1,1,0\n" {
+    t.Errorf("CSV doesn't match! %s", table.CSV())
+  }
+}
+
+func TestTruthTableWithTooManyInputs(t *testing.T) {
+  harness, err := NewCompiler().HarnessString("block wide(a[17]) {\n  return a[0]\n}", "wide")
+  if err != nil {
+    t.Error("Error: "+err.Error())
+    return
+  }
+  _, err = harness.TruthTable()
+  if err == nil || !strings.Contains(err.Error(), "wide has 17 inputs, so its truth table would have 131072 rows") {
+    t.Errorf("Expected an error about the number of inputs, found %v", err)
+  }
+}
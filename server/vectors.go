@@ -0,0 +1,151 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "strings"
+)
+
+// Tests list rows of inputs and the outputs that they're expected to produce:
+//
+//   test "halfadder truth table" halfadder {
+//     0 0 -> 0 0
+//     0 1 -> 1 0
+//     1 0 -> 1 0
+//     1 1 -> 0 1
+//   }
+//
+// Each row lists a state for each input of the block, in the order of its parameters (the wires of a
+// bus parameter are listed from index 0), and then a state for each output. The states of many
+// wires can be written together (ie, `01` is the same as `0 1`), a bus can be given a value with a
+// literal like `4'd3`, and an output that doesn't matter can be written as `x`.
+
+// Matches a value within a row, which is a state for each of a number of wires.
+var MATCH_VECTOR_STATES *regexp.Regexp = regexp.MustCompile(`^[01xX_]+$`)
+
+// A row of a test, like `0 1 -> 1 0`. The inputs and outputs have a character for the state of
+// each wire, which is `0`, `1`, or `x` if the state doesn't matter.
+type Vector struct {
+  Inputs string
+  Outputs string
+
+  // Where the row starts, relative to the start of the token that contains it. The column is
+  // relative to the column of the token when the row is on the same line as the token.
+  Line int
+  Col int
+}
+
+// Where the row starts within the source, given the node that contains it.
+func (v Vector) Position(container Node) (int, int) {
+  if v.Line == 0 {
+    return container.Line, container.Col + v.Col - 1
+  }
+  return container.Line + v.Line, v.Col
+}
+
+// Parse the rows within the body of a test. `prefix` is the source of the token before the body,
+// which is used to find where each row starts.
+func parseVectors(prefix string, body string) ([]Vector, error) {
+  return parseRows(prefix, body, false)
+}
+
+// Parse rows of inputs and outputs. The inputs of a row can only contain x if `inputDontCares` is
+// set, which is used by tables, where a row like `1x -> 1` stands for both `10 -> 1` and `11 -> 1`.
+func parseRows(prefix string, body string, inputDontCares bool) ([]Vector, error) {
+  vectors := []Vector{}
+  position := Position{Line: 0, Col: 1}.Advance(prefix)
+
+  for _, line := range strings.SplitAfter(body, "\n") {
+    start := position
+    position = position.Advance(line)
+
+    // Rows can have a comment at the end.
+    row := line
+    if index := strings.Index(row, "//"); index != -1 {
+      row = row[:index]
+    }
+    if len(strings.TrimSpace(row)) == 0 {
+      continue
+    }
+    start = start.Advance(row[:len(row) - len(strings.TrimLeft(row, " \t"))])
+    row = strings.TrimSpace(row)
+
+    sides := strings.Split(row, "->")
+    if len(sides) != 2 {
+      return nil, errors.New(fmt.Sprintf("The row `%s` isn't a list of inputs and outputs like `0 1 -> 1`", row))
+    }
+
+    inputs, err := parseVectorStates(sides[0])
+    if err != nil {
+      return nil, err
+    }
+    if strings.Contains(inputs, "x") && !inputDontCares {
+      return nil, errors.New(fmt.Sprintf("The inputs of the row `%s` can't contain x, since each input must be on or off", row))
+    }
+    outputs, err := parseVectorStates(sides[1])
+    if err != nil {
+      return nil, err
+    }
+
+    vectors = append(vectors, Vector{Inputs: inputs, Outputs: outputs, Line: start.Line, Col: start.Col})
+  }
+  return vectors, nil
+}
+
+// Parse one side of a row into a character for each wire.
+func parseVectorStates(side string) (string, error) {
+  states := ""
+  for _, value := range strings.Fields(side) {
+    if MATCH_VECTOR_STATES.MatchString(value) {
+      states += strings.ToLower(strings.Replace(value, "_", "", -1))
+      continue
+    }
+
+    literal := MATCH_LITERAL.FindStringSubmatch(value)
+    if literal == nil || literal[0] != value {
+      return "", errors.New(fmt.Sprintf("%s isn't a list of wire states like `01`, or a literal like `4'd3`", value))
+    }
+    bits, err := parseLiteral(literal[0], literal[1], literal[2], literal[3])
+    if err != nil {
+      return "", err
+    }
+    states += formatStates(bits)
+  }
+  return states, nil
+}
+
+// Write the state of each wire as a `0` or a `1`.
+func formatStates(states []bool) string {
+  formatted := ""
+  for _, state := range states {
+    if state {
+      formatted += "1"
+    } else {
+      formatted += "0"
+    }
+  }
+  return formatted
+}
+
+// Parse a string of `0`s and `1`s into the state of each wire.
+func parseStates(states string) []bool {
+  parsed := []bool{}
+  for _, state := range states {
+    parsed = append(parsed, state == '1')
+  }
+  return parsed
+}
+
+// Do the outputs of a block match the states that were expected of them?
+func statesMatch(expected string, actual []bool) bool {
+  if len(expected) != len(actual) {
+    return false
+  }
+  for index, state := range expected {
+    if state != 'x' && (state == '1') != actual[index] {
+      return false
+    }
+  }
+  return true
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+  "regexp"
+  "bytes"
+)
+
+// Characters that can't be used in a verilog identifier.
+var MATCH_NON_VERILOG_IDENTIFIER *regexp.Regexp = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Behavioral verilog modules for each builtin function. Only the modules for builtins that are used
+// within a design are included in the output.
+var VERILOG_BUILTIN_MODULES map[string]string = map[string]string{
+  "toggle": `module lovelace_toggle(input wire state, output wire out);
+  assign out = state;
+endmodule`,
+  "momentary": `module lovelace_momentary(input wire state, output wire out);
+  assign out = state;
+endmodule`,
+  "led": `module lovelace_led(input wire in, output wire state);
+  assign state = in;
+endmodule`,
+  "wave": `module lovelace_wave #(parameter PERIOD = 2, parameter DUTY = 1) (
+  input wire clock,
+  input wire enable,
+  output wire out
+);
+  integer phase = 0;
+  always @(posedge clock) begin
+    if (enable) phase <= (phase + 1) % PERIOD;
+    else phase <= 0;
+  end
+  assign out = enable && (phase < DUTY);
+endmodule`,
+  "tflipflop": `module lovelace_tflipflop(
+  input wire clock,
+  input wire toggle,
+  input wire set,
+  input wire reset,
+  output reg q,
+  output wire nq
+);
+  initial q = 1'b0;
+  assign nq = ~q;
+  always @(posedge clock or posedge set or posedge reset) begin
+    if (set) q <= 1'b1;
+    else if (reset) q <= 1'b0;
+    else if (toggle) q <= ~q;
+  end
+endmodule`,
+}
+
+// A single net within the exported design. Every wire becomes a net, and so does the state of every
+// builtin that interacts with the outside world (switches and leds), which become ports on the top
+// level module.
+type verilogNet struct {
+  Name string
+
+  // The calling contexts of every gate that drives or reads from the net.
+  Drivers []int
+  Readers []int
+
+  // Either "input" or "output" if the net is a port on the top level module.
+  TopLevel string
+
+  // The module that the net is declared within.
+  Scope int
+
+  // Used to order nets in the output.
+  Order int
+}
+
+type verilogExporter struct {
+  summary *Summary
+  hierarchical bool
+
+  nets map[string]*verilogNet
+  contexts map[int]*CallingContext
+}
+
+// Convert a compiled summary into a verilog module named `moduleName`. If `hierarchical` is true,
+// each block invocation (calling context) becomes its own module, otherwise every gate is placed
+// within a single module.
+func ExportVerilog(summary *Summary, moduleName string, hierarchical bool) string {
+  e := &verilogExporter{
+    summary: summary,
+    hierarchical: hierarchical,
+    nets: map[string]*verilogNet{},
+    contexts: map[int]*CallingContext{},
+  }
+  for _, context := range summary.Contexts {
+    e.contexts[context.Id] = context
+  }
+
+  // Record every gate that touches each net.
+  for _, gate := range summary.Gates {
+    context := e.contextOf(gate)
+    for _, input := range gate.Inputs {
+      net := e.net(wireNetName(input), input.Id)
+      net.Readers = append(net.Readers, context)
+    }
+    for _, output := range gate.Outputs {
+      net := e.net(wireNetName(output), output.Id)
+      net.Drivers = append(net.Drivers, context)
+    }
+
+    // Builtins that interact with the outside world are connected to a port on the top level
+    // module.
+    if gate.Type == BUILTIN_FUNCTION {
+      switch gate.Label {
+      case "toggle": fallthrough
+      case "momentary":
+        net := e.net(builtinPortName(gate), gate.Id)
+        net.TopLevel = "input"
+        net.Readers = append(net.Readers, context)
+      case "led":
+        net := e.net(builtinPortName(gate), gate.Id)
+        net.TopLevel = "output"
+        net.Drivers = append(net.Drivers, context)
+      case "wave":
+        // All waves share a single clock, which is advanced once per tick.
+        net := e.net("clock", 0)
+        net.TopLevel = "input"
+        net.Readers = append(net.Readers, context)
+      }
+    }
+  }
+
+  // Each net is declared in the innermost module that contains everything that touches it.
+  for _, net := range e.nets {
+    if len(net.TopLevel) > 0 {
+      continue
+    }
+    touching := net.touching()
+    net.Scope = touching[0]
+    for _, context := range touching[1:] {
+      net.Scope = e.commonAncestor(net.Scope, context)
+    }
+  }
+
+  var output bytes.Buffer
+  output.WriteString("// Generated by lovelace.\n")
+
+  // Emit the modules for each calling context, innermost first, so that every module is defined
+  // before it is used.
+  if hierarchical {
+    contexts := append([]*CallingContext{}, summary.Contexts...)
+    sort.SliceStable(contexts, func(i, j int) bool {
+      if contexts[i].Depth != contexts[j].Depth {
+        return contexts[i].Depth > contexts[j].Depth
+      }
+      return contexts[i].Id < contexts[j].Id
+    })
+    for _, context := range contexts {
+      output.WriteString("\n")
+      e.writeModule(&output, context.Id, contextModuleName(context))
+    }
+  }
+
+  output.WriteString("\n")
+  e.writeModule(&output, 0, verilogIdentifier(moduleName))
+
+  // Finally, include a definition for each builtin that was used.
+  var builtins []string
+  for _, gate := range summary.Gates {
+    if gate.Type == BUILTIN_FUNCTION {
+      builtins = append(builtins, gate.Label)
+    }
+  }
+  sort.Strings(builtins)
+  for index, builtin := range builtins {
+    if index > 0 && builtins[index - 1] == builtin {
+      continue
+    }
+    if module, ok := VERILOG_BUILTIN_MODULES[builtin]; ok {
+      output.WriteString("\n")
+      output.WriteString(module)
+      output.WriteString("\n")
+    }
+  }
+
+  return output.String()
+}
+
+func (e *verilogExporter) net(name string, order int) *verilogNet {
+  if net, ok := e.nets[name]; ok {
+    return net
+  }
+  net := &verilogNet{Name: name, Order: order}
+  e.nets[name] = net
+  return net
+}
+
+// The module that a gate is placed within.
+func (e *verilogExporter) contextOf(gate *Gate) int {
+  if !e.hierarchical {
+    return 0
+  }
+  return gate.CallingContext
+}
+
+// Is the calling context `id` equal to or within the calling context `ancestor`?
+func (e *verilogExporter) isWithin(id int, ancestor int) bool {
+  for {
+    if id == ancestor {
+      return true
+    }
+    context, ok := e.contexts[id]
+    if !ok || id == 0 {
+      return false
+    }
+    id = context.Parent
+  }
+}
+
+func (e *verilogExporter) commonAncestor(a int, b int) int {
+  for !e.isWithin(b, a) {
+    context, ok := e.contexts[a]
+    if !ok {
+      return 0
+    }
+    a = context.Parent
+  }
+  return a
+}
+
+func (e *verilogExporter) writeModule(output *bytes.Buffer, contextId int, name string) {
+  var portDeclarations []string
+  var locals []*verilogNet
+  for _, net := range e.sortedNets() {
+    if contextId == 0 && len(net.TopLevel) > 0 {
+      portDeclarations = append(portDeclarations, fmt.Sprintf("  %s wire %s", net.TopLevel, net.Name))
+      continue
+    }
+    if net.Scope == contextId {
+      locals = append(locals, net)
+      continue
+    }
+
+    // Any net that is touched within this module but is declared outside of it is a port. If it's
+    // driven from within this module, then it's an output.
+    if e.isTouchedWithin(net, contextId) && !e.isWithin(net.Scope, contextId) {
+      direction := "input"
+      for _, context := range net.Drivers {
+        if e.isWithin(context, contextId) {
+          direction = "output"
+          break
+        }
+      }
+      portDeclarations = append(portDeclarations, fmt.Sprintf("  %s wire %s", direction, net.Name))
+    }
+  }
+
+  if len(portDeclarations) == 0 {
+    fmt.Fprintf(output, "module %s;\n", name)
+  } else {
+    fmt.Fprintf(output, "module %s(\n%s\n);\n", name, strings.Join(portDeclarations, ",\n"))
+  }
+
+  for _, net := range locals {
+    fmt.Fprintf(output, "  wire %s;\n", net.Name)
+  }
+
+  for _, gate := range e.summary.Gates {
+    if e.contextOf(gate) == contextId {
+      output.WriteString(verilogGate(gate))
+    }
+  }
+
+  // Instantiate each calling context that is directly within this one.
+  if e.hierarchical {
+    for _, context := range e.summary.Contexts {
+      if context.Parent != contextId {
+        continue
+      }
+
+      var connections []string
+      for _, net := range e.sortedNets() {
+        if e.isTouchedWithin(net, context.Id) && !e.isWithin(net.Scope, context.Id) {
+          connections = append(connections, fmt.Sprintf(".%s(%s)", net.Name, net.Name))
+        }
+      }
+      fmt.Fprintf(
+        output,
+        "  %s c%d(%s);\n",
+        contextModuleName(context),
+        context.Id,
+        strings.Join(connections, ", "),
+      )
+    }
+  }
+
+  output.WriteString("endmodule\n")
+}
+
+// Is the net driven by or read from a gate within the calling context `contextId`?
+func (e *verilogExporter) isTouchedWithin(net *verilogNet, contextId int) bool {
+  for _, context := range net.touching() {
+    if e.isWithin(context, contextId) {
+      return true
+    }
+  }
+  return false
+}
+
+func (net *verilogNet) touching() []int {
+  return append(append([]int{}, net.Drivers...), net.Readers...)
+}
+
+func (e *verilogExporter) sortedNets() []*verilogNet {
+  var nets []*verilogNet
+  for _, net := range e.nets {
+    nets = append(nets, net)
+  }
+  // Top level ports are listed before all other nets.
+  sort.Slice(nets, func(i, j int) bool {
+    if (len(nets[i].TopLevel) > 0) != (len(nets[j].TopLevel) > 0) {
+      return len(nets[i].TopLevel) > 0
+    }
+    if nets[i].Order != nets[j].Order {
+      return nets[i].Order < nets[j].Order
+    }
+    return nets[i].Name < nets[j].Name
+  })
+  return nets
+}
+
+// Convert a single gate into verilog.
+func verilogGate(gate *Gate) string {
+  var inputs []string
+  for _, input := range gate.Inputs {
+    inputs = append(inputs, wireNetName(input))
+  }
+  var outputs []string
+  for _, output := range gate.Outputs {
+    outputs = append(outputs, wireNetName(output))
+  }
+
+  switch gate.Type {
+  case AND: fallthrough
+  case OR: fallthrough
+  case XOR: fallthrough
+  case NAND: fallthrough
+  case NOR: fallthrough
+  case XNOR:
+    // Each of these gates is a verilog primitive with the same name.
+    return fmt.Sprintf(
+      "  %s g%d(%s, %s);\n",
+      strings.ToLower(string(gate.Type)),
+      gate.Id,
+      outputs[0],
+      strings.Join(inputs, ", "),
+    )
+  case NOT:
+    return fmt.Sprintf("  not g%d(%s, %s);\n", gate.Id, outputs[0], inputs[0])
+  case SOURCE:
+    return fmt.Sprintf("  assign %s = 1'b1;\n", outputs[0])
+  case GROUND:
+    return fmt.Sprintf("  assign %s = 1'b0;\n", outputs[0])
+  case BLOCK_INPUT: fallthrough
+  case BLOCK_OUTPUT:
+    return fmt.Sprintf("  buf g%d(%s, %s); // %s\n", gate.Id, outputs[0], inputs[0], gate.Label)
+  case BUILTIN_FUNCTION:
+    // Unconnected inputs of a builtin are tied low.
+    input := func(index int) string {
+      if index < len(inputs) {
+        return inputs[index]
+      }
+      return "1'b0"
+    }
+    output := func(index int) string {
+      if index < len(outputs) {
+        return outputs[index]
+      }
+      return ""
+    }
+
+    switch gate.Label {
+    case "toggle": fallthrough
+    case "momentary":
+      return fmt.Sprintf(
+        "  lovelace_%s g%d(.state(%s), .out(%s));\n",
+        gate.Label,
+        gate.Id,
+        builtinPortName(gate),
+        output(0),
+      )
+    case "led":
+      return fmt.Sprintf("  lovelace_led g%d(.in(%s), .state(%s));\n", gate.Id, input(0), builtinPortName(gate))
+    case "wave":
+      _, period, duty := parseWaveState(gate.State)
+      return fmt.Sprintf(
+        "  lovelace_wave #(.PERIOD(%d), .DUTY(%d)) g%d(.clock(clock), .enable(%s), .out(%s));\n",
+        period,
+        duty,
+        gate.Id,
+        input(0),
+        output(0),
+      )
+    case "tflipflop":
+      return fmt.Sprintf(
+        "  lovelace_tflipflop g%d(.clock(%s), .toggle(%s), .set(%s), .reset(%s), .q(%s), .nq(%s));\n",
+        gate.Id,
+        input(0),
+        input(1),
+        input(2),
+        input(3),
+        output(0),
+        output(1),
+      )
+    }
+  }
+
+  return fmt.Sprintf("  // Unsupported gate %d of type %s %s\n", gate.Id, gate.Type, gate.Label)
+}
+
+func wireNetName(wire *Wire) string {
+  if wire.Id < 0 {
+    return fmt.Sprintf("wn%d", -wire.Id)
+  }
+  return fmt.Sprintf("w%d", wire.Id)
+}
+
+// The name of the top level port that a switch or led is connected to, ie `toggle_3`.
+func builtinPortName(gate *Gate) string {
+  return fmt.Sprintf("%s_%d", gate.Label, gate.Id)
+}
+
+func contextModuleName(context *CallingContext) string {
+  return fmt.Sprintf("%s_%d", verilogIdentifier(context.Name), context.Id)
+}
+
+// Convert any string into a valid verilog identifier.
+func verilogIdentifier(name string) string {
+  name = MATCH_NON_VERILOG_IDENTIFIER.ReplaceAllString(name, "_")
+  if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+    name = "m_" + name
+  }
+  return name
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+  "testing"
+  "fmt"
+  "strings"
+)
+
+const VERILOG_TEST_SOURCE = `
+block nand2(a b) {
+  return (not (a and b))
+}
+led(nand2(toggle() 1))
+`
+
+func TestExportVerilog(t *testing.T) {
+  summary, err := RunString(VERILOG_TEST_SOURCE, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  expected := `// Generated by lovelace.
+
+module main(
+  input wire toggle_1,
+  output wire led_8
+);
+  wire w1;
+  wire w2;
+  wire w3;
+  wire w4;
+  wire w5;
+  wire w6;
+  wire w7;
+  lovelace_toggle g1(.state(toggle_1), .out(w1));
+  buf g2(w2, w1); // Input 0 into block nand2 invocation 1
+  assign w3 = 1'b1;
+  buf g4(w4, w3); // Input 1 into block nand2 invocation 1
+  and g5(w5, w2, w4);
+  not g6(w6, w5);
+  buf g7(w7, w6); // Output 0 from block nand2 invocation 1
+  lovelace_led g8(.in(w7), .state(led_8));
+endmodule
+
+` + VERILOG_BUILTIN_MODULES["led"] + `
+
+` + VERILOG_BUILTIN_MODULES["toggle"] + "\n"
+
+  if result := ExportVerilog(summary, "main", false); result != expected {
+    t.Errorf("Verilog doesn't match!\n%s", result)
+  }
+}
+
+func TestExportVerilogHierarchical(t *testing.T) {
+  summary, err := RunString(VERILOG_TEST_SOURCE, false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  expected := `// Generated by lovelace.
+
+module nand2_1(
+  input wire w1,
+  input wire w3,
+  output wire w7
+);
+  wire w2;
+  wire w4;
+  wire w5;
+  wire w6;
+  buf g2(w2, w1); // Input 0 into block nand2 invocation 1
+  buf g4(w4, w3); // Input 1 into block nand2 invocation 1
+  and g5(w5, w2, w4);
+  not g6(w6, w5);
+  buf g7(w7, w6); // Output 0 from block nand2 invocation 1
+endmodule
+
+module main(
+  input wire toggle_1,
+  output wire led_8
+);
+  wire w1;
+  wire w3;
+  wire w7;
+  lovelace_toggle g1(.state(toggle_1), .out(w1));
+  assign w3 = 1'b1;
+  lovelace_led g8(.in(w7), .state(led_8));
+  nand2_1 c1(.w1(w1), .w3(w3), .w7(w7));
+endmodule
+
+` + VERILOG_BUILTIN_MODULES["led"] + `
+
+` + VERILOG_BUILTIN_MODULES["toggle"] + "\n"
+
+  if result := ExportVerilog(summary, "main", true); result != expected {
+    t.Errorf("Verilog doesn't match!\n%s", result)
+  }
+}
+
+func TestVerilogIdentifier(t *testing.T) {
+  if name := verilogIdentifier("my-design"); name != "my_design" {
+    t.Errorf("Expected my_design, got %s", name)
+  }
+  if name := verilogIdentifier("8bit"); name != "m_8bit" {
+    t.Errorf("Expected m_8bit, got %s", name)
+  }
+}
+
+func TestExportVerilogManyInputGate(t *testing.T) {
+  summary, err := compileMerged("led(toggle() and toggle() and toggle())")
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  and := findGatesByType(summary.Gates, AND)[0]
+  expected := fmt.Sprintf("  and g%d(w%d, w1, w2, w4);\n", and.Id, and.Outputs[0].Id)
+  if result := verilogGate(and); result != expected {
+    t.Errorf("Verilog doesn't match!\n%s", result)
+  }
+}
+
+func TestExportVerilogFlipFlopStartsLikeSimulation(t *testing.T) {
+  summary, err := RunString("let q nq = tflipflop(momentary() 1)\nled(q)\nled(nq)", false)
+  if err != nil {
+    t.Errorf(fmt.Sprintf("Error returned! %s", err))
+    return
+  }
+
+  // The exported flip flop must start in the same state that the simulation starts it in.
+  Execute(summary.Gates, summary.Wires)
+  flipflop := findGateByLabel(summary.Gates, "tflipflop")
+  expected := "initial q = 1'b0;"
+  if flipflop.Outputs[0].Powered {
+    expected = "initial q = 1'b1;"
+  }
+  if flipflop.Outputs[0].Powered || !flipflop.Outputs[1].Powered {
+    t.Errorf("Flip flop should start with q off and nq on")
+  }
+  if !strings.Contains(VERILOG_BUILTIN_MODULES["tflipflop"], expected) {
+    t.Errorf("Verilog flip flop doesn't start with %s", expected)
+  }
+}
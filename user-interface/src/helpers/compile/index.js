@@ -18,7 +18,10 @@ export default function compile(server, source) {
 
     // Was an error received while compiling?
     if (data.Error) {
-      throw new Error(data.Error);
+      // Include where the error is, so that the editor can underline it.
+      const error = new Error(data.Error);
+      error.compileError = data.CompileError;
+      throw error;
     }
 
     data.Gates = data.Gates || []
@@ -1,28 +1,66 @@
-import positionGates from '../../position-gates'; 
+import positionGates from '../../position-gates';
 
 // When in preview mode, don't render an editor. Instead, connect over websockets to a server
 // running on the local system and whenever a new ast update is pushed, update what is shown in the
 // visualization.
+//
+// Returns a function that sends an input event (like `{Type: 'set', Gate: 1, State: 'on'}`) to the
+// server, which simulates the program and sends back what changed.
 export default function connectToPreviewWebsocket(renderFrame, websocketsServer) {
-  const ws = new WebSocket(`${websocketsServer}/v1/websocket`);
-  ws.onmessage = event => {
-    const payload = JSON.parse(event.data);
-    let data = payload,
-        error = null;
-
-    if (payload.Gates) {
-      // Position gates on the screen
-      data = positionGates(data);
-    } else {
-      error = payload.Error;
+  // The socket that is currently connected. It's replaced each time that the connection is lost.
+  let ws = null;
+
+  // The most recently received program, which diffs are applied to.
+  let current = null;
+
+  function connect() {
+    ws = new WebSocket(`${websocketsServer}/v1/websocket`);
+
+    ws.onmessage = event => {
+      const payload = JSON.parse(event.data);
+      let data = payload,
+          error = null;
+
+      if (payload.Diff) {
+        // The server simulated an event (like a switch being pressed), so update the state of each
+        // gate and wire that changed.
+        if (!current) { return; }
+        payload.Diff.Gates.forEach(({Id, State}) => {
+          const gate = current.Gates.find(i => i.Id === Id);
+          if (gate) { gate.State = State; }
+        });
+        payload.Diff.Wires.forEach(({Id, Powered}) => {
+          current.Wires.filter(i => i.Id === Id).forEach(wire => { wire.Powered = Powered; });
+        });
+        renderFrame(current, null, payload.Diff.Gates.map(i => i.Id));
+        return;
+      } else if (payload.EventError) {
+        console.error(`Event failed: ${payload.EventError}`);
+        return;
+      } else if (payload.Gates) {
+        // Position gates on the screen
+        data = positionGates(data);
+        current = data;
+      } else {
+        error = payload.Error;
+      }
+
+      // Rerender using the data received.
+      renderFrame(data, error, data.Gates ? data.Gates.map(i => i.Id) : []);
     }
 
-    // Rerender using the data received.
-    renderFrame(data, error, data.Gates ? data.Gates.map(i => i.Id) : []);
+    // On close, wait three seconds and try to connect again.
+    ws.onclose = event => {
+      setTimeout(connect, 3000);
+    }
   }
+  connect();
 
-  // On close, wait three seconds and try to connect again.
-  ws.onclose = event => {
-    setTimeout(() => connectToPreviewWebsocket(renderFrame, websocketsServer), 3000);
-  }
+  return function sendEvent(event) {
+    if (ws.readyState !== WebSocket.OPEN) {
+      console.error('Event not sent, the preview server is disconnected.');
+      return;
+    }
+    ws.send(JSON.stringify(event));
+  };
 }
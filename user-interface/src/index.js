@@ -20,14 +20,23 @@ const query = queryString.parse(window.location.search);
 const server = query.server || DEFAULT_SERVER;
 
 
+const previewMode = Boolean(query.preview);
+
+// In preview mode, the program is simulated by the server that it's connected to, so switches are
+// changed by sending events over the websocket.
+let sendEvent = null;
+
 // Get a reference to the svg viewport
-const renderFrame = initializeViewport(document.getElementById('viewport'), server);
+const renderFrame = initializeViewport(
+  document.getElementById('viewport'),
+  server,
+  previewMode ? event => sendEvent(event) : null
+);
 
-const previewMode = Boolean(query.preview);
 if (previewMode) {
   document.body.className += ' preview';
   const websocketsServer = server.replace('http', 'ws');
-  connectToPreviewWebsocket(renderFrame, websocketsServer);
+  sendEvent = connectToPreviewWebsocket(renderFrame, websocketsServer);
 } else {
   buildSplits();
   initializeEditor(document.getElementById('editor-parent'), renderFrame, server);
@@ -13,11 +13,15 @@ CodeMirror.defineSimpleMode('bitlang', {
   // The start state contains the rules that are intially used
   start: [
     {regex: /(block)(\s+)([A-Za-z_][A-Za-z0-9_]*)/, token: ["keyword", null, "variable-2"]},
-    {regex: /(let|return|block)\b/, token: "keyword"},
+    {regex: /(table)(\s+)([A-Za-z_][A-Za-z0-9_]*)/, token: ["keyword", null, "variable-2"]},
+    {regex: /(test)(\s+)("[^"\n]*")/, token: ["keyword", null, "string"]},
+    {regex: /(let|return|block|for|in|if|else|as|from)\b/, token: "keyword"},
+    {regex: /->/, token: "operator"},
+    {regex: /[0-9]+'[bdhBDH][0-9A-Fa-f_]+/, token: "atom"},
     {regex: /(?:1|0)/, token: "atom"},
     {regex: /\/\*/, token: "comment", next: "comment"},
     {regex: /\/\/[^\n]*/, token: "comment"},
-    {regex: /(?:and|or|not|import)/, token: "property"},
+    {regex: /(?:xnor|xor|nand|nor|and|or|not|import)/, token: "property"},
     {regex: /[A-Za-z_][A-Za-z0-9_]*/, token: "variable-3"},
     {regex: /[{[(]/, indent: true},
     {regex: /[}\])]/, dedent: true},
@@ -49,6 +53,25 @@ export function createEditor(element) {
 export default async function initializeEditor(element, renderFrame, server) {
   const editor = createEditor(element);
 
+  // The underline under the code that caused the most recent compile error.
+  let errorMark = null;
+  function markError(compileError) {
+    if (errorMark) {
+      errorMark.clear();
+      errorMark = null;
+    }
+
+    // Only underline errors that are within the source in the editor (and not in an import).
+    if (!compileError || compileError.StartLine === 0 || compileError.File) {
+      return;
+    }
+    errorMark = editor.markText(
+      {line: compileError.StartLine - 1, ch: compileError.StartCol - 1},
+      {line: compileError.EndLine - 1, ch: compileError.EndCol - 1},
+      {className: 'compile-error', title: compileError.Message},
+    );
+  }
+
   // Render editor contents at maximum once a second.
   const debouncedCompile = debounce(async (server, value) => {
     document.getElementById('viewport-refreshing').style.display = 'block';
@@ -56,6 +79,7 @@ export default async function initializeEditor(element, renderFrame, server) {
     try {
       // Attempt to compile the source code.
       data = await compile(server, value);
+      markError(null);
       renderFrame(data, null, data.Gates.map(i => i.Id));
 
       localStorage.source = value;
@@ -67,6 +91,7 @@ export default async function initializeEditor(element, renderFrame, server) {
       }, 100);
     } catch (err) {
       // An error occurred within compliation!
+      markError(err.compileError);
       renderFrame({}, err, []);
 
       document.getElementById('viewport-refreshing').style.display = 'block';
@@ -0,0 +1,22 @@
+import * as gatesAnd from './and';
+
+// A nand gate is an and gate with a bubble on its output.
+export function insert(group) {
+  gatesAnd.insert(group);
+  group.append('circle')
+    .attr('stroke', 'black')
+    .attr('stroke-width', 2)
+    .attr('r', 4)
+    .attr('cx', 15)
+    .attr('cy', -4)
+
+  return group
+}
+
+export function merge(group) {
+  gatesAnd.merge(group);
+  group.select('circle')
+    .attr('fill', d => d.active ? 'green' : 'white')
+
+  return group
+}
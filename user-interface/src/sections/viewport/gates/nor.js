@@ -0,0 +1,22 @@
+import * as gatesOr from './or';
+
+// A nor gate is an or gate with a bubble on its output.
+export function insert(group) {
+  gatesOr.insert(group);
+  group.append('circle')
+    .attr('stroke', 'black')
+    .attr('stroke-width', 2)
+    .attr('r', 4)
+    .attr('cx', 15)
+    .attr('cy', -4)
+
+  return group
+}
+
+export function merge(group) {
+  gatesOr.merge(group);
+  group.select('circle')
+    .attr('fill', d => d.active ? 'green' : 'white')
+
+  return group
+}
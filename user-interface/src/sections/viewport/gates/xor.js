@@ -0,0 +1,20 @@
+import * as gatesOr from './or';
+
+// A xor gate is an or gate with an extra curve along its inputs.
+export function insert(group) {
+  gatesOr.insert(group);
+  group.append('path')
+    .attr('class', 'xor-curve')
+    .attr('fill', 'transparent')
+    .attr('stroke', 'black')
+    .attr('stroke-width', 2)
+    .attr('d', 'M0,49 C7,47 23,47 30,49')
+
+  return group
+}
+
+export function merge(group) {
+  gatesOr.merge(group);
+
+  return group
+}
@@ -2,7 +2,9 @@ import renderViewport from './render';
 
 const zoomSlider = document.getElementById('zoom-slider');
 
-export default function initializeViewport(element, server) {
+// When `sendEvent` is passed, the program is simulated somewhere else (ie, by `lovel run`), and each
+// switch that changes is sent as an event instead of running the whole program with `/v1/run`.
+export default function initializeViewport(element, server, sendEvent) {
   // Create a new viewport
   const updateViewport = renderViewport(element);
 
@@ -10,6 +12,9 @@ export default function initializeViewport(element, server) {
 
   let gateState = null;
 
+  // The state of each switch the last time that a frame was rendered, by id.
+  let switchStates = {};
+
   // Store if the system is currently in an error state.
   let currentError = null;
 
@@ -98,6 +103,61 @@ export default function initializeViewport(element, server) {
 
   // (maybe) Future option 3: pinch to zoom?
 
+  // Run the program on the server, advancing any clock sources (ie, `wave`) by `ticks`, and update
+  // the state of each gate and wire with the result.
+  async function run(data, ticks) {
+    try {
+      const result = await window.fetch(`${server}/v1/run`, {
+        method: 'POST',
+        body: JSON.stringify(Object.assign({}, data, {Ticks: ticks})),
+        headers: {
+          'Content-Type': 'text/plain',
+          'Accept': 'application/json',
+        },
+      });
+
+      if (!result.ok) {
+        throw new Error(`Run failed: ${result.statusCode}`);
+      }
+
+      const updates = await result.json();
+
+      // Was an error received while compiling?
+      if (updates.Error) {
+        throw new Error(updates.Error);
+      }
+
+      if (!updates.Gates || !updates.Wires) { return; }
+      if (updates.Gates.length === 0) { return; }
+
+      // Update the state of each gate, and the powered state of each wire
+      data.Gates.forEach((gate, index) => {
+        data.Gates[index].State = updates.Gates[index].State;
+      });
+      data.Wires.forEach((wire, index) => {
+        data.Wires[index].Powered = updates.Wires[index].Powered;
+      });
+
+      // Rerender the viewport.
+      updateViewport(data, {viewboxX, viewboxY, viewboxZoom, renderFrame});
+    } catch (err) {
+      renderFrame({}, err, []);
+    }
+  }
+
+  // Clock sources are advanced on a timer, so that clocked circuits (like a counter) run without any
+  // clicking. In preview mode, the server that simulates the program advances them instead.
+  const TICK_INTERVAL = 500;
+  let ticking = false;
+  setInterval(async () => {
+    if (sendEvent || ticking || !hoistedData || currentError) { return; }
+    if (!hoistedData.Gates.some(i => i.Type === 'BUILTIN_FUNCTION' && i.Label === 'wave')) { return; }
+
+    ticking = true;
+    await run(hoistedData, 1);
+    ticking = false;
+  }, TICK_INTERVAL);
+
   async function renderFrame(data, error, updatedGateIds) {
     data.Gates = data.Gates || []
     data.Wires = data.Wires || []
@@ -114,6 +174,23 @@ export default function initializeViewport(element, server) {
       document.getElementById('error-bar').style.display = 'none';
     }
 
+    if (sendEvent) {
+      // Send each switch that changed since the last frame. A switch that is new (ie, the program
+      // was just recompiled) hasn't changed, and the server already knows about it.
+      const newSwitchStates = {};
+      data.Gates.filter(i => i.Type === 'BUILTIN_FUNCTION' && ['toggle', 'momentary'].indexOf(i.Label) !== -1)
+        .forEach(gate => {
+          newSwitchStates[gate.Id] = gate.State;
+          if (switchStates[gate.Id] !== undefined && switchStates[gate.Id] !== gate.State) {
+            sendEvent({Type: 'set', Gate: gate.Id, State: gate.State});
+          }
+        });
+      switchStates = newSwitchStates;
+
+      updateViewport(data, {viewboxX, viewboxY, viewboxZoom, renderFrame});
+      return;
+    }
+
     // Calculate a hash of the current gate's state
     const newGateState = JSON.stringify(
       data.Gates.filter(i => i.Type === 'BUILTIN_FUNCTION' && ['toggle', 'momentary'].indexOf(i.Label) !== -1)
@@ -126,43 +203,7 @@ export default function initializeViewport(element, server) {
     if (gateState !== newGateState) {
       gateState = newGateState;
 
-      try {
-        const result = await window.fetch(`${server}/v1/run`, {
-          method: 'POST',
-          body: JSON.stringify(data),
-          headers: {
-            'Content-Type': 'text/plain',
-            'Accept': 'application/json',
-          },
-        });
-
-        if (!result.ok) {
-          throw new Error(`Run failed: ${result.statusCode}`);
-        }
-
-        const updates = await result.json();
-
-        // Was an error received while compiling?
-        if (updates.Error) {
-          throw new Error(updates.Error);
-        }
-
-        if (!updates.Gates || !updates.Wires) { return; }
-        if (updates.Gates.length === 0) { return; }
-
-        // Update the state of each gate, and the powered state of each wire
-        data.Gates.forEach((gate, index) => {
-          data.Gates[index].State = updates.Gates[index].State;
-        });
-        data.Wires.forEach((wire, index) => {
-          data.Wires[index].Powered = updates.Wires[index].Powered;
-        });
-
-        // Rerender the viewport.
-        updateViewport(data, {viewboxX, viewboxY, viewboxZoom, renderFrame});
-      } catch (err) {
-        renderFrame({}, err, []);
-      }
+      await run(data, 0);
     } else {
       // Even if there wasn't any change to what should be rendered on screen, Rerender the viewport
       // anyway.
@@ -5,6 +5,10 @@ import * as gatesGround from './gates/ground';
 import * as gatesAnd from './gates/and';
 import * as gatesOr from './gates/or';
 import * as gatesNot from './gates/not';
+import * as gatesXor from './gates/xor';
+import * as gatesNand from './gates/nand';
+import * as gatesNor from './gates/nor';
+import * as gatesXnor from './gates/xnor';
 import * as gatesBlockInput from './gates/block-input';
 import * as gatesBlockOutput from './gates/block-output';
 import * as gatesBuiltinMomentary from './gates/builtin-momentary';
@@ -18,6 +22,10 @@ const GATE_RENDERERS = {
   'AND': gatesAnd,
   'OR': gatesOr,
   'NOT': gatesNot,
+  'XOR': gatesXor,
+  'NAND': gatesNand,
+  'NOR': gatesNor,
+  'XNOR': gatesXnor,
   'BLOCK_INPUT': gatesBlockInput,
   'BLOCK_OUTPUT': gatesBlockOutput,
   'BUILTIN_FUNCTION': {